@@ -1,18 +1,28 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
+	"strconv"
 	"strings"
+	"text/tabwriter"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
+	"github.com/ubuntu/ubuntu-report/internal/i18n"
 	"github.com/ubuntu/ubuntu-report/internal/sender"
 	"github.com/ubuntu/ubuntu-report/internal/utils"
 	"github.com/ubuntu/ubuntu-report/pkg/sysmetrics"
 )
 
+// maxReportSize is the biggest report the privileged helper accepts
+const maxReportSize = 1 << 20
+
 // generate README, shell completion and manpages
 //go:generate go test . --generate --path ../../build/
 
@@ -28,10 +38,62 @@ func main() {
 func generateRootCmd() *cobra.Command {
 	log.SetFormatter(&log.TextFormatter{DisableTimestamp: true})
 	log.SetLevel(log.ErrorLevel)
+	tr := i18n.Load("", i18n.Language(os.Getenv))
 
 	var flagForce bool
 	var flagVerbosity int
 	var flagServerURL string
+	var flagCAFile, flagClientCert, flagClientKey string
+	var flagPinnedSPKI []string
+	var flagInsecure bool
+	var flagToFile string
+	var flagAgainst, flagFormat string
+	var flagRelease string
+	var flagAll bool
+	var flagJSON bool
+	var flagAnnotate bool
+	var flagDiagnostics bool
+	var flagShowFormat, flagField string
+	var flagEdit bool
+	var flagTUI bool
+	var flagAnswerTimeout time.Duration
+	var flagDryRun bool
+	var flagVariant string
+
+	// sendOptions returns options overriding the configuration from command line flags
+	sendOptions := func() []sysmetrics.Option {
+		var opts []sysmetrics.Option
+		if flagCAFile != "" {
+			opts = append(opts, sysmetrics.WithCABundle(flagCAFile))
+		}
+		if flagClientCert != "" || flagClientKey != "" {
+			opts = append(opts, sysmetrics.WithClientCertificate(flagClientCert, flagClientKey))
+		}
+		if len(flagPinnedSPKI) > 0 {
+			opts = append(opts, sysmetrics.WithPinnedSPKI(flagPinnedSPKI...))
+		}
+		if flagInsecure {
+			opts = append(opts, sysmetrics.WithInsecure())
+		}
+		if flagDryRun {
+			opts = append(opts, sysmetrics.WithDryRun())
+		}
+		if flagVariant != "" {
+			opts = append(opts, sysmetrics.WithVariant(flagVariant))
+		}
+		source := sysmetrics.ConsentFromCLI
+		if os.Geteuid() == 0 {
+			source = sysmetrics.ConsentFromAdmin
+		}
+		return append(opts, sysmetrics.WithConsentSource(source))
+	}
+	// serverURL returns the url requested on the command line, or an empty string for the configured one
+	serverURL := func(cmd *cobra.Command) string {
+		if !cmd.Flags().Changed("url") {
+			return ""
+		}
+		return flagServerURL
+	}
 
 	var rootCmd = &cobra.Command{
 		Use:   "ubuntu-report",
@@ -51,7 +113,15 @@ func generateRootCmd() *cobra.Command {
 			}
 		},
 		Run: func(cmd *cobra.Command, args []string) {
-			if err := sysmetrics.CollectAndSend(sysmetrics.ReportInteractive, flagForce, flagServerURL); err != nil {
+			// users answering can authenticate to record the report machine-wide
+			opts := append(sendOptions(), sysmetrics.WithPrivilegedHelper())
+			if flagTUI {
+				opts = append(opts, sysmetrics.WithTerminalUI())
+			}
+			if flagAnswerTimeout > 0 {
+				opts = append(opts, sysmetrics.WithAnswerTimeout(flagAnswerTimeout))
+			}
+			if err := sysmetrics.CollectAndSend(sysmetrics.ReportInteractive, flagForce, serverURL(cmd), opts...); err != nil {
 				log.Errorf(utils.ErrFormat, err)
 				os.Exit(1)
 			}
@@ -59,24 +129,103 @@ func generateRootCmd() *cobra.Command {
 	}
 	rootCmd.PersistentFlags().CountVarP(&flagVerbosity, "verbose", "v", "issue INFO (-v) and DEBUG (-vv) output")
 	rootCmd.PersistentFlags().BoolVarP(&flagForce, "force", "f", false, "collect and send new report even if already reported")
+	rootCmd.PersistentFlags().StringVar(&flagCAFile, "ca-file", "", "PEM bundle of certificate authorities to trust in addition to the system ones")
+	rootCmd.PersistentFlags().StringVar(&flagClientCert, "client-cert", "", "PEM client certificate to authenticate to the server")
+	rootCmd.PersistentFlags().StringVar(&flagClientKey, "client-key", "", "PEM private key of the client certificate")
+	rootCmd.PersistentFlags().StringSliceVar(&flagPinnedSPKI, "pin-spki", nil, "only accept servers whose certificate chain contains this base64 sha256 public key hash")
+	rootCmd.PersistentFlags().BoolVar(&flagInsecure, "insecure", false, "allow sending reports to non https urls")
+	rootCmd.PersistentFlags().StringVar(&flagVariant, "variant", "", "report as this product variant instead of the detected one: "+strings.Join(sysmetrics.Variants, ", "))
 
 	rootCmd.Flags().StringVarP(&flagServerURL, "url", "u", sender.BaseURL, "server url to send report to. Leave empty for default.")
+	rootCmd.Flags().BoolVar(&flagDryRun, "dry-run", false, "print the requests reports would be sent with instead of sending them, without changing any local state")
+	rootCmd.Flags().BoolVar(&flagTUI, "tui", false, "choose which sections of the report to send in a full-screen terminal interface")
+	rootCmd.Flags().DurationVar(&flagAnswerTimeout, "answer-timeout", 0, "quit without sending anything if not answered within this duration, like 5m")
 
 	show := &cobra.Command{
 		Use:   "show",
 		Short: "Only collect and display metrics without sending",
-		Args:  cobra.NoArgs,
+		Args:  noArgs(tr),
 		Run: func(cmd *cobra.Command, args []string) {
-			data, err := sysmetrics.Collect()
+			if flagAnnotate && (flagShowFormat != "json" || flagField != "") {
+				log.Error(tr.Get("--annotate is only supported for the whole report in json format"))
+				os.Exit(1)
+			}
+			var data []byte
+			var diags []sysmetrics.Diagnostic
+			var err error
+			if flagDiagnostics {
+				data, diags, err = sysmetrics.CollectWithDiagnostics(sendOptions()...)
+			} else {
+				data, err = sysmetrics.Collect(sendOptions()...)
+			}
+			if err == nil {
+				switch {
+				case flagAnnotate:
+					data = sysmetrics.Annotate(data)
+				case flagShowFormat != "json" || flagField != "":
+					data, err = sysmetrics.FormatReport(data, flagShowFormat, flagField)
+				}
+			}
 			if err != nil {
 				log.Errorf(utils.ErrFormat, err)
 				os.Exit(1)
 			}
 			fmt.Println(string(data))
+			// diagnostics go to stderr, so that the report stays parseable in any format
+			if flagDiagnostics {
+				printDiagnostics(os.Stderr, tr, diags)
+			}
 		},
 	}
+	show.Flags().BoolVar(&flagAnnotate, "annotate", false, "describe each field: where it comes from, why it's collected and what it can tell")
+	show.Flags().StringVar(&flagShowFormat, "format", "json", "output format: "+strings.Join(sysmetrics.Formats, ", "))
+	show.Flags().StringVar(&flagField, "field", "", "only show this field, as a path like CPU.Name or GPU[0].Vendor, or a JSON pointer like /GPU/0/Vendor")
+	show.Flags().BoolVar(&flagDiagnostics, "diagnostics", false, "list on stderr how each section of the report was collected and why some are missing")
 	rootCmd.AddCommand(show)
 
+	explain := &cobra.Command{
+		Use:   "explain [FIELD]",
+		Short: "Describe where report fields come from, why they are collected and what they can tell",
+		Args:  maximumNArgs(tr, 1),
+		Run: func(cmd *cobra.Command, args []string) {
+			field := ""
+			if len(args) == 1 {
+				field = args[0]
+			}
+			infos, err := sysmetrics.Explain(field)
+			if err != nil {
+				log.Errorf(utils.ErrFormat, err)
+				os.Exit(1)
+			}
+			printFieldInfos(os.Stdout, tr, infos)
+		},
+	}
+	rootCmd.AddCommand(explain)
+
+	diff := &cobra.Command{
+		Use:   "diff",
+		Short: "Collect metrics and show what changed since the last sent report",
+		Args:  noArgs(tr),
+		Run: func(cmd *cobra.Command, args []string) {
+			if flagFormat != "text" && flagFormat != "json" {
+				log.Errorf(tr.Get("unsupported format %q: only text and json are supported"), flagFormat)
+				os.Exit(1)
+			}
+			changes, err := sysmetrics.Diff(flagAgainst, sendOptions()...)
+			if err != nil {
+				log.Errorf(utils.ErrFormat, err)
+				os.Exit(1)
+			}
+			if err := printChanges(os.Stdout, tr, changes, flagFormat); err != nil {
+				log.Errorf(utils.ErrFormat, err)
+				os.Exit(1)
+			}
+		},
+	}
+	diff.Flags().StringVar(&flagAgainst, "against", "", "report file or release to compare to instead of the last sent report")
+	diff.Flags().StringVar(&flagFormat, "format", "text", "output format: text or json")
+	rootCmd.AddCommand(diff)
+
 	send := &cobra.Command{
 		Use:   "send yes|no",
 		Short: "Send or opt-out directly from metric reports without interactions",
@@ -84,13 +233,17 @@ func generateRootCmd() *cobra.Command {
 		// we want exactly one arg by in ValidArgs list or upgrade internal command
 		Args: func(cmd *cobra.Command, args []string) error {
 			if len(args) != 1 || !stringInSlice(args[0], append(cmd.ValidArgs, "upgrade")) {
-				return fmt.Errorf("Only accept one argument: yes or no, received '%s'", strings.Join(args, " "))
+				return fmt.Errorf(tr.Get("Only accept one argument: yes or no, received '%s'"), strings.Join(args, " "))
 			}
 			return nil
 		},
 		ValidArgs: []string{"yes", "no"},
 
 		Run: func(cmd *cobra.Command, args []string) {
+			if flagEdit && args[0] != "yes" {
+				log.Error(tr.Get("only reports with metrics can be edited"))
+				os.Exit(1)
+			}
 			var r sysmetrics.ReportType
 			switch args[0] {
 			case "yes":
@@ -98,32 +251,273 @@ func generateRootCmd() *cobra.Command {
 			case "no":
 				r = sysmetrics.ReportOptOut
 			case "upgrade":
-				if err := sysmetrics.CollectAndSendOnUpgrade(flagForce, flagServerURL); err != nil {
+				if flagToFile != "" {
+					log.Error(tr.Get("upgrade reports can't be exported to a file"))
+					os.Exit(1)
+				}
+				if err := sysmetrics.CollectAndSendOnUpgrade(flagForce, serverURL(cmd), sendOptions()...); err != nil {
 					// log a warning, but don't error out as this is an automated upgrade call
 					log.Warningf(utils.ErrFormat, err)
 				}
 				return
 			default:
-				log.Error("Invalid arg")
+				log.Error(tr.Get("Invalid arg"))
 				os.Exit(1)
 			}
 
-			if err := sysmetrics.CollectAndSend(r, flagForce, flagServerURL); err != nil {
+			opts := sendOptions()
+			if flagToFile != "" {
+				opts = append(opts, sysmetrics.WithBundleFile(flagToFile))
+			}
+			if flagEdit {
+				opts = append(opts, sysmetrics.WithEdit())
+			}
+			if err := sysmetrics.CollectAndSend(r, flagForce, serverURL(cmd), opts...); err != nil {
 				log.Errorf(utils.ErrFormat, err)
 				os.Exit(1)
 			}
 		},
 	}
 	send.Flags().StringVarP(&flagServerURL, "url", "u", sender.BaseURL, "server url to send report to. Leave empty for default.")
+	send.Flags().BoolVar(&flagEdit, "edit", false, "open the report in $EDITOR before sending it. Fields can only be removed or set to null")
+	send.Flags().BoolVar(&flagDryRun, "dry-run", false, "print the requests reports would be sent with instead of sending them, without changing any local state")
+	send.Flags().StringVar(&flagToFile, "to-file", "", "export the report to this bundle file instead of sending it, to upload it later from another machine")
 	rootCmd.AddCommand(send)
 
+	upload := &cobra.Command{
+		Use:   "upload BUNDLE...",
+		Short: "Send reports exported with send --to-file and write a receipt next to each of them",
+		Args:  minimumNArgs(tr, 1),
+		Run: func(cmd *cobra.Command, args []string) {
+			receipts, err := sysmetrics.UploadBundles(args, serverURL(cmd), sendOptions()...)
+			for _, r := range receipts {
+				fmt.Println(r)
+			}
+			if err != nil {
+				log.Errorf(utils.ErrFormat, err)
+				os.Exit(1)
+			}
+		},
+	}
+	upload.Flags().StringVarP(&flagServerURL, "url", "u", sender.BaseURL, "server url to send reports to. Leave empty for default.")
+	rootCmd.AddCommand(upload)
+
+	importReceipt := &cobra.Command{
+		Use:   "import-receipt RECEIPT...",
+		Short: "Mark reports exported from this machine as reported, from receipts written by upload",
+		Args:  minimumNArgs(tr, 1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := sysmetrics.ImportReceipts(args); err != nil {
+				log.Errorf(utils.ErrFormat, err)
+				os.Exit(1)
+			}
+		},
+	}
+	rootCmd.AddCommand(importReceipt)
+
+	consent := &cobra.Command{
+		Use:   "consent show|grant|revoke",
+		Short: "Show or change your decision about reporting metrics",
+		Long: `Show or change your decision about reporting metrics.` + "\n" +
+			`grant sends a report for the current release and revoke an opt-out message, ` +
+			`replacing what was sent previously.`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 || !stringInSlice(args[0], cmd.ValidArgs) {
+				return fmt.Errorf(tr.Get("Only accept one argument: show, grant or revoke, received '%s'"), strings.Join(args, " "))
+			}
+			return nil
+		},
+		ValidArgs: []string{"show", "grant", "revoke"},
+		Run: func(cmd *cobra.Command, args []string) {
+			var err error
+			switch args[0] {
+			case "show":
+				var c sysmetrics.Consent
+				if c, err = sysmetrics.GetConsent(serverURL(cmd), sendOptions()...); err == nil {
+					printConsent(os.Stdout, tr, c)
+				}
+			case "grant":
+				err = sysmetrics.GrantConsent(serverURL(cmd), sendOptions()...)
+			case "revoke":
+				err = sysmetrics.RevokeConsent(serverURL(cmd), sendOptions()...)
+			}
+			if err != nil {
+				log.Errorf(utils.ErrFormat, err)
+				os.Exit(1)
+			}
+		},
+	}
+	consent.Flags().StringVarP(&flagServerURL, "url", "u", sender.BaseURL, "server url to send report to. Leave empty for default.")
+	rootCmd.AddCommand(consent)
+
+	status := &cobra.Command{
+		Use:   "status",
+		Short: "Show what was reported for this release, pending reports and what is in use to report",
+		Args:  noArgs(tr),
+		Run: func(cmd *cobra.Command, args []string) {
+			s, err := sysmetrics.Status(serverURL(cmd), sendOptions()...)
+			if err != nil {
+				log.Errorf(utils.ErrFormat, err)
+				os.Exit(1)
+			}
+			if !flagJSON {
+				printStatus(os.Stdout, tr, s)
+				return
+			}
+			b, err := json.MarshalIndent(s, "", "  ")
+			if err != nil {
+				log.Errorf(utils.ErrFormat, err)
+				os.Exit(1)
+			}
+			fmt.Println(string(b))
+		},
+	}
+	status.Flags().BoolVar(&flagJSON, "json", false, "print status as json")
+	status.Flags().StringVarP(&flagServerURL, "url", "u", sender.BaseURL, "server url to show the status for. Leave empty for default.")
+	rootCmd.AddCommand(status)
+
+	doctor := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check what reporting relies on and how to fix what prevents it",
+		Long: `Check what reporting relies on and how to fix what prevents it:
+os-release, the commands metrics are collected from, collecting each section of the report,
+the state directory, the configuration and the servers reports are sent to. Nothing is sent.
+Exits with an error if any check prevents reporting.`,
+		Args: noArgs(tr),
+		Run: func(cmd *cobra.Command, args []string) {
+			findings, err := sysmetrics.Doctor(serverURL(cmd), sendOptions()...)
+			if err != nil {
+				log.Errorf(utils.ErrFormat, err)
+				os.Exit(1)
+			}
+			if flagJSON {
+				b, err := json.MarshalIndent(findings, "", "  ")
+				if err != nil {
+					log.Errorf(utils.ErrFormat, err)
+					os.Exit(1)
+				}
+				fmt.Println(string(b))
+			} else {
+				printFindings(os.Stdout, findings)
+			}
+			for _, f := range findings {
+				if f.Status == sysmetrics.FindingError {
+					os.Exit(1)
+				}
+			}
+		},
+	}
+	doctor.Flags().BoolVar(&flagJSON, "json", false, "print findings as json")
+	doctor.Flags().StringVarP(&flagServerURL, "url", "u", sender.BaseURL, "server url to check. Leave empty for default.")
+	rootCmd.AddCommand(doctor)
+
+	forget := &cobra.Command{
+		Use:   "forget",
+		Short: "Ask the server to delete your reports and stop reporting",
+		Long: `Ask the server to delete the report of the current release, of a given release or all your reports. ` +
+			`They are then replaced locally by an opt-out message and your decision is recorded as denied.`,
+		Args: noArgs(tr),
+		Run: func(cmd *cobra.Command, args []string) {
+			if flagAll && flagRelease != "" {
+				log.Error(tr.Get("--release and --all can't be used together"))
+				os.Exit(1)
+			}
+			opts := append(sendOptions(), sysmetrics.WithPrivilegedHelper())
+			if err := sysmetrics.Forget(flagRelease, flagAll, serverURL(cmd), opts...); err != nil {
+				log.Errorf(utils.ErrFormat, err)
+				os.Exit(1)
+			}
+		},
+	}
+	forget.Flags().StringVar(&flagRelease, "release", "", "release whose report to delete instead of the current one")
+	forget.Flags().BoolVar(&flagAll, "all", false, "delete the reports of all releases")
+	forget.Flags().StringVarP(&flagServerURL, "url", "u", sender.BaseURL, "server url to request deletion to. Leave empty for default.")
+	rootCmd.AddCommand(forget)
+
+	history := &cobra.Command{
+		Use:   "history",
+		Short: "List every attempt to send a report, and to which server",
+		Args:  noArgs(tr),
+		Run: func(cmd *cobra.Command, args []string) {
+			ts, err := sysmetrics.History()
+			if err != nil {
+				log.Errorf(utils.ErrFormat, err)
+				os.Exit(1)
+			}
+			printHistory(os.Stdout, tr, ts)
+		},
+	}
+	historyShow := &cobra.Command{
+		Use:   "show ID",
+		Short: "Print the exact payload delivered by a transmission listed in history",
+		Args:  exactArgs(tr, 1),
+		Run: func(cmd *cobra.Command, args []string) {
+			id, err := strconv.Atoi(args[0])
+			if err != nil {
+				log.Errorf(tr.Get("invalid transmission ID %q"), args[0])
+				os.Exit(1)
+			}
+			ts, err := sysmetrics.History()
+			if err != nil {
+				log.Errorf(utils.ErrFormat, err)
+				os.Exit(1)
+			}
+			for _, t := range ts {
+				if t.ID != id {
+					continue
+				}
+				if t.Kind == sysmetrics.KindDeletion {
+					log.Errorf(tr.Get("transmission %d is a deletion request, it has no payload"), id)
+					os.Exit(1)
+				}
+				if t.Result != sysmetrics.TransmissionDelivered {
+					log.Errorf(tr.Get("transmission %d wasn't delivered, its payload isn't kept"), id)
+					os.Exit(1)
+				}
+				if t.Payload == "" {
+					log.Errorf(tr.Get("transmission %d is too old, its payload isn't kept anymore"), id)
+					os.Exit(1)
+				}
+				fmt.Println(t.Payload)
+				return
+			}
+			log.Errorf(tr.Get("no transmission %d in history"), id)
+			os.Exit(1)
+		},
+	}
+	history.AddCommand(historyShow)
+	rootCmd.AddCommand(history)
+
+	machineRecord := &cobra.Command{
+		Use:    "machine-record DISTRO VERSION",
+		Short:  "Record the report read on stdin for all users of this machine. Needs to run as root.",
+		Args:   exactArgs(tr, 2),
+		Hidden: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			if os.Geteuid() != 0 {
+				log.Error(tr.Get("recording a report machine-wide needs to run as root"))
+				os.Exit(1)
+			}
+			data, err := ioutil.ReadAll(io.LimitReader(os.Stdin, maxReportSize))
+			if err != nil {
+				log.Errorf(utils.ErrFormat, err)
+				os.Exit(1)
+			}
+			if err := sysmetrics.RecordMachineReport(args[0], args[1], data); err != nil {
+				log.Errorf(utils.ErrFormat, err)
+				os.Exit(1)
+			}
+		},
+	}
+	rootCmd.AddCommand(machineRecord)
+
 	service := &cobra.Command{
 		Use:    "service",
 		Short:  "Try to send periodically previously unsent but collected data once network is available",
-		Args:   cobra.NoArgs,
+		Args:   noArgs(tr),
 		Hidden: true,
 		Run: func(cmd *cobra.Command, args []string) {
-			err := sysmetrics.SendPendingReport(flagServerURL)
+			err := sysmetrics.SendPendingReport(serverURL(cmd), sendOptions()...)
 			if err != nil {
 				log.Errorf(utils.ErrFormat, err)
 				os.Exit(1)
@@ -131,6 +525,7 @@ func generateRootCmd() *cobra.Command {
 		},
 	}
 	service.Flags().StringVarP(&flagServerURL, "url", "u", sender.BaseURL, "server url to send report to. Leave empty for default.")
+	service.Flags().BoolVar(&flagDryRun, "dry-run", false, "print the requests reports would be sent with instead of sending them, without changing any local state")
 	rootCmd.AddCommand(service)
 
 	interactiveCmd := &cobra.Command{
@@ -139,11 +534,217 @@ func generateRootCmd() *cobra.Command {
 		Run:   rootCmd.Run,
 	}
 	interactiveCmd.Flags().StringVarP(&flagServerURL, "url", "u", sender.BaseURL, "server url to send report to. Leave empty for default.")
+	interactiveCmd.Flags().BoolVar(&flagDryRun, "dry-run", false, "print the requests reports would be sent with instead of sending them, without changing any local state")
+	interactiveCmd.Flags().BoolVar(&flagTUI, "tui", false, "choose which sections of the report to send in a full-screen terminal interface")
+	interactiveCmd.Flags().DurationVar(&flagAnswerTimeout, "answer-timeout", 0, "quit without sending anything if not answered within this duration, like 5m")
 	rootCmd.AddCommand(interactiveCmd)
 
 	return rootCmd
 }
 
+// printFieldInfos displays the description of fields to w, with labels translated by tr
+func printFieldInfos(w io.Writer, tr *i18n.Catalog, infos []sysmetrics.FieldInfo) {
+	for i, f := range infos {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintln(w, f.Field)
+		fmt.Fprintf(w, "  "+tr.Get("Source: %s")+"\n", f.Source)
+		fmt.Fprintf(w, "  "+tr.Get("Purpose: %s")+"\n", f.Purpose)
+		if f.Precision != "" {
+			fmt.Fprintf(w, "  "+tr.Get("Precision: %s")+"\n", f.Precision)
+		}
+		fmt.Fprintf(w, "  "+tr.Get("Privacy: %s")+"\n", f.Privacy)
+	}
+}
+
+// printFindings displays the result of doctor checks to w, with advice on failed ones
+func printFindings(w io.Writer, findings []sysmetrics.Finding) {
+	for _, f := range findings {
+		fmt.Fprintf(w, "%-9s %s: %s\n", "["+string(f.Status)+"]", f.Check, f.Detail)
+		if f.Advice != "" {
+			fmt.Fprintf(w, "%-9s %s\n", "", f.Advice)
+		}
+	}
+}
+
+// printDiagnostics displays how each section of the report was collected to w, with labels translated by tr
+func printDiagnostics(w io.Writer, tr *i18n.Catalog, diags []sysmetrics.Diagnostic) {
+	fmt.Fprintln(w, tr.Get("Diagnostics:"))
+	for _, d := range diags {
+		fmt.Fprintf(w, "  %-11s %-8s %8s", d.Section, d.Status, d.Duration.Round(time.Microsecond))
+		if d.Reason != "" {
+			fmt.Fprintf(w, "  %s", d.Reason)
+		}
+		if d.ExitCode != nil {
+			fmt.Fprintf(w, " "+tr.Get("(exit code %d)"), *d.ExitCode)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// printChanges displays changes to w in format, text or json, with messages translated by tr
+func printChanges(w io.Writer, tr *i18n.Catalog, changes []sysmetrics.Change, format string) error {
+	if format == "json" {
+		if changes == nil {
+			changes = []sysmetrics.Change{}
+		}
+		b, err := json.MarshalIndent(changes, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(b))
+		return err
+	}
+
+	if len(changes) == 0 {
+		fmt.Fprintln(w, tr.Get("Nothing changed since the last report"))
+		return nil
+	}
+	for _, c := range changes {
+		before, err := json.Marshal(c.Old)
+		if err != nil {
+			return err
+		}
+		after, err := json.Marshal(c.New)
+		if err != nil {
+			return err
+		}
+		switch c.Kind {
+		case sysmetrics.FieldAdded:
+			fmt.Fprintf(w, "+ %s: %s\n", c.Field, after)
+		case sysmetrics.FieldRemoved:
+			fmt.Fprintf(w, "- %s: %s\n", c.Field, before)
+		default:
+			fmt.Fprintf(w, "~ %s: %s -> %s\n", c.Field, before, after)
+		}
+	}
+	return nil
+}
+
+// printHistory displays the list of transmissions ts to w, with labels translated by tr
+func printHistory(w io.Writer, tr *i18n.Catalog, ts []sysmetrics.Transmission) {
+	if len(ts) == 0 {
+		fmt.Fprintln(w, tr.Get("No report was sent yet"))
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join([]string{tr.Get("ID"), tr.Get("DATE"), tr.Get("KIND"), tr.Get("RESULT"), tr.Get("HTTP STATUS"), tr.Get("URL")}, "\t"))
+	for _, t := range ts {
+		status := "-"
+		if t.HTTPStatus != 0 {
+			status = strconv.Itoa(t.HTTPStatus)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n", t.ID, t.Time.Local().Format("2006-01-02 15:04:05"), t.Kind, t.Result, status, t.URL)
+	}
+	tw.Flush()
+}
+
+// printStatus displays s to w, with labels translated by tr
+func printStatus(w io.Writer, tr *i18n.Catalog, s sysmetrics.ReportingStatus) {
+	fmt.Fprintf(w, tr.Get("Release: %s %s")+"\n", s.Distro, s.Version)
+	fmt.Fprintf(w, tr.Get("Variant: %s")+"\n", s.Variant)
+	switch s.Reported {
+	case sysmetrics.ConsentGranted:
+		fmt.Fprintf(w, tr.Get("Reported: yes, metrics were sent (%s)")+"\n", s.ReportPath)
+	case sysmetrics.ConsentDenied:
+		fmt.Fprintf(w, tr.Get("Reported: yes, an opt-out message was sent (%s)")+"\n", s.ReportPath)
+	default:
+		fmt.Fprintln(w, tr.Get("Reported: no"))
+	}
+	if s.Consent.Decision == sysmetrics.ConsentUnknown {
+		fmt.Fprintln(w, tr.Get("Consent: not taken yet"))
+	} else {
+		fmt.Fprintf(w, tr.Get("Consent: %s by %s on %s")+"\n", s.Consent.Decision, s.Consent.Source, s.Consent.Time.Local().Format("2006-01-02 15:04:05 MST"))
+	}
+	if s.ConsentOutdated {
+		fmt.Fprintln(w, tr.Get("The privacy policy changed since this decision: you will be asked again."))
+	}
+	for _, p := range s.Pending {
+		fmt.Fprintf(w, tr.Get("Pending report for %s: saved on %s, %d failed attempts"), p.URL, p.SavedAt.Local().Format("2006-01-02 15:04:05 MST"), p.FailedAttempts)
+		if p.LastError != "" {
+			fmt.Fprintf(w, tr.Get(", last one on %s: %s"), p.LastAttempt.Local().Format("2006-01-02 15:04:05 MST"), p.LastError)
+		}
+		fmt.Fprintln(w)
+	}
+	if len(s.Pending) == 0 {
+		fmt.Fprintln(w, tr.Get("Pending reports: none"))
+	}
+	fmt.Fprintf(w, tr.Get("Server: %s")+"\n", s.ServerURL)
+	fmt.Fprintf(w, tr.Get("Scope: %s")+"\n", s.Scope)
+	if len(s.ConfigSources) == 0 {
+		fmt.Fprintln(w, tr.Get("Configuration: defaults"))
+	} else {
+		fmt.Fprintf(w, tr.Get("Configuration: %s")+"\n", strings.Join(s.ConfigSources, ", "))
+	}
+	if s.Blocked != "" {
+		fmt.Fprintf(w, tr.Get("Blocked: %s")+"\n", s.Blocked)
+	}
+	if s.DestinationError != "" {
+		fmt.Fprintf(w, tr.Get("Misconfigured: %s")+"\n", s.DestinationError)
+	}
+}
+
+// printConsent displays c to w, with labels translated by tr
+func printConsent(w io.Writer, tr *i18n.Catalog, c sysmetrics.Consent) {
+	if c.Decision == sysmetrics.ConsentUnknown {
+		fmt.Fprintln(w, tr.Get("Decision: not taken yet"))
+		return
+	}
+	fmt.Fprintf(w, tr.Get("Decision: %s")+"\n", c.Decision)
+	fmt.Fprintf(w, tr.Get("Date: %s")+"\n", c.Time.Local().Format("2006-01-02 15:04:05 MST"))
+	fmt.Fprintf(w, tr.Get("Source: %s")+"\n", c.Source)
+	if c.PolicyVersion != "" {
+		fmt.Fprintf(w, tr.Get("Privacy policy version: %s")+"\n", c.PolicyVersion)
+	}
+	if len(c.ExcludedSections) > 0 {
+		fmt.Fprintf(w, tr.Get("Excluded sections: %s")+"\n", strings.Join(c.ExcludedSections, ", "))
+	}
+	if c.Outdated {
+		fmt.Fprintln(w, tr.Get("The privacy policy changed since this decision: you will be asked again."))
+	}
+}
+
+// noArgs is cobra.NoArgs, with its error translated by tr
+func noArgs(tr *i18n.Catalog) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		if len(args) > 0 {
+			return fmt.Errorf(tr.Get("unknown command %q for %q"), args[0], cmd.CommandPath())
+		}
+		return nil
+	}
+}
+
+// maximumNArgs is cobra.MaximumNArgs, with its error translated by tr
+func maximumNArgs(tr *i18n.Catalog, n int) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		if len(args) > n {
+			return fmt.Errorf(tr.Get("accepts at most %d arg(s), received %d"), n, len(args))
+		}
+		return nil
+	}
+}
+
+// minimumNArgs is cobra.MinimumNArgs, with its error translated by tr
+func minimumNArgs(tr *i18n.Catalog, n int) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		if len(args) < n {
+			return fmt.Errorf(tr.Get("requires at least %d arg(s), only received %d"), n, len(args))
+		}
+		return nil
+	}
+}
+
+// exactArgs is cobra.ExactArgs, with its error translated by tr
+func exactArgs(tr *i18n.Catalog, n int) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		if len(args) != n {
+			return fmt.Errorf(tr.Get("accepts %d arg(s), received %d"), n, len(args))
+		}
+		return nil
+	}
+}
+
 func stringInSlice(a string, list []string) bool {
 	for _, b := range list {
 		if b == a {
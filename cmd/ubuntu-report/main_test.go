@@ -15,6 +15,9 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/ubuntu/ubuntu-report/internal/helper"
+	"github.com/ubuntu/ubuntu-report/internal/i18n"
+	"github.com/ubuntu/ubuntu-report/internal/utils"
+	"github.com/ubuntu/ubuntu-report/pkg/sysmetrics"
 )
 
 const (
@@ -144,6 +147,7 @@ func TestSend(t *testing.T) {
 			out, tearDown := helper.TempDir(t)
 			defer tearDown()
 			defer helper.ChangeEnv("XDG_CACHE_HOME", out)()
+			defer helper.ChangeEnv("XDG_STATE_HOME", out)()
 			out = filepath.Join(out, "ubuntu-report")
 			// create a previous report with fake json data (which isn't optout)
 			if err := os.MkdirAll(out, 0700); err != nil {
@@ -163,7 +167,7 @@ func TestSend(t *testing.T) {
 			defer ts.Close()
 
 			cmd := generateRootCmd()
-			args := []string{"send", tc.answer, "--url", ts.URL}
+			args := []string{"send", tc.answer, "--url", ts.URL, "--insecure"}
 			cmd.SetArgs(args)
 
 			cmdErrs := helper.RunFunctionWithTimeout(t, func() error {
@@ -184,6 +188,10 @@ func TestSend(t *testing.T) {
 				t.Fatalf("couldn't scan %s: %v", out, err)
 			}
 			for _, f := range files {
+				// only consider reports, named distro.version, not their checksums or other state files
+				if utils.IsChecksumFile(f.Name()) || !strings.Contains(f.Name(), ".") {
+					continue
+				}
 				if f.Name() > reportP {
 					reportP = f.Name()
 				}
@@ -247,6 +255,7 @@ func TestInteractive(t *testing.T) {
 			out, tearDown := helper.TempDir(t)
 			defer tearDown()
 			defer helper.ChangeEnv("XDG_CACHE_HOME", out)()
+			defer helper.ChangeEnv("XDG_STATE_HOME", out)()
 			out = filepath.Join(out, "ubuntu-report")
 			// we don't really care where we hit for this API integration test, internal ones test it
 			// and we don't really control /etc/os-release version and id.
@@ -267,7 +276,7 @@ func TestInteractive(t *testing.T) {
 			if tc.cmd != "" {
 				args = append(args, tc.cmd)
 			}
-			args = append(args, "--url", ts.URL)
+			args = append(args, "--url", ts.URL, "--insecure")
 			cmd.SetArgs(args)
 
 			cmdErrs := helper.RunFunctionWithTimeout(t, func() error {
@@ -318,7 +327,7 @@ func TestInteractive(t *testing.T) {
 				return
 			}
 
-			p := filepath.Join(out, helper.FindInDirectory(t, "", out))
+			p := filepath.Join(out, helper.FindReportInDirectory(t, out))
 			data, err := ioutil.ReadFile(p)
 			if err != nil {
 				t.Fatalf("couldn't open report file %s", out)
@@ -339,11 +348,13 @@ func TestService(t *testing.T) {
 	helper.SkipIfShort(t)
 
 	testCases := []struct {
-		name string
+		name   string
+		dryRun bool
 
 		shouldHitServer bool
 	}{
-		{"regular send", true},
+		{"regular send", false, true},
+		{"dry run", true, false},
 	}
 	for _, tc := range testCases {
 		tc := tc // capture range variable for parallel execution
@@ -353,6 +364,7 @@ func TestService(t *testing.T) {
 			out, tearDown := helper.TempDir(t)
 			defer tearDown()
 			defer helper.ChangeEnv("XDG_CACHE_HOME", out)()
+			defer helper.ChangeEnv("XDG_STATE_HOME", out)()
 			out = filepath.Join(out, "ubuntu-report")
 
 			pendingReportData, err := ioutil.ReadFile(filepath.Join("testdata", "good", "ubuntu-report", "pending"))
@@ -377,7 +389,10 @@ func TestService(t *testing.T) {
 			defer ts.Close()
 
 			cmd := generateRootCmd()
-			args := []string{"service", "--url", ts.URL}
+			args := []string{"service", "--url", ts.URL, "--insecure"}
+			if tc.dryRun {
+				args = append(args, "--dry-run")
+			}
 			cmd.SetArgs(args)
 
 			cmdErrs := helper.RunFunctionWithTimeout(t, func() error {
@@ -392,11 +407,17 @@ func TestService(t *testing.T) {
 
 			a.Equal(serverHit, tc.shouldHitServer)
 
+			if tc.dryRun {
+				if _, err := os.Stat(pendingReportPath); err != nil {
+					t.Errorf("we expected the pending report to be kept on dry run: %v", err)
+				}
+				return
+			}
 			if _, pendingReportErr := os.Stat(pendingReportPath); os.IsExist(pendingReportErr) {
 				t.Errorf("we expected the pending report to be removed and it wasn't")
 			}
 
-			p := filepath.Join(out, helper.FindInDirectory(t, "", out))
+			p := filepath.Join(out, helper.FindReportInDirectory(t, out))
 			got, err := ioutil.ReadFile(p)
 			if err != nil {
 				t.Fatalf("couldn't open report file %s", out)
@@ -434,3 +455,59 @@ func dropCR(data []byte) []byte {
 	}
 	return data
 }
+
+func TestPrintTranslated(t *testing.T) {
+	t.Parallel()
+
+	root, tearDown := helper.TempDir(t)
+	defer tearDown()
+	helper.WriteMO(t, filepath.Join(root, "usr/share/locale/fr/LC_MESSAGES", i18n.Domain+".mo"), map[string]string{
+		"Release: %s %s":                 "Version : %s %s",
+		"Decision: not taken yet":        "Décision : pas encore prise",
+		"No report was sent yet":         "Aucun rapport n'a encore été envoyé",
+		"accepts %d arg(s), received %d": "accepte %d argument(s), %d reçu(s)",
+	})
+	tr := i18n.Load(root, "fr_FR")
+
+	testCases := []struct {
+		name  string
+		print func(w io.Writer) error
+
+		want    string
+		wantErr string
+	}{
+		{"status", func(w io.Writer) error {
+			printStatus(w, tr, sysmetrics.ReportingStatus{Distro: "ubuntu", Version: "18.04"})
+			return nil
+		}, "Version : ubuntu 18.04\n", ""},
+		{"consent", func(w io.Writer) error {
+			printConsent(w, tr, sysmetrics.Consent{})
+			return nil
+		}, "Décision : pas encore prise\n", ""},
+		{"history", func(w io.Writer) error {
+			printHistory(w, tr, nil)
+			return nil
+		}, "Aucun rapport n'a encore été envoyé\n", ""},
+		{"arguments", func(w io.Writer) error {
+			return exactArgs(tr, 1)(&cobra.Command{}, nil)
+		}, "", "accepte 1 argument(s), 0 reçu(s)"},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			out := &bytes.Buffer{}
+			err := tc.print(out)
+
+			a.CheckWantedErr(err, tc.wantErr != "")
+			if err != nil {
+				a.Equal(err.Error(), tc.wantErr)
+			}
+			if !strings.HasPrefix(out.String(), tc.want) {
+				t.Errorf("expected output to start with %q, got: %q", tc.want, out.String())
+			}
+		})
+	}
+}
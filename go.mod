@@ -4,6 +4,7 @@ require (
 	github.com/pkg/errors v0.8.1
 	github.com/sirupsen/logrus v1.8.2-0.20210422133436-b50299cfaaa1
 	github.com/spf13/cobra v0.0.3
+	gopkg.in/yaml.v2 v2.2.2
 )
 
 require (
@@ -12,7 +13,6 @@ require (
 	github.com/russross/blackfriday v1.5.2 // indirect
 	github.com/spf13/pflag v1.0.3 // indirect
 	golang.org/x/sys v0.0.0-20210218155724-8ebf48af031b // indirect
-	gopkg.in/yaml.v2 v2.2.2 // indirect
 )
 
 go 1.23
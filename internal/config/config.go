@@ -0,0 +1,135 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/ubuntu/ubuntu-report/internal/metrics"
+	"github.com/ubuntu/ubuntu-report/internal/utils"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// SystemPath is the machine-wide configuration file, set by administrators
+const SystemPath = "/etc/ubuntu-report/config.yaml"
+
+const (
+	// ScopeUser reports once per user: every user of a machine is asked for a report. This is the default.
+	ScopeUser = "user"
+	// ScopeMachine reports once per machine, whichever user consents first
+	ScopeMachine = "machine"
+)
+
+// Config of ubuntu-report, merged from system and user configuration files
+type Config struct {
+	// URL of the server to send reports to
+	URL string `yaml:"url"`
+	TLS TLS    `yaml:"tls"`
+	// Destinations receive a copy of every report sent to the main server
+	Destinations []Destination `yaml:"destinations"`
+	// LockTimeout is how long to wait for other ubuntu-report instances acting on reports
+	LockTimeout time.Duration `yaml:"lock-timeout"`
+	// Scope is ScopeUser or ScopeMachine. Only administrators can set it, in the system configuration.
+	Scope string `yaml:"scope"`
+	// Variant is the product variant reports are sent for, instead of the detected one
+	Variant string `yaml:"variant"`
+	// Derivatives map os-release IDs, or ID_LIKE entries, to the distribution reports are sent for
+	Derivatives map[string]string `yaml:"derivatives"`
+}
+
+// Destination is an additional server reports are sent to
+type Destination struct {
+	URL string `yaml:"url"`
+	TLS TLS    `yaml:"tls"`
+	// Required destinations make the report fail if they can't be reached
+	Required bool `yaml:"required"`
+}
+
+// TLS settings to connect to the metrics server
+type TLS struct {
+	CAFile     string   `yaml:"ca-file"`
+	CertFile   string   `yaml:"cert-file"`
+	KeyFile    string   `yaml:"key-file"`
+	PinnedSPKI []string `yaml:"pinned-spki"`
+	Insecure   bool     `yaml:"insecure"`
+}
+
+// Load merges system-wide and user configuration, the latter taking precedence.
+// It returns the configuration and the files it was built from.
+func Load() (Config, []string, error) {
+	p, err := utils.UserConfigPath()
+	if err != nil {
+		log.Infof("couldn't get user configuration path: "+utils.ErrFormat, err)
+	}
+	return load(SystemPath, p)
+}
+
+// load merges system and user configuration files. user is skipped if empty.
+func load(system, user string) (Config, []string, error) {
+	paths := []string{system}
+	if user != "" {
+		paths = append(paths, user)
+	}
+	c, sources, err := LoadFrom(paths...)
+	if err != nil {
+		return c, sources, err
+	}
+
+	// users can't opt out of a machine-wide choice
+	sys, _, err := LoadFrom(system)
+	if err != nil {
+		return Config{}, nil, err
+	}
+	if c.Scope != sys.Scope {
+		log.Infof("ignoring reporting scope set in %s: only the system configuration can set it", user)
+		c.Scope = sys.Scope
+	}
+	return c, sources, nil
+}
+
+// LoadFrom merges configuration files in order, each one overriding keys set by the previous ones.
+// Missing files are skipped.
+func LoadFrom(paths ...string) (Config, []string, error) {
+	var c Config
+	var sources []string
+	for _, p := range paths {
+		b, err := ioutil.ReadFile(p)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return Config{}, nil, errors.Wrapf(err, "couldn't read configuration file")
+		}
+		// mappings are merged per key: strict unmarshalling refuses keys already set in a map
+		derivatives := c.Derivatives
+		c.Derivatives = nil
+		if err := yaml.UnmarshalStrict(b, &c); err != nil {
+			return Config{}, nil, errors.Wrapf(err, "invalid configuration file %s", p)
+		}
+		for id, distro := range derivatives {
+			if _, ok := c.Derivatives[id]; !ok {
+				if c.Derivatives == nil {
+					c.Derivatives = make(map[string]string)
+				}
+				c.Derivatives[id] = distro
+			}
+		}
+		if c.Scope != "" && c.Scope != ScopeUser && c.Scope != ScopeMachine {
+			return Config{}, nil, errors.Errorf("invalid configuration file %s: scope should be %q or %q, got %q", p, ScopeUser, ScopeMachine, c.Scope)
+		}
+		if c.Variant != "" {
+			if err := metrics.CheckVariant(c.Variant); err != nil {
+				return Config{}, nil, errors.Wrapf(err, "invalid configuration file %s", p)
+			}
+		}
+		for id, distro := range c.Derivatives {
+			if id == "" || distro == "" {
+				return Config{}, nil, errors.Errorf("invalid configuration file %s: derivative %q should be mapped to a distribution, got %q", p, id, distro)
+			}
+		}
+		log.Debugf("loaded configuration from %s", p)
+		sources = append(sources, p)
+	}
+	return c, sources, nil
+}
@@ -0,0 +1,101 @@
+package config_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ubuntu/ubuntu-report/internal/config"
+	"github.com/ubuntu/ubuntu-report/internal/helper"
+)
+
+func TestLoadFrom(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name  string
+		files []string
+
+		want        config.Config
+		wantSources []string
+		wantErr     bool
+	}{
+		{"no configuration", []string{"doesnotexist"}, config.Config{}, nil, false},
+		{"system only", []string{"system"},
+			config.Config{URL: "https://relay.example.com",
+				TLS: config.TLS{CAFile: "/etc/ssl/relay-ca.pem", PinnedSPKI: []string{"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="}}},
+			[]string{"system"}, false},
+		{"user merged over system", []string{"system", "doesnotexist", "user"},
+			config.Config{URL: "https://relay.example.com",
+				TLS: config.TLS{CAFile: "/etc/ssl/relay-ca.pem", PinnedSPKI: []string{"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="},
+					CertFile: "/home/user/client.pem", KeyFile: "/home/user/client.key"},
+				Destinations: []config.Destination{{URL: "https://collector.example.com", Required: true, TLS: config.TLS{Insecure: true}}},
+				LockTimeout:  5 * time.Second},
+			[]string{"system", "user"}, false},
+		{"invalid yaml", []string{"system", "invalid"}, config.Config{}, nil, true},
+		{"unknown key", []string{"unknownkey"}, config.Config{}, nil, true},
+		{"variant", []string{"system", "variant"},
+			config.Config{URL: "https://relay.example.com",
+				TLS:     config.TLS{CAFile: "/etc/ssl/relay-ca.pem", PinnedSPKI: []string{"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="}},
+				Variant: "server"},
+			[]string{"system", "variant"}, false},
+		{"invalid scope", []string{"invalidscope"}, config.Config{}, nil, true},
+		{"invalid variant", []string{"invalidvariant"}, config.Config{}, nil, true},
+		{"derivatives merged", []string{"derivatives", "userderivatives"},
+			config.Config{Derivatives: map[string]string{"pop": "ubuntu", "elementary": "ubuntu", "zorin": "zorin"}},
+			[]string{"derivatives", "userderivatives"}, false},
+		{"invalid derivative", []string{"invalidderivative"}, config.Config{}, nil, true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			var paths, wantSources []string
+			for _, f := range tc.files {
+				paths = append(paths, filepath.Join("testdata", f, "config.yaml"))
+			}
+			for _, f := range tc.wantSources {
+				wantSources = append(wantSources, filepath.Join("testdata", f, "config.yaml"))
+			}
+
+			got, sources, err := config.LoadFrom(paths...)
+
+			a.CheckWantedErr(err, tc.wantErr)
+			a.Equal(&got, &tc.want)
+			a.Equal(sources, wantSources)
+		})
+	}
+}
+
+func TestLoadScope(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name   string
+		system string
+		user   string
+
+		want config.Config
+	}{
+		{"default scope", "doesnotexist", "doesnotexist", config.Config{}},
+		{"machine scope set by system", "machinescope", "doesnotexist", config.Config{Scope: config.ScopeMachine}},
+		{"user can't override machine scope", "machinescope", "userscope",
+			config.Config{Scope: config.ScopeMachine, URL: "https://user.example.com"}},
+		{"user can't set scope", "doesnotexist", "userscope", config.Config{URL: "https://user.example.com"}},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			got, _, err := config.LoadSystemAndUser(filepath.Join("testdata", tc.system, "config.yaml"),
+				filepath.Join("testdata", tc.user, "config.yaml"))
+
+			a.CheckWantedErr(err, false)
+			a.Equal(&got, &tc.want)
+		})
+	}
+}
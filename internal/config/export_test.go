@@ -0,0 +1,4 @@
+package config
+
+// LoadSystemAndUser exports load for tests
+var LoadSystemAndUser = load
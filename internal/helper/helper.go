@@ -1,18 +1,26 @@
 package helper
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"reflect"
+	"sort"
 	"strings"
+	"syscall"
 	"testing"
 	"time"
+	"unsafe"
 
 	log "github.com/sirupsen/logrus"
+	"github.com/ubuntu/ubuntu-report/internal/utils"
 )
 
 /*
@@ -239,6 +247,53 @@ func CaptureStdin(t *testing.T) (io.WriteCloser, func()) {
 	return stdinW, func() { os.Stdin = oldStdin }
 }
 
+// CaptureStdinTerminal replaces stdin with a pseudo-terminal, and returns an io.WriteCloser to type into it and
+// teardown. Closing the writer ends input, like typing ctrl-d. The test is skipped if no pseudo-terminal is available.
+func CaptureStdinTerminal(t *testing.T) (io.WriteCloser, func()) {
+	t.Helper()
+
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR, 0)
+	if err != nil {
+		t.Skip("no pseudo-terminal available:", err)
+	}
+	var unlock int32
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, master.Fd(), syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); errno != 0 {
+		master.Close()
+		t.Fatal("couldn't unlock pseudo-terminal:", errno)
+	}
+	var n uint32
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, master.Fd(), syscall.TIOCGPTN, uintptr(unsafe.Pointer(&n))); errno != 0 {
+		master.Close()
+		t.Fatal("couldn't get pseudo-terminal number:", errno)
+	}
+	stdin, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		t.Fatal("couldn't open pseudo-terminal:", err)
+	}
+	// what is typed is echoed back: drain it so that writes never block
+	go io.Copy(ioutil.Discard, master)
+
+	oldStdin := os.Stdin
+	os.Stdin = stdin
+	return terminalInput{master}, func() {
+		os.Stdin = oldStdin
+		stdin.Close()
+		master.Close()
+	}
+}
+
+// terminalInput types into a pseudo-terminal
+type terminalInput struct {
+	*os.File
+}
+
+// Close ends input on the terminal, leaving what was typed before readable
+func (i terminalInput) Close() error {
+	_, err := i.Write([]byte{4})
+	return err
+}
+
 // CaptureLogs returns an io.Reader to read what was logged, and teardown
 func CaptureLogs(t *testing.T) (io.Reader, func()) {
 	t.Helper()
@@ -299,8 +354,9 @@ func ChangeEnv(key, value string) func() {
 	}
 }
 
-// FindInDirectory return first match of prefix in d
-func FindInDirectory(t *testing.T, prefix, d string) string {
+// FindReportInDirectory returns the first report in d. Reports are named distro.version,
+// which sets them apart from their checksums and other state files.
+func FindReportInDirectory(t *testing.T, d string) string {
 	t.Helper()
 
 	files, err := ioutil.ReadDir(d)
@@ -309,10 +365,47 @@ func FindInDirectory(t *testing.T, prefix, d string) string {
 	}
 
 	for _, f := range files {
-		if strings.HasPrefix(f.Name(), prefix) {
-			return f.Name()
+		if utils.IsChecksumFile(f.Name()) || !strings.Contains(f.Name(), ".") {
+			continue
 		}
+		return f.Name()
 	}
-	t.Fatalf("didn't find %s in %s. Only got: %v", prefix, d, files)
+	t.Fatalf("didn't find any report in %s. Only got: %v", d, files)
 	return ""
 }
+
+// WriteMO writes messages, by original message, as a little endian gettext binary catalog at p
+func WriteMO(t *testing.T, p string, messages map[string]string) {
+	t.Helper()
+
+	var origs []string
+	for o := range messages {
+		origs = append(origs, o)
+	}
+	sort.Strings(origs)
+
+	n := uint32(len(origs))
+	header := make([]byte, 28+16*n)
+	binary.LittleEndian.PutUint32(header, 0x950412de)
+	binary.LittleEndian.PutUint32(header[8:], n)
+	binary.LittleEndian.PutUint32(header[12:], 28)
+	binary.LittleEndian.PutUint32(header[16:], 28+8*n)
+	var strs bytes.Buffer
+	offset := uint32(len(header))
+	for i, o := range origs {
+		for table, s := range []string{o, messages[o]} {
+			d := 28 + uint32(table)*8*n + uint32(i)*8
+			binary.LittleEndian.PutUint32(header[d:], uint32(len(s)))
+			binary.LittleEndian.PutUint32(header[d+4:], offset+uint32(strs.Len()))
+			strs.WriteString(s)
+			strs.WriteByte(0)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		t.Fatal("couldn't create catalog directory:", err)
+	}
+	if err := ioutil.WriteFile(p, append(header, strs.Bytes()...), 0644); err != nil {
+		t.Fatal("couldn't write catalog:", err)
+	}
+}
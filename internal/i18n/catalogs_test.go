@@ -0,0 +1,107 @@
+package i18n_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ubuntu/ubuntu-report/internal/helper"
+)
+
+const (
+	// repoRoot is the root of the source tree, from this package
+	repoRoot = "../.."
+	// poDir is where the template and translations of messages are, from the root of the source tree
+	poDir = "po"
+)
+
+var (
+	translatedRe = regexp.MustCompile(`\b(?:tr\.Get|localizedError)\(("(?:[^"\\]|\\.)*")\)`)
+	msgidRe      = regexp.MustCompile(`(?m)^msgid ("(?:[^"\\]|\\.)*")$`)
+)
+
+func TestCatalogsCoverAllMessages(t *testing.T) {
+	t.Parallel()
+
+	want := translatedMessages(t)
+	catalogs, err := filepath.Glob(filepath.Join(repoRoot, poDir, "*.po*"))
+	if err != nil || len(catalogs) == 0 {
+		t.Fatalf("couldn't find any catalog in %s: %v", poDir, err)
+	}
+	for _, p := range catalogs {
+		p := p
+		t.Run(filepath.Base(p), func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			a.Equal(catalogMessages(t, p), want)
+		})
+	}
+}
+
+// translatedMessages returns the sorted messages translated by the source tree, with tr.Get or as localized errors
+func translatedMessages(t *testing.T) []string {
+	t.Helper()
+
+	found := make(map[string]bool)
+	for _, d := range []string{"cmd", "pkg"} {
+		err := filepath.Walk(filepath.Join(repoRoot, d), func(p string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() || !strings.HasSuffix(p, ".go") || strings.HasSuffix(p, "_test.go") {
+				return err
+			}
+			b, err := ioutil.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			for _, m := range translatedRe.FindAllSubmatch(b, -1) {
+				found[unquote(t, string(m[1]))] = true
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal("couldn't walk source tree:", err)
+		}
+	}
+	return sortedKeys(found)
+}
+
+// catalogMessages returns the sorted messages of catalog p, without its header
+func catalogMessages(t *testing.T, p string) []string {
+	t.Helper()
+
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		t.Fatal("couldn't read catalog:", err)
+	}
+	found := make(map[string]bool)
+	for _, m := range msgidRe.FindAllSubmatch(b, -1) {
+		if msg := unquote(t, string(m[1])); msg != "" {
+			found[msg] = true
+		}
+	}
+	return sortedKeys(found)
+}
+
+func unquote(t *testing.T, s string) string {
+	t.Helper()
+
+	u, err := strconv.Unquote(s)
+	if err != nil {
+		t.Fatalf("couldn't unquote %s: %v", s, err)
+	}
+	return u
+}
+
+func sortedKeys(m map[string]bool) []string {
+	var l []string
+	for k := range m {
+		l = append(l, k)
+	}
+	sort.Strings(l)
+	return l
+}
@@ -0,0 +1,133 @@
+// Package i18n translates messages shown to users, from gettext catalogs, and recognizes their
+// answers to yes/no questions in their language.
+package i18n
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/ubuntu/ubuntu-report/internal/utils"
+)
+
+const (
+	// Domain is the gettext domain of ubuntu-report messages
+	Domain = "ubuntu-report"
+	// localeDir is where gettext catalogs are installed, as <language>/LC_MESSAGES/<Domain>.mo
+	localeDir = "usr/share/locale"
+	// localesDir is where locale definitions, with the yes and no answers of each language, are installed
+	localesDir = "usr/share/i18n/locales"
+)
+
+// Language returns the language of the user, like fr_FR, from LC_ALL, LANG then LANGUAGE
+func Language(getenv func(string) string) string {
+	lang := getenv("LC_ALL")
+	if lang == "" {
+		lang = getenv("LANG")
+	}
+	if lang == "" {
+		lang = strings.Split(getenv("LANGUAGE"), ":")[0]
+	}
+	return strings.Split(lang, ".")[0]
+}
+
+// Catalog translates messages to a language
+type Catalog struct {
+	messages map[string]string
+	// yesExpr and noExpr match answers to yes/no questions in the language, if known
+	yesExpr, noExpr *regexp.Regexp
+	yesStr, noStr   string
+}
+
+// Load returns the catalog of lang, found under root. Messages without translation, or all of them if
+// the catalog isn't installed, are kept in English.
+func Load(root, lang string) *Catalog {
+	c := &Catalog{}
+	if lang == "" || lang == "C" || lang == "POSIX" {
+		return c
+	}
+
+	for _, l := range candidates(lang) {
+		p := filepath.Join(root, localeDir, l, "LC_MESSAGES", Domain+".mo")
+		m, err := readMO(p)
+		if err != nil {
+			log.Debugf("no catalog for %s: "+utils.ErrFormat, l, err)
+			continue
+		}
+		c.messages = m
+		break
+	}
+
+	d, err := readLocaleMessages(filepath.Join(root, localesDir), lang)
+	if err != nil {
+		log.Debugf("no yes and no answers for %s: "+utils.ErrFormat, lang, err)
+		return c
+	}
+	c.yesStr, c.noStr = d.yesStr, d.noStr
+	c.yesExpr, c.noExpr = compileAnswer(d.yesExpr, lang), compileAnswer(d.noExpr, lang)
+	return c
+}
+
+// compileAnswer returns the regexp of the answers expression expr of lang, or nil if there is none
+func compileAnswer(expr, lang string) *regexp.Regexp {
+	if expr == "" {
+		return nil
+	}
+	r, err := regexp.Compile(expr)
+	if err != nil {
+		log.Infof("invalid answers expression for %s: "+utils.ErrFormat, lang, err)
+		return nil
+	}
+	return r
+}
+
+// candidates are the catalog names to try for lang, from the most specific, like fr_FR@euro, fr_FR and fr
+func candidates(lang string) []string {
+	var l []string
+	base := strings.Split(lang, "@")[0]
+	if base != lang {
+		l = append(l, lang)
+	}
+	l = append(l, base)
+	if i := strings.Index(base, "_"); i > 0 {
+		l = append(l, base[:i])
+	}
+	return l
+}
+
+// Get returns the translation of msg, or msg if there is none
+func (c *Catalog) Get(msg string) string {
+	if t, ok := c.messages[msg]; ok && t != "" {
+		return t
+	}
+	return msg
+}
+
+// IsYes returns if answer is yes: y or yes in English, the word for yes in the language or
+// a single letter matching its yes expression, like o in French.
+func (c *Catalog) IsYes(answer string) bool {
+	return isAnswer(answer, []string{"y", "yes"}, c.yesStr, c.yesExpr)
+}
+
+// IsNo returns if answer is no: n or no in English, the word for no in the language or
+// a single letter matching its no expression.
+func (c *Catalog) IsNo(answer string) bool {
+	return isAnswer(answer, []string{"n", "no"}, c.noStr, c.noExpr)
+}
+
+// isAnswer returns if answer is one of english words, the localized word or a single letter matched by expr.
+// Longer answers are never matched by expr, so that "nonsense" isn't taken for no.
+func isAnswer(answer string, english []string, word string, expr *regexp.Regexp) bool {
+	answer = strings.TrimSpace(answer)
+	for _, w := range english {
+		if strings.EqualFold(answer, w) {
+			return true
+		}
+	}
+	if word != "" && strings.EqualFold(answer, word) {
+		return true
+	}
+	return expr != nil && utf8.RuneCountInString(answer) == 1 && expr.MatchString(answer)
+}
@@ -0,0 +1,156 @@
+package i18n_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ubuntu/ubuntu-report/internal/helper"
+	"github.com/ubuntu/ubuntu-report/internal/i18n"
+)
+
+// frFR is a locale definition with symbols and a custom escape character, like in glibc
+const frFR = `comment_char %
+escape_char /
+% French locale for France
+
+LC_CTYPE
+copy "i18n"
+END LC_CTYPE
+
+LC_MESSAGES
+yesexpr "<U005E><U005B><U002B><U0031><U006F><U004F><U0079><U0059><U005D>"
+noexpr  "^[-0nN]"
+yesstr  "oui"
+nostr   "non"
+END LC_MESSAGES
+`
+
+// frCA copies the answers of frFR
+const frCA = `LC_MESSAGES
+copy "fr_FR"
+END LC_MESSAGES
+`
+
+func TestLanguage(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		env  map[string]string
+
+		want string
+	}{
+		{"LC_ALL first", map[string]string{"LC_ALL": "fr_FR.UTF-8", "LANG": "de_DE.UTF-8", "LANGUAGE": "es_ES"}, "fr_FR"},
+		{"then LANG", map[string]string{"LANG": "de_DE.UTF-8", "LANGUAGE": "es_ES"}, "de_DE"},
+		{"then first of LANGUAGE", map[string]string{"LANGUAGE": "es_ES:fr_FR"}, "es_ES"},
+		{"none", nil, ""},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			a.Equal(i18n.Language(helper.GetenvFromMap(tc.env)), tc.want)
+		})
+	}
+}
+
+func TestGet(t *testing.T) {
+	t.Parallel()
+
+	translated := map[string]string{"": "Content-Type: text/plain; charset=UTF-8\n", "Send?": "Envoyer ?"}
+	untranslated := map[string]string{"Quit": "Quitter"}
+
+	testCases := []struct {
+		name     string
+		lang     string
+		catalog  string
+		messages map[string]string
+		corrupt  bool
+
+		want string
+	}{
+		{"translated", "fr_FR", "fr_FR", translated, false, "Envoyer ?"},
+		{"language catalog", "fr_FR", "fr", translated, false, "Envoyer ?"},
+		{"catalog with modifier", "fr_FR@euro", "fr_FR@euro", translated, false, "Envoyer ?"},
+		{"untranslated message", "fr_FR", "fr_FR", untranslated, false, "Send?"},
+		{"no catalog", "de_DE", "fr_FR", translated, false, "Send?"},
+		{"C locale", "C", "C", translated, false, "Send?"},
+		{"no language", "", "fr_FR", translated, false, "Send?"},
+		{"corrupted catalog", "fr_FR", "fr_FR", translated, true, "Send?"},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			root, tearDown := helper.TempDir(t)
+			defer tearDown()
+			p := filepath.Join(root, "usr/share/locale", tc.catalog, "LC_MESSAGES", i18n.Domain+".mo")
+			helper.WriteMO(t, p, tc.messages)
+			if tc.corrupt {
+				if err := ioutil.WriteFile(p, []byte("garbage, not a catalog"), 0644); err != nil {
+					t.Fatal("couldn't corrupt catalog:", err)
+				}
+			}
+
+			a.Equal(i18n.Load(root, tc.lang).Get("Send?"), tc.want)
+		})
+	}
+}
+
+func TestAnswers(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name   string
+		lang   string
+		answer string
+
+		wantYes bool
+		wantNo  bool
+	}{
+		{"english yes", "", "y", true, false},
+		{"english yes word", "", "Yes", true, false},
+		{"english no", "", "N", false, true},
+		{"english no word", "", "no", false, true},
+		{"english yes in another language", "fr_FR", "yes", true, false},
+		{"localized yes letter", "fr_FR", "o", true, false},
+		{"localized yes word", "fr_FR", "Oui", true, false},
+		{"localized no word", "fr_FR", "non", false, true},
+		{"copied answers", "fr_CA", "oui", true, false},
+		{"localized letter in another language", "", "o", false, false},
+		{"no locale definition", "de_DE", "o", false, false},
+
+		{"longer answers don't follow expressions", "fr_FR", "nonsense", false, false},
+		{"garbage", "fr_FR", "yesgarbage", false, false},
+		{"empty answer", "fr_FR", "", false, false},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			root, tearDown := helper.TempDir(t)
+			defer tearDown()
+			d := filepath.Join(root, "usr/share/i18n/locales")
+			if err := os.MkdirAll(d, 0755); err != nil {
+				t.Fatal("couldn't create locales directory:", err)
+			}
+			for name, content := range map[string]string{"fr_FR": frFR, "fr_CA": frCA} {
+				if err := ioutil.WriteFile(filepath.Join(d, name), []byte(content), 0644); err != nil {
+					t.Fatal("couldn't write locale definition:", err)
+				}
+			}
+
+			c := i18n.Load(root, tc.lang)
+			a.Equal(c.IsYes(tc.answer), tc.wantYes)
+			a.Equal(c.IsNo(tc.answer), tc.wantNo)
+		})
+	}
+}
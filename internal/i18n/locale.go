@@ -0,0 +1,112 @@
+package i18n
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// maxCopies is how many copy directives are followed before giving up on a locale definition
+const maxCopies = 5
+
+// localeMessages are the answers to yes/no questions defined in the LC_MESSAGES category of a locale
+type localeMessages struct {
+	yesExpr, noExpr string
+	yesStr, noStr   string
+}
+
+// readLocaleMessages returns the LC_MESSAGES category of the locale definition name, like fr_FR, in dir.
+// Categories copied from other locales are followed.
+func readLocaleMessages(dir, name string) (localeMessages, error) {
+	for i := 0; i < maxCopies; i++ {
+		m, copied, err := parseLocaleMessages(dir, name)
+		if err != nil || copied == "" {
+			return m, err
+		}
+		name = copied
+	}
+	return localeMessages{}, errors.Errorf("too many copies of LC_MESSAGES from %s", name)
+}
+
+// parseLocaleMessages returns the LC_MESSAGES category of the locale definition name in dir,
+// or the locale it's copied from
+func parseLocaleMessages(dir, name string) (localeMessages, string, error) {
+	var m localeMessages
+	if name == "" || strings.ContainsRune(name, filepath.Separator) {
+		return m, "", errors.Errorf("invalid locale name %q", name)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return m, "", errors.Wrapf(err, "couldn't read locale definition")
+	}
+
+	escape, comment := `\`, "#"
+	inMessages := false
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, comment) {
+			continue
+		}
+		key := strings.Fields(line)[0]
+		value := strings.TrimSpace(line[len(key):])
+
+		if !inMessages {
+			switch key {
+			case "escape_char":
+				escape = value
+			case "comment_char":
+				comment = value
+			case "LC_MESSAGES":
+				inMessages = true
+			}
+			continue
+		}
+
+		switch key {
+		case "END":
+			return m, "", nil
+		case "copy":
+			return m, decodeLocaleString(value, escape), nil
+		case "yesexpr":
+			m.yesExpr = decodeLocaleString(value, escape)
+		case "noexpr":
+			m.noExpr = decodeLocaleString(value, escape)
+		case "yesstr":
+			m.yesStr = decodeLocaleString(value, escape)
+		case "nostr":
+			m.noStr = decodeLocaleString(value, escape)
+		}
+	}
+	return m, "", errors.Errorf("no LC_MESSAGES category in %s", name)
+}
+
+// decodeLocaleString returns the quoted string s of a locale definition, with <Uxxxx> symbols and
+// characters escaped by escape decoded
+func decodeLocaleString(s, escape string) string {
+	s = strings.TrimSuffix(strings.TrimPrefix(s, `"`), `"`)
+
+	var b strings.Builder
+	for len(s) > 0 {
+		switch {
+		case escape != "" && strings.HasPrefix(s, escape) && len(s) > len(escape):
+			s = s[len(escape):]
+			b.WriteByte(s[0])
+			s = s[1:]
+			continue
+		case strings.HasPrefix(s, "<U"):
+			if end := strings.IndexByte(s, '>'); end > 0 {
+				if r, err := strconv.ParseUint(s[2:end], 16, 32); err == nil {
+					b.WriteRune(rune(r))
+					s = s[end+1:]
+					continue
+				}
+			}
+		}
+		b.WriteByte(s[0])
+		s = s[1:]
+	}
+	return b.String()
+}
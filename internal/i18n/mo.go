@@ -0,0 +1,68 @@
+package i18n
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// moMagic starts gettext binary catalogs, in the byte order they were written in
+const moMagic = 0x950412de
+
+// readMO returns the translations of the gettext binary catalog p, by original message.
+// Messages with a context are skipped and only the singular form of plural messages is kept.
+func readMO(p string) (map[string]string, error) {
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't read catalog")
+	}
+	if len(b) < 20 {
+		return nil, errors.Errorf("%s is too short to be a catalog", p)
+	}
+
+	var order binary.ByteOrder = binary.LittleEndian
+	if order.Uint32(b) != moMagic {
+		order = binary.BigEndian
+		if order.Uint32(b) != moMagic {
+			return nil, errors.Errorf("%s isn't a gettext catalog", p)
+		}
+	}
+	if major := order.Uint32(b[4:]) >> 16; major > 1 {
+		return nil, errors.Errorf("%s has unsupported revision %d", p, major)
+	}
+	n := order.Uint32(b[8:])
+	origTable, transTable := order.Uint32(b[12:]), order.Uint32(b[16:])
+
+	// str returns the string described at offset i of a table
+	str := func(table, i uint32) (string, error) {
+		d := uint64(table) + uint64(i)*8
+		if d+8 > uint64(len(b)) {
+			return "", errors.Errorf("%s is truncated", p)
+		}
+		l, off := uint64(order.Uint32(b[d:])), uint64(order.Uint32(b[d+4:]))
+		if off+l > uint64(len(b)) {
+			return "", errors.Errorf("%s is truncated", p)
+		}
+		return string(b[off : off+l]), nil
+	}
+
+	messages := make(map[string]string)
+	for i := uint32(0); i < n; i++ {
+		orig, err := str(origTable, i)
+		if err != nil {
+			return nil, err
+		}
+		trans, err := str(transTable, i)
+		if err != nil {
+			return nil, err
+		}
+		// the header, with the catalog metadata, and messages with a context aren't used
+		if orig == "" || strings.Contains(orig, "\x04") {
+			continue
+		}
+		messages[strings.Split(orig, "\x00")[0]] = strings.Split(trans, "\x00")[0]
+	}
+	return messages, nil
+}
@@ -20,6 +20,7 @@ func (m Metrics) getGPU() []gpuInfo {
 	results, err := filterAll(r, `^.* 0300: ([a-zA-Z0-9]+:[a-zA-Z0-9]+)( \(rev .*\))?$`)
 	if err != nil {
 		log.Infof("couldn't get GPU info: "+utils.ErrFormat, err)
+		m.diag.failed(err)
 		return nil
 	}
 
@@ -83,6 +84,7 @@ func (m Metrics) getCPU() cpuInfo {
 
 	if err != nil {
 		log.Infof("Couldn't get CPU info: "+utils.ErrFormat, err)
+		m.diag.failed(err)
 		return cpuInfo{}
 	}
 
@@ -103,6 +105,7 @@ func (m Metrics) getScreens() []screenInfo {
 	results, err := filterAll(r, `^(?: +(.*)\*|.* connected .* (\d+mm x \d+mm))`)
 	if err != nil {
 		log.Infof("couldn't get Screen info: "+utils.ErrFormat, err)
+		m.diag.failed(err)
 		return nil
 	}
 
@@ -135,6 +138,7 @@ func (m Metrics) getPartitions() []float64 {
 	results, err := filterAll(r, `^/dev/([^\s]+ +[^\s]*).*$`)
 	if err != nil {
 		log.Infof("couldn't get Disk info: "+utils.ErrFormat, err)
+		m.diag.failed(err)
 		return nil
 	}
 
@@ -151,6 +155,7 @@ func (m Metrics) getPartitions() []float64 {
 		v, err := convKBToGB(s[1])
 		if err != nil {
 			log.Infof("partition size should be an integer: "+utils.ErrFormat, err)
+			m.diag.failed(err)
 			continue
 		}
 		sizes = append(sizes, v)
@@ -163,6 +168,7 @@ func (m Metrics) getArch() string {
 	b, err := m.archCmd.CombinedOutput()
 	if err != nil {
 		log.Infof("couldn't get Architecture: "+utils.ErrFormat, err)
+		m.diag.failed(err)
 		return ""
 	}
 
@@ -173,6 +179,7 @@ func (m Metrics) getHwCap() string {
 	if m.hwCapCmd == nil {
 		// if no data return empty string. This is caused by an
 		// unsupported architecture or older version of glibc
+		m.diag.skipped("unsupported architecture or glibc older than 2.33")
 		return ""
 	}
 
@@ -182,6 +189,7 @@ func (m Metrics) getHwCap() string {
 	bytesSupported, err := ioutil.ReadAll(rSupported)
 	if err != nil {
 		log.Infof("Couldn't get hwcap: "+utils.ErrFormat, err)
+		m.diag.failed(err)
 		return ""
 	}
 
@@ -189,6 +197,7 @@ func (m Metrics) getHwCap() string {
 	hwCapIndex := bytes.Index(bytesSupported, hwCapBytes)
 	if hwCapIndex < 0 {
 		// no glibc-hwcaps, return empty string
+		m.diag.skipped("glibc-hwcaps aren't supported by this glibc")
 		return ""
 	}
 
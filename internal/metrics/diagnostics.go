@@ -0,0 +1,124 @@
+package metrics
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DiagnosticStatus is the outcome of collecting a section of the report
+type DiagnosticStatus string
+
+const (
+	// DiagnosticOK is a section which was collected
+	DiagnosticOK DiagnosticStatus = "ok"
+	// DiagnosticMissing is a section with nothing to collect on this machine, like a missing file or command
+	DiagnosticMissing DiagnosticStatus = "missing"
+	// DiagnosticError is a section which couldn't be collected because of a failure
+	DiagnosticError DiagnosticStatus = "error"
+	// DiagnosticSkipped is a section which doesn't apply to this machine
+	DiagnosticSkipped DiagnosticStatus = "skipped"
+)
+
+// Diagnostic tells how collecting a section of the report went
+type Diagnostic struct {
+	Section string
+	Status  DiagnosticStatus
+	// Reason is why the section isn't collected, or why part of it is missing
+	Reason   string `json:",omitempty"`
+	Duration time.Duration
+	// ExitCode is the exit code of the command the section is read from, if it failed
+	ExitCode *int `json:",omitempty"`
+}
+
+// diagnostics records how each section of the report is collected.
+// A nil diagnostics records nothing, so that getters can be called on their own.
+type diagnostics struct {
+	current     Diagnostic
+	diagnostics []Diagnostic
+}
+
+// section runs collect for the section name and records its outcome. collect returns false if no value was found.
+func (d *diagnostics) section(name string, collect func() bool) {
+	if d == nil {
+		collect()
+		return
+	}
+
+	d.current = Diagnostic{Section: name}
+	start := time.Now()
+	found := collect()
+	d.current.Duration = time.Since(start)
+
+	switch {
+	case found:
+		// a partial failure is kept as a note
+		d.current.Status = DiagnosticOK
+	case d.current.Status == "":
+		d.current.Status = DiagnosticMissing
+		d.current.Reason = "no value found"
+	}
+	d.diagnostics = append(d.diagnostics, d.current)
+}
+
+// failed records why the current section, or part of it, couldn't be collected.
+// Only the first failure of a section is kept.
+func (d *diagnostics) failed(err error) {
+	if d == nil || d.current.Status != "" {
+		return
+	}
+	d.current.Status, d.current.ExitCode = statusOf(err)
+	d.current.Reason = err.Error()
+}
+
+// skipped records why the current section doesn't apply to this machine
+func (d *diagnostics) skipped(reason string) {
+	if d == nil || d.current.Status != "" {
+		return
+	}
+	d.current.Status = DiagnosticSkipped
+	d.current.Reason = reason
+}
+
+// statusOf returns if err is due to something missing on the machine or to a failure,
+// alongside the exit code of the failing command, if any.
+func statusOf(err error) (DiagnosticStatus, *int) {
+	switch cause := errors.Cause(err).(type) {
+	case *exec.ExitError:
+		code := cause.ExitCode()
+		return DiagnosticError, &code
+	case *exec.Error:
+		if cause.Err == exec.ErrNotFound {
+			return DiagnosticMissing, nil
+		}
+	case noMatchError, notSetError:
+		return DiagnosticMissing, nil
+	case *os.PathError:
+		if os.IsNotExist(cause) {
+			return DiagnosticMissing, nil
+		}
+	}
+	return DiagnosticError, nil
+}
+
+// noMatchError is returned when no line of a file or command output matches what we look for
+type noMatchError struct {
+	regex string
+}
+
+func (e noMatchError) Error() string {
+	return fmt.Sprintf("couldn't find any line matching %s", e.regex)
+}
+
+// notSetError is returned when a variable we look for isn't set in a file
+type notSetError struct {
+	name string
+	file string
+}
+
+func (e notSetError) Error() string {
+	return fmt.Sprintf("%s isn't set in %s", e.name, e.file)
+}
@@ -0,0 +1,174 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// ChangeKind is how a field differs between two reports
+type ChangeKind string
+
+const (
+	// FieldAdded is a field only present in the newest report
+	FieldAdded ChangeKind = "added"
+	// FieldRemoved is a field only present in the oldest report
+	FieldRemoved ChangeKind = "removed"
+	// FieldChanged is a field with a different value in both reports
+	FieldChanged ChangeKind = "changed"
+)
+
+// Change is a field-level difference between two reports
+type Change struct {
+	// Field is the path of the field in the report, like GPU[1].Model
+	Field string
+	Kind  ChangeKind
+	Old   interface{} `json:",omitempty"`
+	New   interface{} `json:",omitempty"`
+}
+
+// Diff returns the fields which differ between the reports previous and current, in report order.
+// Both are parsed into the report model, so that formatting and unknown fields are ignored.
+func Diff(previous, current []byte) ([]Change, error) {
+	var o, n metrics
+	if err := json.Unmarshal(previous, &o); err != nil {
+		return nil, errors.Wrapf(err, "previous report is invalid")
+	}
+	if err := json.Unmarshal(current, &n); err != nil {
+		return nil, errors.Wrapf(err, "current report is invalid")
+	}
+
+	var changes []Change
+	diffValue("", reflect.ValueOf(o), reflect.ValueOf(n), &changes)
+	return changes, nil
+}
+
+var rawMessageType = reflect.TypeOf(json.RawMessage{})
+
+// diffValue appends to changes the differences between o and n, found at path
+func diffValue(path string, o, n reflect.Value, changes *[]Change) {
+	switch {
+	case o.Type() == rawMessageType:
+		// installer and upgrader data are free-form
+		diffJSON(path, decodeJSON(o.Bytes()), decodeJSON(n.Bytes()), changes)
+
+	case o.Kind() == reflect.Ptr:
+		if o.IsNil() || n.IsNil() {
+			if o.IsNil() != n.IsNil() {
+				addChange(path, interfaceOrNil(o), interfaceOrNil(n), o.IsNil(), n.IsNil(), changes)
+			}
+			return
+		}
+		diffValue(path, o.Elem(), n.Elem(), changes)
+
+	case o.Kind() == reflect.Struct:
+		for i := 0; i < o.NumField(); i++ {
+			f := o.Type().Field(i)
+			p := f.Name
+			if path != "" {
+				p = path + "." + f.Name
+			}
+			diffValue(p, o.Field(i), n.Field(i), changes)
+		}
+
+	case o.Kind() == reflect.Slice:
+		for i := 0; i < o.Len() || i < n.Len(); i++ {
+			p := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= n.Len():
+				addChange(p, o.Index(i).Interface(), nil, false, true, changes)
+			case i >= o.Len():
+				addChange(p, nil, n.Index(i).Interface(), true, false, changes)
+			default:
+				diffValue(p, o.Index(i), n.Index(i), changes)
+			}
+		}
+
+	default:
+		if o.Interface() != n.Interface() {
+			// missing fields are left to their zero value
+			zero := reflect.Zero(o.Type()).Interface()
+			addChange(path, o.Interface(), n.Interface(), o.Interface() == zero, n.Interface() == zero, changes)
+		}
+	}
+}
+
+// addChange appends the change of the field at path from o to n, which can be missing
+func addChange(path string, o, n interface{}, oMissing, nMissing bool, changes *[]Change) {
+	c := Change{Field: path, Kind: FieldChanged, Old: o, New: n}
+	switch {
+	case oMissing:
+		c = Change{Field: path, Kind: FieldAdded, New: n}
+	case nMissing:
+		c = Change{Field: path, Kind: FieldRemoved, Old: o}
+	}
+	*changes = append(*changes, c)
+}
+
+// diffJSON appends to changes the differences between the decoded json values o and n, found at path.
+// nil values are missing ones.
+func diffJSON(path string, o, n interface{}, changes *[]Change) {
+	om, oIsMap := o.(map[string]interface{})
+	nm, nIsMap := n.(map[string]interface{})
+	if oIsMap && nIsMap {
+		keys := make(map[string]bool)
+		for k := range om {
+			keys[k] = true
+		}
+		for k := range nm {
+			keys[k] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+		for _, k := range sorted {
+			diffJSON(path+"."+k, om[k], nm[k], changes)
+		}
+		return
+	}
+
+	ol, oIsSlice := o.([]interface{})
+	nl, nIsSlice := n.([]interface{})
+	if oIsSlice && nIsSlice {
+		for i := 0; i < len(ol) || i < len(nl); i++ {
+			var ov, nv interface{}
+			if i < len(ol) {
+				ov = ol[i]
+			}
+			if i < len(nl) {
+				nv = nl[i]
+			}
+			diffJSON(fmt.Sprintf("%s[%d]", path, i), ov, nv, changes)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(o, n) {
+		addChange(path, o, n, o == nil, n == nil, changes)
+	}
+}
+
+// decodeJSON returns the decoded value of b, nil if it's empty, or b as a string if it's not valid json
+func decodeJSON(b []byte) interface{} {
+	if len(bytes.TrimSpace(b)) == 0 {
+		return nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return string(b)
+	}
+	return v
+}
+
+func interfaceOrNil(v reflect.Value) interface{} {
+	if v.IsNil() {
+		return nil
+	}
+	return v.Elem().Interface()
+}
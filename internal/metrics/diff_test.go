@@ -0,0 +1,104 @@
+package metrics_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ubuntu/ubuntu-report/internal/helper"
+	"github.com/ubuntu/ubuntu-report/internal/metrics"
+)
+
+func TestDiff(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		previous string
+		current  string
+
+		want    []metrics.Change
+		wantErr bool
+	}{
+		{"identical", `{"Version": "18.04", "RAM": 8}`, `{"Version":"18.04","RAM":8}`, nil, false},
+		{"changed value", `{"Version": "18.04", "RAM": 8}`, `{"Version": "18.04", "RAM": 16}`,
+			[]metrics.Change{{Field: "RAM", Kind: metrics.FieldChanged, Old: 8.0, New: 16.0}}, false},
+		{"added and removed values", `{"Version": "18.04", "Timezone": "Europe/Paris"}`, `{"Version": "18.04", "Language": "fr_FR"}`,
+			[]metrics.Change{
+				{Field: "Language", Kind: metrics.FieldAdded, New: "fr_FR"},
+				{Field: "Timezone", Kind: metrics.FieldRemoved, Old: "Europe/Paris"}}, false},
+		{"nested field", `{"CPU": {"Name": "old cpu", "Cores": "2"}}`, `{"CPU": {"Name": "new cpu", "Cores": "2"}}`,
+			[]metrics.Change{{Field: "CPU.Name", Kind: metrics.FieldChanged, Old: "old cpu", New: "new cpu"}}, false},
+		{"changed list item", `{"Disks": [250.1, 500]}`, `{"Disks": [250.1, 1000]}`,
+			[]metrics.Change{{Field: "Disks[1]", Kind: metrics.FieldChanged, Old: 500.0, New: 1000.0}}, false},
+		{"free form data", `{"Install": {"Media": "old"}}`, `{"Install": { "Media" : "new"}}`,
+			[]metrics.Change{{Field: "Install.Media", Kind: metrics.FieldChanged, Old: "old", New: "new"}}, false},
+		{"same free form data", `{"Install": {"Media": "old", "Type": "GTK"}}`, `{"Install": { "Type": "GTK", "Media" : "old"}}`, nil, false},
+		{"free form data added", `{}`, `{"Upgrade": {"From": "17.10"}}`,
+			[]metrics.Change{{Field: "Upgrade", Kind: metrics.FieldAdded, New: map[string]interface{}{"From": "17.10"}}}, false},
+		{"free form nested data", `{"Install": {"Stages": {"0": "language"}, "List": [1]}}`, `{"Install": {"Stages": {"0": "language", "3": "done"}, "List": [2]}}`,
+			[]metrics.Change{
+				{Field: "Install.List[0]", Kind: metrics.FieldChanged, Old: 1.0, New: 2.0},
+				{Field: "Install.Stages.3", Kind: metrics.FieldAdded, New: "done"}}, false},
+		{"unknown fields are ignored", `{"Version": "18.04", "Something": 1}`, `{"Version": "18.04", "Something": 2}`, nil, false},
+
+		{"invalid previous report", `{`, `{}`, nil, true},
+		{"invalid current report", `{}`, `[]`, nil, true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			got, err := metrics.Diff([]byte(tc.previous), []byte(tc.current))
+
+			a.CheckWantedErr(err, tc.wantErr)
+			a.Equal(len(got), len(tc.want))
+			if tc.want != nil {
+				a.Equal(got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDiffStructuredValues(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		previous string
+		current  string
+
+		wantField string
+		wantKind  metrics.ChangeKind
+		wantJSON  string
+	}{
+		{"new gpu", `{"GPU": [{"Vendor": "8086", "Model": "0126"}]}`,
+			`{"GPU": [{"Vendor": "8086", "Model": "0126"}, {"Vendor": "10de", "Model": "1c82"}]}`,
+			"GPU[1]", metrics.FieldAdded, `{"Field":"GPU[1]","Kind":"added","New":{"Vendor":"10de","Model":"1c82"}}`},
+		{"removed screen", `{"Screens": [{"Size": "300mmx200mm", "Resolution": "1920x1080", "Frequency": "60.00"}]}`, `{}`,
+			"Screens[0]", metrics.FieldRemoved,
+			`{"Field":"Screens[0]","Kind":"removed","Old":{"Size":"300mmx200mm","Resolution":"1920x1080","Frequency":"60.00"}}`},
+		{"added section", `{"Version": "18.04"}`, `{"Version": "18.04", "BIOS": {"Vendor": "vendor", "Version": "1.0"}}`,
+			"BIOS", metrics.FieldAdded, `{"Field":"BIOS","Kind":"added","New":{"Vendor":"vendor","Version":"1.0"}}`},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			got, err := metrics.Diff([]byte(tc.previous), []byte(tc.current))
+
+			a.CheckWantedErr(err, false)
+			if len(got) != 1 {
+				t.Fatalf("expected one change, got: %+v", got)
+			}
+			a.Equal(got[0].Field, tc.wantField)
+			a.Equal(got[0].Kind, tc.wantKind)
+			b, err := json.Marshal(got[0])
+			a.CheckWantedErr(err, false)
+			a.Equal(string(b), tc.wantJSON)
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// CheckEdited returns an error if edited, the report as changed by the user, doesn't follow the report
+// format or if any of its fields was added or changed compared to original.
+// Fields, list elements included, can only be removed or set to null.
+func CheckEdited(original, edited []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(edited))
+	dec.DisallowUnknownFields()
+	var r metrics
+	if err := dec.Decode(&r); err != nil {
+		return errors.Wrapf(err, "edited report doesn't follow the report format")
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("edited report has content after the report")
+	}
+
+	var o, e interface{}
+	if err := json.Unmarshal(original, &o); err != nil {
+		return errors.Wrapf(err, "original report isn't valid")
+	}
+	if err := json.Unmarshal(edited, &e); err != nil {
+		return errors.Wrapf(err, "edited report isn't valid")
+	}
+	if _, ok := e.(map[string]interface{}); !ok {
+		return errors.New("edited report should be a json object")
+	}
+	return checkReduced("", o, e)
+}
+
+// checkReduced returns an error if e, at path, isn't o with some fields removed or nulled
+func checkReduced(path string, o, e interface{}) error {
+	if e == nil {
+		return nil
+	}
+
+	switch ev := e.(type) {
+	case map[string]interface{}:
+		om, ok := o.(map[string]interface{})
+		if !ok {
+			return errors.Errorf("%s was changed", path)
+		}
+		keys := make([]string, 0, len(ev))
+		for k := range ev {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			ov, ok := om[k]
+			if !ok {
+				return errors.Errorf("%s was added", joinPath(path, k))
+			}
+			if err := checkReduced(joinPath(path, k), ov, ev[k]); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		ol, ok := o.([]interface{})
+		if !ok {
+			return errors.Errorf("%s was changed", path)
+		}
+		// removed elements shift the next ones: match each element with the next original one it reduces
+		j := 0
+		for i, v := range ev {
+			for ; j < len(ol); j++ {
+				if checkReduced(path, ol[j], v) == nil {
+					break
+				}
+			}
+			if j == len(ol) {
+				return errors.Errorf("%s was added or changed", fmt.Sprintf("%s[%d]", path, i))
+			}
+			j++
+		}
+	default:
+		if !reflect.DeepEqual(o, e) {
+			return errors.Errorf("%s was changed", path)
+		}
+	}
+	return nil
+}
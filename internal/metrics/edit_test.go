@@ -0,0 +1,63 @@
+package metrics_test
+
+import (
+	"testing"
+
+	"github.com/ubuntu/ubuntu-report/internal/helper"
+	"github.com/ubuntu/ubuntu-report/internal/metrics"
+)
+
+func TestCheckEdited(t *testing.T) {
+	t.Parallel()
+
+	const original = `{
+  "Version": "18.04",
+  "CPU": { "Vendor": "Genuine", "Name": "Intuis Corus" },
+  "GPU": [ { "Vendor": "8086", "Model": "0126" }, { "Vendor": "10de", "Model": "1c8d" } ],
+  "RAM": 8,
+  "Disks": [ 240.1, 500 ],
+  "Install": { "Type": "GTK", "Stages": { "0": "language" } }
+}`
+
+	testCases := []struct {
+		name   string
+		edited string
+
+		wantErr bool
+	}{
+		{"unchanged", original, false},
+		{"field removed", `{ "Version": "18.04", "RAM": 8 }`, false},
+		{"field nulled", `{ "Version": "18.04", "CPU": null, "RAM": null }`, false},
+		{"subfield removed", `{ "CPU": { "Vendor": "Genuine" } }`, false},
+		{"list element removed", `{ "GPU": [ { "Vendor": "10de", "Model": "1c8d" } ], "Disks": [ 500 ] }`, false},
+		{"list element nulled", `{ "GPU": [ null, { "Vendor": "10de" } ] }`, false},
+		{"installer data removed", `{ "Install": { "Stages": {} } }`, false},
+		{"everything removed", `{}`, false},
+
+		{"field changed", `{ "Version": "20.04" }`, true},
+		{"number changed", `{ "RAM": 16 }`, true},
+		{"known field added", `{ "Arch": "amd64" }`, true},
+		{"unknown field added", `{ "Serial": "1234" }`, true},
+		{"subfield changed", `{ "CPU": { "Vendor": "Other" } }`, true},
+		{"installer data added", `{ "Install": { "Type": "GTK", "User": "me" } }`, true},
+		{"list element added", `{ "Disks": [ 240.1, 500, 1000 ] }`, true},
+		{"list elements reordered", `{ "Disks": [ 500, 240.1 ] }`, true},
+		{"type changed", `{ "RAM": "8" }`, true},
+		{"not an object", `[]`, true},
+		{"null report", `null`, true},
+		{"invalid json", `{ "Version": `, true},
+		{"empty", ``, true},
+		{"trailing content", `{} {}`, true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			err := metrics.CheckEdited([]byte(original), []byte(tc.edited))
+
+			a.CheckWantedErr(err, tc.wantErr)
+		})
+	}
+}
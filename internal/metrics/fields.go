@@ -0,0 +1,192 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// FieldInfo describes where a report field comes from and why it's collected
+type FieldInfo struct {
+	// Field is the path of the field in the report, like CPU.Name. Elements of lists share the same path.
+	Field string
+	// Source is the file, sysfs attribute, command or environment variable the value is read from
+	Source string
+	// Purpose is what the field helps to decide
+	Purpose string
+	// Precision is the rounding or filtering applied to the value, if any
+	Precision string `json:",omitempty"`
+	// Privacy is what the value can tell about the machine or its user
+	Privacy string
+}
+
+const (
+	cpuPurpose    = "Know which processors to support and which instruction sets to optimize for."
+	cpuPrivacy    = "Shared by every machine with the same processor model."
+	dmiPrivacy    = "Shared by every machine of the same model. Serial numbers and UUIDs aren't read."
+	sizePrecision = "In GB, rounded to 0.1."
+)
+
+// fields describe every field of the report, in report order
+var fields = []FieldInfo{
+	{"Version", "VERSION_ID in /etc/os-release", "Know which releases are in use.", "", "Shared by every installation of this release."},
+	{"Variant", "VARIANT_ID in /etc/os-release, the snapd model assertion, cloud-init markers and installed seed meta-packages",
+		"Know which products, like desktop, server or cloud images, are in use.", "", "Shared by every installation of this product."},
+
+	{"OEM.Vendor", "/sys/class/dmi/id/sys_vendor", "Know which manufacturers' hardware to enable first.", "", dmiPrivacy},
+	{"OEM.Product", "/sys/class/dmi/id/product_name", "Know which machine models to certify and enable first.", "", dmiPrivacy},
+	{"OEM.Family", "/sys/class/dmi/id/product_family", "Group machine models of the same range.", "", dmiPrivacy},
+	{"OEM.DCD", "/var/lib/ubuntu_dist_channel", "Know which preinstalled images machines were shipped with.", "Only the first word of the file.",
+		"Shared by every machine installed from the same image."},
+	{"BIOS.Vendor", "/sys/class/dmi/id/bios_vendor", "Know which firmware to support.", "", dmiPrivacy},
+	{"BIOS.Version", "/sys/class/dmi/id/bios_version", "Know which firmware versions need workarounds.", "", dmiPrivacy},
+
+	{"CPU.OpMode", `"CPU op-mode(s)" in lscpu -J`, cpuPurpose, "", cpuPrivacy},
+	{"CPU.CPUs", `"CPU(s)" in lscpu -J`, cpuPurpose, "", cpuPrivacy},
+	{"CPU.Threads", `"Thread(s) per core" in lscpu -J`, cpuPurpose, "", cpuPrivacy},
+	{"CPU.Cores", `"Core(s) per socket" in lscpu -J`, cpuPurpose, "", cpuPrivacy},
+	{"CPU.Sockets", `"Socket(s)" in lscpu -J`, cpuPurpose, "", cpuPrivacy},
+	{"CPU.Vendor", `"Vendor ID" in lscpu -J`, cpuPurpose, "", cpuPrivacy},
+	{"CPU.Family", `"CPU family" in lscpu -J`, cpuPurpose, "", cpuPrivacy},
+	{"CPU.Model", `"Model" in lscpu -J`, cpuPurpose, "", cpuPrivacy},
+	{"CPU.Stepping", `"Stepping" in lscpu -J`, cpuPurpose, "", cpuPrivacy},
+	{"CPU.Name", `"Model name" in lscpu -J`, cpuPurpose, "", cpuPrivacy},
+	{"CPU.Virtualization", `"Virtualization" in lscpu -J`, "Know how many machines can run virtual machines.", "", cpuPrivacy},
+	{"CPU.Hypervisor", `"Hypervisor vendor" in lscpu -J`, "Know which hypervisors the system runs on.", "",
+		"Shared by every virtual machine of this hypervisor."},
+	{"CPU.VirtualizationType", `"Virtualization type" in lscpu -J`, "Know which hypervisors the system runs on.", "",
+		"Shared by every virtual machine of this hypervisor."},
+	{"Arch", "dpkg --print-architecture", "Know which architectures to build and test for.", "", "Shared by every machine of this architecture."},
+	{"HwCap", "glibc-hwcaps subdirectories supported in ld.so --help", "Know which processor feature levels libraries can be optimized for.",
+		"Only the best supported level. Empty before glibc 2.33.", cpuPrivacy},
+
+	{"GPU.Vendor", "PCI vendor ID of display controllers (class 0300) in lspci -n", "Know which graphics drivers to support.", "Numeric ID only.",
+		"Shared by every machine with the same graphics card."},
+	{"GPU.Model", "PCI device ID of display controllers (class 0300) in lspci -n", "Know which graphics drivers to support.", "Numeric ID only.",
+		"Shared by every machine with the same graphics card."},
+	{"RAM", "MemTotal in /proc/meminfo", "Set the memory requirements of the release.", sizePrecision, "Shared by every machine with the same memory size."},
+	{"Disks", "size and queue/logical_block_size of /sys/block/hd*, sd* and vd*", "Set the disk space requirements of the release.", sizePrecision,
+		"Disk sizes only: no model, serial number or content."},
+	{"Partitions", "size of /dev partitions in df, loop devices excluded", "Set the default partitioning of the installer.", sizePrecision,
+		"Partition sizes only: no mount point, label or content."},
+	{"Screens.Size", "physical size of connected outputs in xrandr", "Choose default scaling and fonts size.", "In millimeters.",
+		"Shared by every screen of the same model."},
+	{"Screens.Resolution", "current mode of connected outputs in xrandr", "Choose default scaling and the minimum supported resolution.", "",
+		"Shared by every screen of the same model."},
+	{"Screens.Frequency", "current refresh rate of connected outputs in xrandr", "Know which refresh rates to support.", "",
+		"Shared by every screen of the same model."},
+
+	{"Autologin", "AutomaticLoginEnable in /etc/gdm3/custom.conf", "Know how many machines log in automatically.", "Only whether it's enabled, not the user.",
+		"Doesn't include any user name."},
+	{"LivePatch", "existence of /var/snap/canonical-livepatch/common/machine-token", "Know how many machines receive live kernel patches.",
+		"Only whether the file exists.", "The token isn't read."},
+	{"Session.DE", "XDG_CURRENT_DESKTOP environment variable", "Know which desktop environments are used.", "",
+		"Shared by every user of this desktop environment."},
+	{"Session.Name", "XDG_SESSION_DESKTOP environment variable", "Know which sessions are used.", "", "Shared by every user of this session."},
+	{"Session.Type", "XDG_SESSION_TYPE environment variable", "Know how many sessions run on Wayland or X11.", "", "Shared by every user of this display server."},
+	{"Language", "LC_ALL, LANG or the first language of LANGUAGE environment variables", "Know which translations to complete first.",
+		"Encoding is dropped.", "Shared by every user of this language."},
+	{"Timezone", "/etc/localtime symbolic link target", "Know where mirrors are needed.", "Only the region and city of the timezone.",
+		"Shared by every machine in this timezone."},
+
+	{"Install", "/var/log/installer/telemetry, written by the installer", "Improve the installer, its steps and default choices.",
+		"Sent as written by the installer, if it's valid JSON.",
+		"Installation media, choices and step timings, as recorded by the installer: it isn't filtered."},
+	{"Upgrade", "/var/log/upgrade/telemetry, written by the release upgrader", "Improve release upgrades.",
+		"Sent as written by the upgrader, if it's valid JSON.",
+		"Previous release and step timings, as recorded by the upgrader: it isn't filtered."},
+	{"PreviousRelease.Version", "the latest release reported from this machine, when reporting on upgrade", "Know which upgrade paths are in use.", "",
+		"Shared by every machine upgraded from this release."},
+	{"PreviousRelease.Decision", "the reporting decision of the previous release, carried over on upgrade",
+		"Know how reporting decisions are carried over on upgrade.", "Always granted: opt-out messages don't carry it.", "Same for every reporting machine."},
+	{"PreviousRelease.SkippedReleases", "releases between the previous and the current one", "Know how many upgrades go from an LTS to the next one.",
+		"Only set when releases were skipped, for distributions with a known release cadence.", "Shared by every machine upgraded along this path."},
+}
+
+// Fields returns the description of every field of the report, in report order
+func Fields() []FieldInfo {
+	return append([]FieldInfo(nil), fields...)
+}
+
+var listIndex = regexp.MustCompile(`\[\d+\]`)
+
+// Explain returns the description of field, or of all its subfields if it has some.
+// List indexes, like in GPU[1].Model, and case are ignored. Fields inside installer and
+// upgrader data are described by their parent.
+func Explain(field string) ([]FieldInfo, error) {
+	name := listIndex.ReplaceAllString(field, "")
+	if infos := explain(name); len(infos) > 0 {
+		return infos, nil
+	}
+	for _, parent := range []string{"Install", "Upgrade"} {
+		if strings.HasPrefix(strings.ToLower(name), strings.ToLower(parent)+".") {
+			return explain(parent), nil
+		}
+	}
+	return nil, errors.Errorf("%s isn't a field of the report", field)
+}
+
+func explain(name string) []FieldInfo {
+	var infos []FieldInfo
+	for _, f := range fields {
+		if strings.EqualFold(f.Field, name) || strings.HasPrefix(strings.ToLower(f.Field), strings.ToLower(name)+".") {
+			infos = append(infos, f)
+		}
+	}
+	return infos
+}
+
+var jsonKey = regexp.MustCompile(`^(\s*)"([^"]+)":`)
+
+// Annotate returns the indented json report with the description of each field as comment lines
+// before its first occurrence. The result isn't valid json anymore.
+func Annotate(report []byte) []byte {
+	infos := make(map[string]FieldInfo)
+	for _, f := range fields {
+		infos[f.Field] = f
+	}
+
+	var out bytes.Buffer
+	annotated := make(map[string]bool)
+	// path of the objects containing the current line, by indentation
+	parents := make(map[int]string)
+	scanner := bufio.NewScanner(bytes.NewReader(report))
+	for scanner.Scan() {
+		line := scanner.Text()
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		m := jsonKey.FindStringSubmatch(line)
+		if m == nil {
+			// list elements and closing brackets keep the path of their parent
+			if p, ok := parents[indent-2]; ok {
+				parents[indent] = p
+			}
+			out.WriteString(line + "\n")
+			continue
+		}
+
+		p := m[2]
+		if parent := parents[indent-2]; parent != "" {
+			p = parent + "." + m[2]
+		}
+		parents[indent] = p
+		if f, ok := infos[p]; ok && !annotated[p] {
+			annotated[p] = true
+			writeAnnotation(&out, m[1], f)
+		}
+		out.WriteString(line + "\n")
+	}
+	return out.Bytes()
+}
+
+func writeAnnotation(w *bytes.Buffer, indent string, f FieldInfo) {
+	fmt.Fprintf(w, "%s// %s\n", indent, f.Purpose)
+	fmt.Fprintf(w, "%s// Source: %s\n", indent, f.Source)
+	if f.Precision != "" {
+		fmt.Fprintf(w, "%s// Precision: %s\n", indent, f.Precision)
+	}
+	fmt.Fprintf(w, "%s// Privacy: %s\n", indent, f.Privacy)
+}
@@ -0,0 +1,97 @@
+package metrics_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ubuntu/ubuntu-report/internal/helper"
+	"github.com/ubuntu/ubuntu-report/internal/metrics"
+)
+
+func TestExplain(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		field string
+
+		want    []string
+		wantErr bool
+	}{
+		{"RAM", []string{"RAM"}, false},
+		{"CPU.Name", []string{"CPU.Name"}, false},
+		{"cpu.name", []string{"CPU.Name"}, false},
+		{"Session", []string{"Session.DE", "Session.Name", "Session.Type"}, false},
+		{"GPU[1].Model", []string{"GPU.Model"}, false},
+		{"Screens[0]", []string{"Screens.Size", "Screens.Resolution", "Screens.Frequency"}, false},
+		{"Install.Stages.3", []string{"Install"}, false},
+
+		{"Serial", nil, true},
+		{"CPU.Serial", nil, true},
+		{"RAMSize", nil, true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.field, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			infos, err := metrics.Explain(tc.field)
+
+			a.CheckWantedErr(err, tc.wantErr)
+			var got []string
+			for _, f := range infos {
+				got = append(got, f.Field)
+			}
+			a.Equal(got, tc.want)
+		})
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	t.Parallel()
+	a := helper.Asserter{T: t}
+
+	report := `{
+  "Version": "18.04",
+  "GPU": [
+    {
+      "Vendor": "8086",
+      "Model": "0126"
+    },
+    {
+      "Vendor": "10de",
+      "Model": "0fd1"
+    }
+  ],
+  "RAM": 8,
+  "Install": {
+    "Type": "GTK",
+    "Stages": {
+      "0": "language"
+    }
+  }
+}
+`
+
+	got := string(metrics.Annotate([]byte(report)))
+
+	var annotated []string
+	var withoutAnnotations []string
+	for _, l := range strings.Split(got, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(l), "//") {
+			withoutAnnotations = append(withoutAnnotations, l)
+			continue
+		}
+		if strings.HasPrefix(strings.TrimSpace(l), "// Source: ") {
+			annotated = append(annotated, l)
+		}
+	}
+	a.Equal(strings.Join(withoutAnnotations, "\n"), report)
+	a.Equal(annotated, []string{
+		"  // Source: VERSION_ID in /etc/os-release",
+		"      // Source: PCI vendor ID of display controllers (class 0300) in lspci -n",
+		"      // Source: PCI device ID of display controllers (class 0300) in lspci -n",
+		"  // Source: MemTotal in /proc/meminfo",
+		"  // Source: /var/log/installer/telemetry, written by the installer",
+	})
+}
@@ -15,23 +15,29 @@ import (
 )
 
 func (m Metrics) getVersion() string {
-	v, err := matchFromFile(filepath.Join(m.root, "etc/os-release"), `^VERSION_ID="(.*)"$`, false)
+	r, err := m.GetOSRelease()
+	if err == nil && r.VersionID == "" {
+		err = notSetError{"VERSION_ID", "os-release"}
+	}
 	if err != nil {
 		log.Infof("couldn't get version information from os-release: "+utils.ErrFormat, err)
+		m.diag.failed(err)
 		return ""
 	}
-	return v
+	return r.VersionID
 }
 
 func (m Metrics) getRAM() *float64 {
 	s, err := matchFromFile(filepath.Join(m.root, "proc/meminfo"), `^MemTotal: +(\d+) kB$`, false)
 	if err != nil {
 		log.Infof("couldn't get RAM information from meminfo: "+utils.ErrFormat, err)
+		m.diag.failed(err)
 		return nil
 	}
 	v, err := convKBToGB(s)
 	if err != nil {
 		log.Infof("partition size should be an integer: "+utils.ErrFormat, err)
+		m.diag.failed(err)
 		return nil
 	}
 	return &v
@@ -41,11 +47,14 @@ func (m Metrics) getTimeZone() string {
 	path, err := os.Readlink(filepath.Join(m.root, "etc/localtime"))
 	if err != nil {
 		log.Infof("couldn't get timezone information: "+utils.ErrFormat, err)
+		m.diag.failed(err)
 		return ""
 	}
 	tzParts := strings.Split(path, string(os.PathSeparator))
 	if len(tzParts) < 2 {
-		log.Infof(utils.ErrFormat, errors.Errorf("malformed timezone information, localtime points to: %s", path))
+		err := errors.Errorf("malformed timezone information, localtime points to: %s", path)
+		log.Infof(utils.ErrFormat, err)
+		m.diag.failed(err)
 		return ""
 	}
 	return strings.Join(tzParts[len(tzParts)-2:], "/")
@@ -55,6 +64,7 @@ func (m Metrics) getAutologin() bool {
 	v, err := matchFromFile(filepath.Join(m.root, "etc/gdm3/custom.conf"), `^AutomaticLoginEnable ?= ?(.*)$`, true)
 	if err != nil {
 		log.Infof("couldn't get autologin information from gdm: "+utils.ErrFormat, err)
+		m.diag.failed(err)
 		return false
 	}
 	if strings.ToLower(v) != "true" {
@@ -67,6 +77,7 @@ func (m Metrics) getOEM() (string, string, string, string) {
 	v, err := getFromFileTrimmed(filepath.Join(m.root, "sys/class/dmi/id/sys_vendor"))
 	if err != nil {
 		log.Infof("couldn't get sys vendor information: "+utils.ErrFormat, err)
+		m.diag.failed(err)
 	}
 	if strings.Contains(v, "\n") {
 		log.Infof(utils.ErrFormat, errors.Errorf("malformed sys vendor information, file contains: %s", v))
@@ -75,6 +86,7 @@ func (m Metrics) getOEM() (string, string, string, string) {
 	p, err := getFromFileTrimmed(filepath.Join(m.root, "sys/class/dmi/id/product_name"))
 	if err != nil {
 		log.Infof("couldn't get sys product name information: "+utils.ErrFormat, err)
+		m.diag.failed(err)
 	}
 	if strings.Contains(p, "\n") {
 		log.Infof(utils.ErrFormat, errors.Errorf("malformed sys product name information, file contains: %s", p))
@@ -83,6 +95,7 @@ func (m Metrics) getOEM() (string, string, string, string) {
 	f, err := getFromFileTrimmed(filepath.Join(m.root, "sys/class/dmi/id/product_family"))
 	if err != nil {
 		log.Infof("couldn't get sys product family information: "+utils.ErrFormat, err)
+		m.diag.failed(err)
 	}
 	if strings.Contains(f, "\n") {
 		log.Infof(utils.ErrFormat, errors.Errorf("malformed sys product family information, file contains: %s", f))
@@ -99,6 +112,7 @@ func (m Metrics) getBIOS() (string, string) {
 	vd, err := getFromFileTrimmed(filepath.Join(m.root, "sys/class/dmi/id/bios_vendor"))
 	if err != nil {
 		log.Infof("couldn't get bios vendor information: "+utils.ErrFormat, err)
+		m.diag.failed(err)
 		vd = ""
 	}
 	if strings.Contains(vd, "\n") {
@@ -108,6 +122,7 @@ func (m Metrics) getBIOS() (string, string) {
 	ve, err := getFromFileTrimmed(filepath.Join(m.root, "sys/class/dmi/id/bios_version"))
 	if err != nil {
 		log.Infof("couldn't get bios version: "+utils.ErrFormat, err)
+		m.diag.failed(err)
 		ve = ""
 	}
 	if strings.Contains(ve, "\n") {
@@ -131,6 +146,7 @@ func (m Metrics) getDisks() []float64 {
 	dirs, err := ioutil.ReadDir(blockFolder)
 	if err != nil {
 		log.Infof("couldn't get disk block information: "+utils.ErrFormat, err)
+		m.diag.failed(err)
 		return nil
 	}
 
@@ -142,22 +158,26 @@ func (m Metrics) getDisks() []float64 {
 		v, err := getFromFileTrimmed(filepath.Join(blockFolder, d.Name(), "size"))
 		if err != nil {
 			log.Infof("couldn't get disk block information for %s: "+utils.ErrFormat, d.Name(), err)
+			m.diag.failed(err)
 			continue
 		}
 		s, err := strconv.Atoi(v)
 		if err != nil {
 			log.Infof("number of block for disk %s isn't an integer: "+utils.ErrFormat, d.Name(), err)
+			m.diag.failed(err)
 			continue
 		}
 
 		v, err = getFromFileTrimmed(filepath.Join(blockFolder, d.Name(), "queue/logical_block_size"))
 		if err != nil {
 			log.Infof("couldn't get disk block information for %s: "+utils.ErrFormat, d.Name(), err)
+			m.diag.failed(err)
 			continue
 		}
 		bs, err := strconv.Atoi(v)
 		if err != nil {
 			log.Infof("block size for disk %s isn't an integer: "+utils.ErrFormat, d.Name(), err)
+			m.diag.failed(err)
 			continue
 		}
 
@@ -172,11 +192,11 @@ func (m Metrics) getDisks() []float64 {
 }
 
 func (m Metrics) installerInfo() json.RawMessage {
-	return getAndValidateJSONFromFile(filepath.Join(m.root, installerLogsPath), "install")
+	return m.getAndValidateJSONFromFile(filepath.Join(m.root, installerLogsPath), "install")
 }
 
 func (m Metrics) upgradeInfo() json.RawMessage {
-	return getAndValidateJSONFromFile(filepath.Join(m.root, upgradeLogsPath), "upgrade")
+	return m.getAndValidateJSONFromFile(filepath.Join(m.root, upgradeLogsPath), "upgrade")
 }
 
 func matchFromFile(p, regex string, notFoundOk bool) (string, error) {
@@ -212,14 +232,16 @@ func getFromFileTrimmed(p string) (string, error) {
 	return strings.TrimSpace(string(b)), nil
 }
 
-func getAndValidateJSONFromFile(p string, errmsg string) json.RawMessage {
+func (m Metrics) getAndValidateJSONFromFile(p string, errmsg string) json.RawMessage {
 	b, err := getFromFile(p)
 	if err != nil {
 		log.Infof("no %s data found: "+utils.ErrFormat, errmsg, err)
+		m.diag.failed(err)
 		return nil
 	}
 	if !json.Valid(b) {
 		log.Infof("%s data found, but not valid json.", errmsg)
+		m.diag.failed(errors.Errorf("%s isn't valid json", p))
 		return nil
 	}
 	return json.RawMessage(b)
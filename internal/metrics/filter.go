@@ -51,7 +51,7 @@ func filter(r io.Reader, regex string, getAll bool) <-chan filterResult {
 func filterFirst(r io.Reader, regex string, notFoundOk bool) (string, error) {
 	result := <-filter(r, regex, false)
 	if !notFoundOk && result.err == nil && len(result.r) < 1 {
-		result.err = errors.Errorf("couldn't find any line matching %s", regex)
+		result.err = noMatchError{regex}
 	}
 	if len(result.r) < 1 {
 		result.r = []string{""}
@@ -69,7 +69,7 @@ func filterAll(r io.Reader, regex string) ([]string, error) {
 	}
 
 	if len(results) < 1 {
-		return nil, errors.Errorf("couldn't find any line matching %s", regex)
+		return nil, noMatchError{regex}
 	}
 
 	return results, nil
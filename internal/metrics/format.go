@@ -0,0 +1,354 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Formats are the formats a report can be rendered in
+var Formats = []string{"json", "yaml", "table", "env", "html"}
+
+// envPrefix prefixes variable names in env format, so that fields like Language don't clash with the environment
+const envPrefix = "UBUNTU_REPORT_"
+
+// object is a json object keeping the order of its members
+type object []member
+
+type member struct {
+	key   string
+	value interface{}
+}
+
+// MarshalJSON keeps members in order
+func (o object) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, m := range o {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		k, err := json.Marshal(m.key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(m.value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(k)
+		b.WriteByte(':')
+		b.Write(v)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// MarshalYAML keeps members in order
+func (o object) MarshalYAML() (interface{}, error) {
+	s := make(yaml.MapSlice, 0, len(o))
+	for _, m := range o {
+		s = append(s, yaml.MapItem{Key: m.key, Value: m.value})
+	}
+	return s, nil
+}
+
+// entry is a leaf of the report, with its path like GPU[0].Vendor
+type entry struct {
+	path  string
+	value string
+}
+
+// Format renders a report, as returned by Collect, in format. If field isn't empty, only this field is
+// rendered. It can be a path, like CPU.Name or GPU[0].Vendor, or a JSON pointer, like /GPU/0/Vendor.
+func Format(report []byte, format, field string) ([]byte, error) {
+	var r metrics
+	if err := json.Unmarshal(report, &r); err != nil {
+		return nil, errors.Wrapf(err, "report isn't valid")
+	}
+	tree, err := toTree(reflect.ValueOf(r))
+	if err != nil {
+		return nil, err
+	}
+
+	path := ""
+	if field != "" {
+		if tree, path, err = selectField(tree, field); err != nil {
+			return nil, err
+		}
+	}
+
+	switch format {
+	case "json":
+		b, err := json.MarshalIndent(tree, "", "  ")
+		return b, errors.Wrapf(err, "couldn't render report as json")
+	case "yaml":
+		b, err := yaml.Marshal(tree)
+		return bytes.TrimSuffix(b, []byte("\n")), errors.Wrapf(err, "couldn't render report as yaml")
+	case "table":
+		return formatTable(flatten(tree, path)), nil
+	case "env":
+		return formatEnv(flatten(tree, path)), nil
+	case "html":
+		return formatHTML(flatten(tree, path))
+	}
+	return nil, errors.Errorf("unknown format %q, expected one of %s", format, strings.Join(Formats, ", "))
+}
+
+// toTree converts v, from the typed report, to ordered objects, lists and scalars following json
+// encoding rules. New fields of the report are then rendered in every format.
+func toTree(v reflect.Value) (interface{}, error) {
+	if v.Type() == reflect.TypeOf(json.RawMessage{}) {
+		return decodeOrdered(v.Bytes())
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return toTree(v.Elem())
+	case reflect.Struct:
+		var o object
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			name, omitEmpty := jsonName(f)
+			if name == "-" || (omitEmpty && isEmptyValue(v.Field(i))) {
+				continue
+			}
+			value, err := toTree(v.Field(i))
+			if err != nil {
+				return nil, err
+			}
+			o = append(o, member{name, value})
+		}
+		return o, nil
+	case reflect.Slice, reflect.Array:
+		l := make([]interface{}, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			e, err := toTree(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, e)
+		}
+		return l, nil
+	}
+	return v.Interface(), nil
+}
+
+// jsonName returns the name of f in json and if it's omitted when empty
+func jsonName(f reflect.StructField) (string, bool) {
+	tag := strings.Split(f.Tag.Get("json"), ",")
+	name := f.Name
+	if tag[0] != "" {
+		name = tag[0]
+	}
+	for _, opt := range tag[1:] {
+		if opt == "omitempty" {
+			return name, true
+		}
+	}
+	return name, false
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+// decodeOrdered decodes free-form json, like installer data, keeping the order of object members
+func decodeOrdered(b []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	v, err := decodeValue(dec)
+	return v, errors.Wrapf(err, "couldn't decode %s", b)
+}
+
+func decodeValue(dec *json.Decoder) (interface{}, error) {
+	t, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t {
+	case json.Delim('{'):
+		var o object
+		for dec.More() {
+			k, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			v, err := decodeValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			o = append(o, member{k.(string), v})
+		}
+		_, err := dec.Token()
+		return o, err
+	case json.Delim('['):
+		l := []interface{}{}
+		for dec.More() {
+			v, err := decodeValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, v)
+		}
+		_, err := dec.Token()
+		return l, err
+	}
+	return t, nil
+}
+
+var listElem = regexp.MustCompile(`^(.*)\[(\d+)\]$`)
+
+// selectField returns the value of field in tree, alongside its path like GPU[0].Vendor.
+// Paths are case insensitive, JSON pointers aren't.
+func selectField(tree interface{}, field string) (interface{}, string, error) {
+	var tokens []string
+	pointer := strings.HasPrefix(field, "/")
+	if pointer {
+		for _, t := range strings.Split(field[1:], "/") {
+			tokens = append(tokens, strings.NewReplacer("~1", "/", "~0", "~").Replace(t))
+		}
+	} else {
+		for _, t := range strings.Split(field, ".") {
+			var indexes []string
+			for m := listElem.FindStringSubmatch(t); m != nil; m = listElem.FindStringSubmatch(t) {
+				t = m[1]
+				indexes = append([]string{m[2]}, indexes...)
+			}
+			tokens = append(append(tokens, t), indexes...)
+		}
+	}
+
+	v := tree
+	path := ""
+	for _, t := range tokens {
+		switch n := v.(type) {
+		case object:
+			found := false
+			for _, m := range n {
+				if m.key == t || (!pointer && strings.EqualFold(m.key, t)) {
+					v, path, found = m.value, joinPath(path, m.key), true
+					break
+				}
+			}
+			if !found {
+				return nil, "", errors.Errorf("%s isn't in the report", field)
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(t)
+			if err != nil || i < 0 || i >= len(n) {
+				return nil, "", errors.Errorf("%s isn't in the report", field)
+			}
+			v, path = n[i], fmt.Sprintf("%s[%d]", path, i)
+		default:
+			return nil, "", errors.Errorf("%s isn't in the report", field)
+		}
+	}
+	return v, path, nil
+}
+
+func joinPath(parent, key string) string {
+	if parent == "" {
+		return key
+	}
+	return parent + "." + key
+}
+
+// flatten returns every leaf of tree, in report order, prefixed by path
+func flatten(tree interface{}, path string) []entry {
+	switch n := tree.(type) {
+	case object:
+		var entries []entry
+		for _, m := range n {
+			entries = append(entries, flatten(m.value, joinPath(path, m.key))...)
+		}
+		return entries
+	case []interface{}:
+		var entries []entry
+		for i, e := range n {
+			entries = append(entries, flatten(e, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+		return entries
+	case nil:
+		return []entry{{path, ""}}
+	case float64:
+		return []entry{{path, strconv.FormatFloat(n, 'f', -1, 64)}}
+	}
+	return []entry{{path, fmt.Sprint(tree)}}
+}
+
+func formatTable(entries []entry) []byte {
+	var b bytes.Buffer
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FIELD\tVALUE")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s\t%s\n", e.path, e.value)
+	}
+	w.Flush()
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n"))
+}
+
+var envInvalidChars = regexp.MustCompile(`[^A-Z0-9]+`)
+
+// formatEnv renders entries as shell variable assignments, like UBUNTU_REPORT_GPU_0_VENDOR='8086'
+func formatEnv(entries []entry) []byte {
+	var lines []string
+	for _, e := range entries {
+		name := strings.Trim(envInvalidChars.ReplaceAllString(strings.ToUpper(e.path), "_"), "_")
+		value := "'" + strings.Replace(e.value, "'", `'\''`, -1) + "'"
+		lines = append(lines, envPrefix+name+"="+value)
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+var htmlTable = template.Must(template.New("report").Parse(`<table class="ubuntu-report">
+  <thead>
+    <tr><th>Field</th><th>Value</th></tr>
+  </thead>
+  <tbody>
+{{- range .}}
+    <tr><th scope="row">{{.Path}}</th><td>{{.Value}}</td></tr>
+{{- end}}
+  </tbody>
+</table>`))
+
+// formatHTML renders entries as an html table, to be embedded by graphical front-ends
+func formatHTML(entries []entry) ([]byte, error) {
+	rows := make([]struct{ Path, Value string }, 0, len(entries))
+	for _, e := range entries {
+		rows = append(rows, struct{ Path, Value string }{e.path, e.value})
+	}
+	var b bytes.Buffer
+	if err := htmlTable.Execute(&b, rows); err != nil {
+		return nil, errors.Wrapf(err, "couldn't render report as html")
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,86 @@
+package metrics_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/ubuntu/ubuntu-report/internal/helper"
+	"github.com/ubuntu/ubuntu-report/internal/metrics"
+)
+
+func TestFormat(t *testing.T) {
+	t.Parallel()
+
+	report, err := ioutil.ReadFile(filepath.Join("testdata", "good", "gold", "collect"))
+	if err != nil {
+		t.Fatal("couldn't read report:", err)
+	}
+
+	for _, format := range metrics.Formats {
+		format := format // capture range variable for parallel execution
+		t.Run(format, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			got, err := metrics.Format(report, format, "")
+
+			want := helper.LoadOrUpdateGolden(t, filepath.Join("testdata", "good", "gold", "format."+format), got, *metrics.Update)
+			a.CheckWantedErr(err, false)
+			a.Equal(string(got), string(want))
+		})
+	}
+}
+
+func TestFormatField(t *testing.T) {
+	t.Parallel()
+
+	report, err := ioutil.ReadFile(filepath.Join("testdata", "good", "gold", "collect"))
+	if err != nil {
+		t.Fatal("couldn't read report:", err)
+	}
+
+	testCases := []struct {
+		name   string
+		format string
+		field  string
+
+		want    string
+		wantErr bool
+	}{
+		{"path", "json", "CPU.Name", `"Intuis Corus i5-8300H CPU @ 2.30GHz"`, false},
+		{"case insensitive path", "json", "cpu.name", `"Intuis Corus i5-8300H CPU @ 2.30GHz"`, false},
+		{"list element", "env", "GPU[0].Vendor", "UBUNTU_REPORT_GPU_0_VENDOR='8086'", false},
+		{"json pointer", "env", "/GPU/0/Vendor", "UBUNTU_REPORT_GPU_0_VENDOR='8086'", false},
+		{"section", "table", "Session", "FIELD         VALUE\nSession.DE    some:thing\nSession.Name  ubuntusession\nSession.Type  x12", false},
+		{"list", "yaml", "Disks", "- 240.1", false},
+		{"number", "json", "RAM", "8", false},
+		{"installer data", "env", "Install.Stages.829", "UBUNTU_REPORT_INSTALL_STAGES_829='done'", false},
+		{"value is escaped in html", "html", "Install.Media", `<table class="ubuntu-report">
+  <thead>
+    <tr><th>Field</th><th>Value</th></tr>
+  </thead>
+  <tbody>
+    <tr><th scope="row">Install.Media</th><td>Ubuntu 18.04 LTS &#34;Bionic Beaver&#34; - Alpha amd64 (20180305)</td></tr>
+  </tbody>
+</table>`, false},
+
+		{"unknown field", "json", "CPU.Serial", "", true},
+		{"json pointer is case sensitive", "json", "/cpu/name", "", true},
+		{"out of range element", "json", "GPU[1]", "", true},
+		{"field of a value", "json", "RAM.Size", "", true},
+		{"unknown format", "xml", "", "", true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			got, err := metrics.Format(report, tc.format, tc.field)
+
+			a.CheckWantedErr(err, tc.wantErr)
+			a.Equal(string(got), tc.want)
+		})
+	}
+}
@@ -2,10 +2,12 @@ package metrics
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"os/exec"
 	"path"
 	"path/filepath"
+	"reflect"
 	"testing"
 
 	"github.com/ubuntu/ubuntu-report/internal/helper"
@@ -613,3 +615,56 @@ func newMockShortCmd(t *testing.T, s ...string) (*exec.Cmd, context.CancelFunc)
 	t.Helper()
 	return helper.ShortProcess(t, "TestMetricsHelperProcess", s...)
 }
+
+func TestFieldsDescribeWholeReport(t *testing.T) {
+	t.Parallel()
+
+	var want []string
+	collectFields("", reflect.TypeOf(metrics{}), &want)
+
+	var got []string
+	for _, f := range fields {
+		got = append(got, f.Field)
+		if f.Source == "" || f.Purpose == "" || f.Privacy == "" {
+			t.Errorf("%s should have a source, a purpose and privacy notes", f.Field)
+		}
+	}
+	helper.Asserter{T: t}.Equal(got, want)
+}
+
+// collectFields appends to fields the path of every field of t, in order.
+// Elements of lists share the same path.
+func collectFields(path string, t reflect.Type, fields *[]string) {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice && t != reflect.TypeOf(json.RawMessage{}) {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		*fields = append(*fields, path)
+		return
+	}
+	for i := 0; i < t.NumField(); i++ {
+		p := t.Field(i).Name
+		if path != "" {
+			p = path + "." + p
+		}
+		collectFields(p, t.Field(i).Type, fields)
+	}
+}
+
+func TestSectionsCoverWholeReport(t *testing.T) {
+	t.Parallel()
+
+	var want []string
+	typ := reflect.TypeOf(metrics{})
+	for i := 0; i < typ.NumField(); i++ {
+		if n := typ.Field(i).Name; n != "Version" && n != "Variant" {
+			want = append(want, typ.Field(i).Name)
+		}
+	}
+
+	var got []string
+	for _, s := range Sections {
+		got = append(got, sectionFields[s]...)
+	}
+	helper.Asserter{T: t}.Equal(got, want)
+}
@@ -21,12 +21,12 @@ func parseJSON(r io.Reader, v any) (any, error) {
 	// Read the entire content of the io.Reader first to check for errors even if valid json is first
 	buf, err := io.ReadAll(r)
 	if err != nil {
-		return nil, errors.Errorf("error reading from io.Reader: %v", err)
+		return nil, errors.Wrap(err, "error reading from io.Reader")
 	}
 
 	err = json.Unmarshal(buf, v)
 	if err != nil {
-		return nil, errors.Errorf("couldn't parse JSON: %v", err)
+		return nil, errors.Wrap(err, "couldn't parse JSON")
 	}
 	return v, nil
 }
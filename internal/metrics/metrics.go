@@ -1,19 +1,18 @@
 package metrics
 
 import (
-	"bufio"
 	"bytes"
 	"encoding/json"
 	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"regexp"
 	"strconv"
 	"strings"
 
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	"github.com/ubuntu/ubuntu-report/internal/i18n"
 	"github.com/ubuntu/ubuntu-report/internal/utils"
 )
 
@@ -22,6 +21,9 @@ const (
 	upgradeLogsPath   = "var/log/upgrade/telemetry"
 )
 
+// SchemaVersion is the version of the report format. Servers can refuse older formats.
+const SchemaVersion = 1
+
 // Metrics collect system, upgrade and installer data
 type Metrics struct {
 	root          string
@@ -33,6 +35,14 @@ type Metrics struct {
 	libc6Cmd      *exec.Cmd
 	hwCapCmd      *exec.Cmd
 	getenv        GetenvFn
+	// variant, if set, is the product variant requested instead of the detected one
+	variant string
+	// derivatives map os-release IDs to the distribution reports are sent for
+	derivatives map[string]string
+	// previousRelease, if set, is the release the system was upgraded from
+	previousRelease *PreviousRelease
+	// diag, if set, records how each section of the report is collected
+	diag *diagnostics
 }
 
 // New return a new metrics element with optional testing functions
@@ -61,34 +71,15 @@ func New(options ...func(*Metrics) error) (Metrics, error) {
 	return m, nil
 }
 
-// GetIDS returns distro and version information
+// GetIDS returns distro and version information from os-release. Derivatives are reported as the
+// distribution they are mapped to with WithDerivatives.
 func (m Metrics) GetIDS() (string, string, error) {
-	p := filepath.Join(m.root, "etc", "os-release")
-	f, err := os.Open(p)
+	r, err := m.GetOSRelease()
 	if err != nil {
-		return "", "", errors.Wrapf(err, "couldn't open %s", p)
-	}
-	defer f.Close()
-
-	scanner := bufio.NewScanner(f)
-	dRe := regexp.MustCompile(`^ID=(.*)$`)
-	vRe := regexp.MustCompile(`^VERSION_ID="(.*)"$`)
-	var distro, version string
-	for scanner.Scan() {
-		v := dRe.FindStringSubmatch(scanner.Text())
-		if v != nil {
-			distro = strings.TrimSpace(v[1])
-		}
-		v = vRe.FindStringSubmatch(scanner.Text())
-		if v != nil {
-			version = strings.TrimSpace(v[1])
-		}
-	}
-
-	if err := scanner.Err(); (distro == "" || version == "") && err != nil {
-		return "", "", errors.Wrap(err, "error while scanning")
+		return "", "", err
 	}
 
+	distro, version := m.ids(r)
 	if distro == "" || version == "" {
 		return "", "", errors.Errorf("distribution '%s' or version '%s' information missing", distro, version)
 	}
@@ -96,6 +87,28 @@ func (m Metrics) GetIDS() (string, string, error) {
 	return distro, version, nil
 }
 
+// CommandStatus tells if a command metrics are collected from can be run
+type CommandStatus struct {
+	Name string
+	// Path is where the command was found
+	Path string
+	// Err is why the command can't be run, if so
+	Err error
+}
+
+// CheckCommands returns if each command metrics are collected from can be run, without running them
+func (m Metrics) CheckCommands() []CommandStatus {
+	var r []CommandStatus
+	for _, cmd := range []*exec.Cmd{m.gpuInfoCmd, m.cpuInfoCmd, m.screenInfoCmd, m.spaceInfoCmd, m.archCmd, m.hwCapCmd} {
+		// hwcap command isn't available on every architecture
+		if cmd == nil {
+			continue
+		}
+		r = append(r, CommandStatus{Name: filepath.Base(cmd.Args[0]), Path: cmd.Path, Err: cmd.Err})
+	}
+	return r
+}
+
 func setCommand(cmds ...string) *exec.Cmd {
 	if len(cmds) == 1 {
 		return exec.Command(cmds[0])
@@ -105,74 +118,137 @@ func setCommand(cmds ...string) *exec.Cmd {
 
 // Collect system, installer and update info, returning a json formatted byte
 func (m Metrics) Collect() ([]byte, error) {
+	d, _, err := m.CollectWithDiagnostics()
+	return d, err
+}
+
+// CollectWithDiagnostics collects system, installer and update info, returning a json formatted byte
+// alongside how each section of the report was collected
+func (m Metrics) CollectWithDiagnostics() ([]byte, []Diagnostic, error) {
 	log.Debugf("Collecting metrics on system with root set to %s", m.root)
 	r := metrics{}
+	m.diag = &diagnostics{}
 
-	r.Version = m.getVersion()
+	m.diag.section("Version", func() bool {
+		r.Version = m.getVersion()
+		return r.Version != ""
+	})
 
-	if vendor, product, family, dcd := m.getOEM(); vendor != "" || product != "" {
-		r.OEM = &struct {
-			Vendor  string
-			Product string
-			Family  string
-			DCD     string `json:",omitempty"`
-		}{vendor, product, family, dcd}
-	}
-	if vendor, version := m.getBIOS(); vendor != "" || version != "" {
-		r.BIOS = &struct {
-			Vendor  string
-			Version string
-		}{vendor, version}
-	}
+	m.diag.section("Variant", func() bool {
+		r.Variant = m.GetVariant()
+		return true
+	})
 
-	cpu := m.getCPU()
-	if cpu != (cpuInfo{}) {
-		r.CPU = &cpu
-	} else {
-		r.CPU = nil
-	}
-	r.Arch = m.getArch()
-	r.GPU = m.getGPU()
-	r.RAM = m.getRAM()
-	r.Disks = m.getDisks()
-	r.Partitions = m.getPartitions()
-	r.Screens = m.getScreens()
-	r.HwCap = m.getHwCap()
-
-	a := m.getAutologin()
-	r.Autologin = &a
-	l := m.getLivePatch()
-	r.LivePatch = &l
-
-	de := m.getenv("XDG_CURRENT_DESKTOP")
-	sessionName := m.getenv("XDG_SESSION_DESKTOP")
-	sessionType := m.getenv("XDG_SESSION_TYPE")
-	if de != "" || sessionName != "" || sessionType != "" {
-		r.Session = &struct {
-			DE   string
-			Name string
-			Type string
-		}{de, sessionName, sessionType}
-	}
-	r.Language = m.getLanguage()
-	r.Timezone = m.getTimeZone()
+	m.diag.section("OEM", func() bool {
+		if vendor, product, family, dcd := m.getOEM(); vendor != "" || product != "" {
+			r.OEM = &struct {
+				Vendor  string
+				Product string
+				Family  string
+				DCD     string `json:",omitempty"`
+			}{vendor, product, family, dcd}
+		}
+		return r.OEM != nil
+	})
+	m.diag.section("BIOS", func() bool {
+		if vendor, version := m.getBIOS(); vendor != "" || version != "" {
+			r.BIOS = &struct {
+				Vendor  string
+				Version string
+			}{vendor, version}
+		}
+		return r.BIOS != nil
+	})
 
-	r.Install = m.installerInfo()
-	r.Upgrade = m.upgradeInfo()
+	m.diag.section("CPU", func() bool {
+		cpu := m.getCPU()
+		if cpu != (cpuInfo{}) {
+			r.CPU = &cpu
+		} else {
+			r.CPU = nil
+		}
+		return r.CPU != nil
+	})
+	m.diag.section("Arch", func() bool {
+		r.Arch = m.getArch()
+		return r.Arch != ""
+	})
+	m.diag.section("GPU", func() bool {
+		r.GPU = m.getGPU()
+		return len(r.GPU) > 0
+	})
+	m.diag.section("RAM", func() bool {
+		r.RAM = m.getRAM()
+		return r.RAM != nil
+	})
+	m.diag.section("Disks", func() bool {
+		r.Disks = m.getDisks()
+		return len(r.Disks) > 0
+	})
+	m.diag.section("Partitions", func() bool {
+		r.Partitions = m.getPartitions()
+		return len(r.Partitions) > 0
+	})
+	m.diag.section("Screens", func() bool {
+		r.Screens = m.getScreens()
+		return len(r.Screens) > 0
+	})
+	m.diag.section("HwCap", func() bool {
+		r.HwCap = m.getHwCap()
+		return r.HwCap != ""
+	})
+
+	// both are reported as disabled when their files are missing
+	m.diag.section("Autologin", func() bool {
+		a := m.getAutologin()
+		r.Autologin = &a
+		return true
+	})
+	m.diag.section("LivePatch", func() bool {
+		l := m.getLivePatch()
+		r.LivePatch = &l
+		return true
+	})
+
+	m.diag.section("Session", func() bool {
+		de := m.getenv("XDG_CURRENT_DESKTOP")
+		sessionName := m.getenv("XDG_SESSION_DESKTOP")
+		sessionType := m.getenv("XDG_SESSION_TYPE")
+		if de != "" || sessionName != "" || sessionType != "" {
+			r.Session = &struct {
+				DE   string
+				Name string
+				Type string
+			}{de, sessionName, sessionType}
+		}
+		return r.Session != nil
+	})
+	m.diag.section("Language", func() bool {
+		r.Language = m.getLanguage()
+		return r.Language != ""
+	})
+	m.diag.section("Timezone", func() bool {
+		r.Timezone = m.getTimeZone()
+		return r.Timezone != ""
+	})
+
+	m.diag.section("Install", func() bool {
+		r.Install = m.installerInfo()
+		return r.Install != nil
+	})
+	m.diag.section("Upgrade", func() bool {
+		r.Upgrade = m.upgradeInfo()
+		return r.Upgrade != nil
+	})
+	// only known by the caller when reporting an upgrade, nothing is collected
+	r.PreviousRelease = m.previousRelease
 
 	d, err := json.Marshal(r)
-	return d, errors.Wrapf(err, "can't be converted to a valid json")
+	return d, m.diag.diagnostics, errors.Wrapf(err, "can't be converted to a valid json")
 }
 
 func (m Metrics) getLanguage() string {
-	lang := m.getenv("LC_ALL")
-	if lang == "" {
-		lang = m.getenv("LANG")
-	}
-	if lang == "" {
-		lang = strings.Split(m.getenv("LANGUAGE"), ":")[0]
-	}
-	return strings.Split(lang, ".")[0]
+	return i18n.Language(m.getenv)
 }
 
 func convKBToGB(s string) (float64, error) {
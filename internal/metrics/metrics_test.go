@@ -116,6 +116,109 @@ func TestCollect(t *testing.T) {
 	}
 }
 
+func TestCollectWithDiagnostics(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name    string
+		root    string
+		caseCmd string
+		env     map[string]string
+
+		want         map[string]metrics.DiagnosticStatus
+		wantExitCode int
+	}{
+		{"regular", "testdata/good", "regular",
+			map[string]string{"XDG_CURRENT_DESKTOP": "some:thing", "LANG": "fr_FR.UTF-8"},
+			map[string]metrics.DiagnosticStatus{"Version": metrics.DiagnosticOK, "CPU": metrics.DiagnosticOK, "RAM": metrics.DiagnosticOK,
+				"Session": metrics.DiagnosticOK, "Language": metrics.DiagnosticOK, "Install": metrics.DiagnosticOK}, 0},
+		{"empty", "testdata/none", "empty", nil,
+			map[string]metrics.DiagnosticStatus{"Version": metrics.DiagnosticMissing, "GPU": metrics.DiagnosticMissing, "RAM": metrics.DiagnosticMissing,
+				"Screens": metrics.DiagnosticMissing, "HwCap": metrics.DiagnosticSkipped, "Autologin": metrics.DiagnosticOK,
+				"Session": metrics.DiagnosticMissing, "Install": metrics.DiagnosticMissing}, 0},
+		{"failing commands", "testdata/good", "fail", nil,
+			map[string]metrics.DiagnosticStatus{"Version": metrics.DiagnosticOK, "GPU": metrics.DiagnosticError, "Screens": metrics.DiagnosticError,
+				"Partitions": metrics.DiagnosticError, "Arch": metrics.DiagnosticError}, 1},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			cmdGPU, cancel := newMockShortCmd(t, "lspci", "-n", tc.caseCmd)
+			defer cancel()
+			cmdCPU, cancel := newMockShortCmd(t, "lscpu", "-J", tc.caseCmd)
+			defer cancel()
+			cmdScreen, cancel := newMockShortCmd(t, "xrandr", tc.caseCmd)
+			defer cancel()
+			cmdPartition, cancel := newMockShortCmd(t, "df", tc.caseCmd)
+			defer cancel()
+			cmdArchitecture, cancel := newMockShortCmd(t, "dpkg", "--print-architecture", tc.caseCmd)
+			defer cancel()
+			cmdLibc6, cancel := newMockShortCmd(t, "dpkg", "--status", "libc6", tc.caseCmd)
+			defer cancel()
+			cmdHwCap, cancel := newMockShortCmd(t, "/lib/x86_64-linux-gnu/ld-linux-x86-64.so.2", "--help", tc.caseCmd)
+			defer cancel()
+
+			m := newTestMetrics(t, metrics.WithRootAt(tc.root),
+				metrics.WithGPUInfoCommand(cmdGPU),
+				metrics.WithCPUInfoCommand(cmdCPU),
+				metrics.WithScreenInfoCommand(cmdScreen),
+				metrics.WithSpaceInfoCommand(cmdPartition),
+				metrics.WithArchitectureCommand(cmdArchitecture),
+				metrics.WithHwCapCommand(cmdHwCap),
+				metrics.WithLibc6Command(cmdLibc6),
+				metrics.WithMapForEnv(tc.env))
+			_, diags, err := m.CollectWithDiagnostics()
+
+			a.CheckWantedErr(err, false)
+			got := make(map[string]metrics.Diagnostic)
+			for _, d := range diags {
+				got[d.Section] = d
+			}
+			a.Equal(len(got), len(diags))
+			for section, want := range tc.want {
+				d, ok := got[section]
+				if !ok {
+					t.Fatalf("no diagnostic for %s in %+v", section, diags)
+				}
+				a.Equal(d.Status, want)
+				if want != metrics.DiagnosticOK && d.Reason == "" {
+					t.Errorf("we expected a reason for %s to be %s", section, want)
+				}
+				if want == metrics.DiagnosticError && tc.wantExitCode != 0 {
+					if d.ExitCode == nil {
+						t.Fatalf("we expected an exit code for %s, got: %+v", section, d)
+					}
+					a.Equal(*d.ExitCode, tc.wantExitCode)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckCommands(t *testing.T) {
+	t.Parallel()
+
+	cmdGPU, cancel := newMockShortCmd(t, "lspci", "-n", "one gpu")
+	defer cancel()
+	m := newTestMetrics(t, metrics.WithGPUInfoCommand(cmdGPU),
+		metrics.WithScreenInfoCommand(exec.Command("ubuntu-report-doesnt-exist")))
+
+	got := make(map[string]error)
+	for _, c := range m.CheckCommands() {
+		got[c.Name] = c.Err
+	}
+
+	if err, ok := got["ubuntu-report-doesnt-exist"]; !ok || err == nil {
+		t.Errorf("we expected a missing command to be reported, got: %v", got)
+	}
+	if err := got[filepath.Base(cmdGPU.Args[0])]; err != nil {
+		t.Errorf("we expected an existing command to be runnable, got: %v", err)
+	}
+}
+
 func TestRunCollectTwice(t *testing.T) {
 	t.Parallel()
 
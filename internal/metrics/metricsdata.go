@@ -4,6 +4,7 @@ import "encoding/json"
 
 type metrics struct {
 	Version string `json:",omitempty"`
+	Variant string `json:",omitempty"`
 
 	OEM *struct {
 		Vendor  string
@@ -36,6 +37,8 @@ type metrics struct {
 
 	Install json.RawMessage `json:",omitempty"`
 	Upgrade json.RawMessage `json:",omitempty"`
+
+	PreviousRelease *PreviousRelease `json:",omitempty"`
 }
 
 type gpuInfo struct {
@@ -0,0 +1,251 @@
+package metrics
+
+import (
+	"bufio"
+	"encoding/csv"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// osReleasePaths are where os-release is looked for, in order, as described in os-release(5)
+var osReleasePaths = []string{"etc/os-release", "usr/lib/os-release"}
+
+// osReleaseKeyRe matches valid os-release variable names
+var osReleaseKeyRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// distroInfoDir is where distro-info lists the releases of each distribution, as <distro>.csv
+const distroInfoDir = "usr/share/distro-info"
+
+// OSRelease is the operating system identification from os-release
+type OSRelease struct {
+	ID string
+	// IDLike are the distributions this one is derived from, closest first
+	IDLike          []string
+	VersionID       string
+	VersionCodename string
+	VariantID       string
+	BuildID         string
+	// Codenames are the codenames of the releases this one is based on, by distribution, like UBUNTU_CODENAME
+	Codenames map[string]string
+}
+
+// WithDerivatives reports derivatives as the distribution they are mapped to. Keys are matched against
+// ID then ID_LIKE entries of os-release, like {"pop": "ubuntu"} or {"ubuntu": "ubuntu"} for every
+// derivative of Ubuntu. They are reported as the release they are based on, from <DISTRO>_CODENAME or
+// VERSION_CODENAME of os-release and the releases listed by distro-info. Derivatives whose base release
+// can't be found keep reporting as themselves.
+func WithDerivatives(d map[string]string) func(*Metrics) error {
+	return func(m *Metrics) error {
+		for id, distro := range d {
+			if id == "" || distro == "" {
+				return errors.Errorf("invalid derivative mapping %q: %q", id, distro)
+			}
+		}
+		m.derivatives = d
+		return nil
+	}
+}
+
+// GetOSRelease returns the operating system identification from /etc/os-release,
+// or /usr/lib/os-release if the former doesn't exist.
+func (m Metrics) GetOSRelease() (OSRelease, error) {
+	var paths []string
+	var notFound error
+	for _, p := range osReleasePaths {
+		p = filepath.Join(m.root, p)
+		f, err := os.Open(p)
+		if os.IsNotExist(err) {
+			paths = append(paths, p)
+			if notFound == nil {
+				notFound = err
+			}
+			continue
+		} else if err != nil {
+			return OSRelease{}, errors.Wrapf(err, "couldn't open %s", p)
+		}
+		defer f.Close()
+
+		vars, err := parseOSRelease(f)
+		if err != nil {
+			return OSRelease{}, errors.Wrapf(err, "couldn't read %s", p)
+		}
+		r := OSRelease{
+			ID:              vars["ID"],
+			VersionID:       vars["VERSION_ID"],
+			VersionCodename: vars["VERSION_CODENAME"],
+			VariantID:       vars["VARIANT_ID"],
+			BuildID:         vars["BUILD_ID"],
+		}
+		if like := strings.Fields(vars["ID_LIKE"]); len(like) > 0 {
+			r.IDLike = like
+		}
+		for k, v := range vars {
+			if !strings.HasSuffix(k, "_CODENAME") || k == "VERSION_CODENAME" || v == "" {
+				continue
+			}
+			if r.Codenames == nil {
+				r.Codenames = make(map[string]string)
+			}
+			r.Codenames[strings.ToLower(strings.TrimSuffix(k, "_CODENAME"))] = v
+		}
+		return r, nil
+	}
+	return OSRelease{}, errors.Wrapf(notFound, "neither %s exists", strings.Join(paths, " nor "))
+}
+
+// ids returns the distribution and version reports are sent for, taking derivatives mapping into account.
+// A derivative is only reported as the distribution it's mapped to if the release it's based on is known.
+func (m Metrics) ids(r OSRelease) (string, string) {
+	for _, id := range append([]string{r.ID}, r.IDLike...) {
+		distro, ok := m.derivatives[id]
+		if !ok {
+			continue
+		}
+		if distro == r.ID {
+			return r.ID, r.VersionID
+		}
+		version, err := m.baseRelease(r, distro)
+		if err != nil {
+			log.Warningf("reporting %s as itself rather than %s: %v", r.ID, distro, err)
+			return r.ID, r.VersionID
+		}
+		log.Debugf("reporting %s %s as %s %s, which it's based on", r.ID, r.VersionID, distro, version)
+		return distro, version
+	}
+	return r.ID, r.VersionID
+}
+
+// baseRelease returns the version of distro the derivative r is based on, from the codename of the base release
+// in os-release and the releases of distro listed by distro-info
+func (m Metrics) baseRelease(r OSRelease, distro string) (string, error) {
+	var codenames []string
+	for _, c := range []string{r.Codenames[distro], r.VersionCodename} {
+		if c != "" {
+			codenames = append(codenames, c)
+		}
+	}
+	if len(codenames) == 0 {
+		return "", errors.Errorf("os-release doesn't tell which %s release it's based on", distro)
+	}
+
+	p := filepath.Join(m.root, distroInfoDir, distro+".csv")
+	f, err := os.Open(p)
+	if err != nil {
+		return "", errors.Wrapf(err, "couldn't open %s releases", distro)
+	}
+	defer f.Close()
+	releases, err := parseDistroInfo(f)
+	if err != nil {
+		return "", errors.Wrapf(err, "couldn't read %s", p)
+	}
+	for _, c := range codenames {
+		if v, ok := releases[c]; ok {
+			return v, nil
+		}
+	}
+	return "", errors.Errorf("no %s release is named %s", distro, strings.Join(codenames, " nor "))
+}
+
+// parseDistroInfo returns the versions of the releases listed in a distro-info csv file, by series, like
+// "jammy": "22.04". Releases without version yet, like Debian testing, are skipped.
+func parseDistroInfo(r io.Reader) (map[string]string, error) {
+	cr := csv.NewReader(r)
+	// later columns are only set for some releases
+	cr.FieldsPerRecord = -1
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("no header")
+	}
+	versionI, seriesI := -1, -1
+	for i, c := range records[0] {
+		switch c {
+		case "version":
+			versionI = i
+		case "series":
+			seriesI = i
+		}
+	}
+	if versionI < 0 || seriesI < 0 {
+		return nil, errors.New("version or series column missing")
+	}
+
+	releases := make(map[string]string)
+	for _, rec := range records[1:] {
+		if len(rec) <= versionI || len(rec) <= seriesI {
+			continue
+		}
+		// like "22.04 LTS"
+		v := strings.Fields(rec[versionI])
+		if len(v) == 0 || rec[seriesI] == "" {
+			continue
+		}
+		releases[rec[seriesI]] = v[0]
+	}
+	return releases, nil
+}
+
+// parseOSRelease returns the variables assigned in r, following the shell-compatible syntax of os-release(5):
+// values can be unquoted, single or double quoted, with backslash escapes. Invalid lines are ignored.
+func parseOSRelease(r io.Reader) (map[string]string, error) {
+	vars := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.Index(line, "=")
+		if i < 0 || !osReleaseKeyRe.MatchString(line[:i]) {
+			log.Debugf("ignoring invalid os-release line: %s", line)
+			continue
+		}
+		v, err := unquoteOSReleaseValue(line[i+1:])
+		if err != nil {
+			log.Debugf("ignoring invalid os-release value of %s: %v", line[:i], err)
+			continue
+		}
+		vars[line[:i]] = v
+	}
+	return vars, errors.Wrap(scanner.Err(), "error while scanning")
+}
+
+// unquoteOSReleaseValue expands quotes and escapes of a shell-compatible value.
+// Only "\$", "\"", "\\" and "\`" are escapes in double quotes, nothing is in single quotes.
+func unquoteOSReleaseValue(s string) (string, error) {
+	var b strings.Builder
+	var quote rune
+	escaped := false
+	for _, c := range s {
+		switch {
+		case escaped:
+			if quote == '"' && !strings.ContainsRune("$\"\\`", c) {
+				b.WriteRune('\\')
+			}
+			b.WriteRune(c)
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped = true
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case c == quote:
+			quote = 0
+		case quote == 0 && (c == ' ' || c == '\t'):
+			return "", errors.New("unquoted whitespace")
+		default:
+			b.WriteRune(c)
+		}
+	}
+	if quote != 0 || escaped {
+		return "", errors.New("unterminated quote or escape")
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,144 @@
+package metrics_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ubuntu/ubuntu-report/internal/helper"
+	"github.com/ubuntu/ubuntu-report/internal/metrics"
+)
+
+func TestGetOSRelease(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name  string
+		files map[string]string
+
+		want    metrics.OSRelease
+		wantErr bool
+	}{
+		{"regular", map[string]string{"etc/os-release": "ID=ubuntu\nID_LIKE=debian\nVERSION_ID=\"18.04\"\nVERSION_CODENAME=bionic\n"},
+			metrics.OSRelease{ID: "ubuntu", IDLike: []string{"debian"}, VersionID: "18.04", VersionCodename: "bionic"}, false},
+		{"every field", map[string]string{"etc/os-release": "ID=pop\nID_LIKE=\"ubuntu debian\"\nVERSION_ID=\"22.04\"\n" +
+			"VERSION_CODENAME=jammy\nUBUNTU_CODENAME=jammy\nVARIANT_ID=server\nBUILD_ID=20230101\n"},
+			metrics.OSRelease{ID: "pop", IDLike: []string{"ubuntu", "debian"}, VersionID: "22.04", VersionCodename: "jammy",
+				VariantID: "server", BuildID: "20230101", Codenames: map[string]string{"ubuntu": "jammy"}}, false},
+		{"unquoted values", map[string]string{"etc/os-release": "ID=ubuntu\nVERSION_ID=18.04\n"},
+			metrics.OSRelease{ID: "ubuntu", VersionID: "18.04"}, false},
+		{"single quoted values", map[string]string{"etc/os-release": "ID='ubuntu'\nVERSION_ID='18.04'\n"},
+			metrics.OSRelease{ID: "ubuntu", VersionID: "18.04"}, false},
+		{"escapes", map[string]string{"etc/os-release": `ID="ub\"untu"` + "\n" + `VERSION_ID=18\.04` + "\n" + `BUILD_ID="a\\b\$c\d"` + "\n" +
+			`VARIANT_ID='a\b'` + "\n"},
+			metrics.OSRelease{ID: `ub"untu`, VersionID: "18.04", BuildID: `a\b$c\d`, VariantID: `a\b`}, false},
+		{"comments, blank and invalid lines are ignored", map[string]string{"etc/os-release": "# ID=debian\n\nID=ubuntu\n" +
+			"not an assignment\n1ID=debian\nVERSION_ID=\"unterminated\nVERSION_ID=18 04\n  VERSION_ID=\"18.04\"  \n"},
+			metrics.OSRelease{ID: "ubuntu", VersionID: "18.04"}, false},
+		{"last assignment wins", map[string]string{"etc/os-release": "ID=debian\nID=ubuntu\n"},
+			metrics.OSRelease{ID: "ubuntu"}, false},
+		{"fallback to /usr/lib", map[string]string{"usr/lib/os-release": "ID=ubuntu\nVERSION_ID=18.04\n"},
+			metrics.OSRelease{ID: "ubuntu", VersionID: "18.04"}, false},
+		{"/etc first", map[string]string{"etc/os-release": "ID=ubuntu\n", "usr/lib/os-release": "ID=debian\n"},
+			metrics.OSRelease{ID: "ubuntu"}, false},
+
+		{"no os-release", nil, metrics.OSRelease{}, true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			root, tearDown := helper.TempDir(t)
+			defer tearDown()
+			writeFiles(t, root, tc.files)
+
+			m := newTestMetrics(t, metrics.WithRootAt(root))
+			got, err := m.GetOSRelease()
+
+			a.CheckWantedErr(err, tc.wantErr)
+			a.Equal(&got, &tc.want)
+		})
+	}
+}
+
+func TestGetIDSDerivatives(t *testing.T) {
+	t.Parallel()
+
+	const (
+		pop  = "ID=pop\nID_LIKE=\"ubuntu debian\"\nVERSION_ID=22.04\nVERSION_CODENAME=jammy\nUBUNTU_CODENAME=jammy\n"
+		mint = "ID=linuxmint\nID_LIKE=\"ubuntu debian\"\nVERSION_ID=21.1\nVERSION_CODENAME=vera\nUBUNTU_CODENAME=jammy\n"
+	)
+
+	testCases := []struct {
+		name        string
+		osRelease   string
+		derivatives map[string]string
+		noInfo      bool
+
+		wantDistro  string
+		wantVersion string
+		wantErr     bool
+	}{
+		{"not mapped", pop, nil, false, "pop", "22.04", false},
+		{"mapped by id", pop, map[string]string{"pop": "ubuntu"}, false, "ubuntu", "22.04", false},
+		{"mapped by id like", pop, map[string]string{"ubuntu": "ubuntu"}, false, "ubuntu", "22.04", false},
+		{"id first", pop, map[string]string{"debian": "debian", "pop": "ubuntu"}, false, "ubuntu", "22.04", false},
+		{"closest id like first", pop, map[string]string{"debian": "debian", "ubuntu": "ubuntu"}, false, "ubuntu", "22.04", false},
+		{"other distributions", "ID=fedora\nVERSION_ID=38\n", map[string]string{"ubuntu": "ubuntu"}, false, "fedora", "38", false},
+		{"distribution mapped to itself", "ID=ubuntu\nVERSION_ID=22.04\n", map[string]string{"ubuntu": "ubuntu"}, true, "ubuntu", "22.04", false},
+		{"reported as the release it's based on", mint, map[string]string{"ubuntu": "ubuntu"}, false, "ubuntu", "22.04", false},
+		{"version codename of the base release", "ID=pop\nID_LIKE=ubuntu\nVERSION_ID=22.04.1\nVERSION_CODENAME=jammy\n",
+			map[string]string{"ubuntu": "ubuntu"}, false, "ubuntu", "22.04", false},
+
+		{"unknown base release is reported as itself", "ID=linuxmint\nID_LIKE=ubuntu\nVERSION_ID=21.1\nVERSION_CODENAME=vera\n",
+			map[string]string{"ubuntu": "ubuntu"}, false, "linuxmint", "21.1", false},
+		{"no release list is reported as itself", mint, map[string]string{"ubuntu": "ubuntu"}, true, "linuxmint", "21.1", false},
+		{"invalid mapping", pop, map[string]string{"pop": ""}, false, "", "", true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			root, tearDown := helper.TempDir(t)
+			defer tearDown()
+			files := map[string]string{"etc/os-release": tc.osRelease}
+			if !tc.noInfo {
+				files["usr/share/distro-info/ubuntu.csv"] = "version,codename,series,created,release,eol,eol-server,eol-esm\n" +
+					"20.04 LTS,Focal Fossa,focal,2019-10-17,2020-04-23,2025-05-29,2025-05-29,2030-04-23\n" +
+					"22.04 LTS,Jammy Jellyfish,jammy,2021-10-14,2022-04-21,2027-06-01,2027-06-01,2032-04-21\n" +
+					"22.10,Kinetic Kudu,kinetic,2022-04-21,2022-10-20,2023-07-20\n"
+			}
+			writeFiles(t, root, files)
+
+			m, err := metrics.New(metrics.WithRootAt(root), metrics.WithDerivatives(tc.derivatives))
+			var distro, version string
+			if err == nil {
+				distro, version, err = m.GetIDS()
+			}
+
+			a.CheckWantedErr(err, tc.wantErr)
+			a.Equal(distro, tc.wantDistro)
+			a.Equal(version, tc.wantVersion)
+		})
+	}
+}
+
+// writeFiles creates files, relative to root, with their content
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+
+	for p, content := range files {
+		p = filepath.Join(root, p)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal("couldn't create parent directory:", err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal("couldn't write file:", err)
+		}
+	}
+}
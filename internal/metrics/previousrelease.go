@@ -0,0 +1,23 @@
+package metrics
+
+import "github.com/pkg/errors"
+
+// PreviousRelease is the release the system was upgraded from, reported on upgrade
+type PreviousRelease struct {
+	Version string
+	// Decision is the reporting decision carried over from that release
+	Decision string
+	// SkippedReleases is how many releases the upgrade went over, like when upgrading from an LTS to the next one
+	SkippedReleases int `json:",omitempty"`
+}
+
+// WithPreviousRelease reports p as the release the system was upgraded from
+func WithPreviousRelease(p PreviousRelease) func(*Metrics) error {
+	return func(m *Metrics) error {
+		if p.Version == "" || p.Decision == "" {
+			return errors.Errorf("previous release %q and its decision %q are mandatory", p.Version, p.Decision)
+		}
+		m.previousRelease = &p
+		return nil
+	}
+}
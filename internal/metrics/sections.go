@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Sections are the parts of the report users can choose not to send, in report order.
+// Version and Variant are always sent.
+var Sections = []string{"hardware", "storage", "display", "session", "locale", "installer", "upgrade"}
+
+// sectionFields are the top-level report fields of each section
+var sectionFields = map[string][]string{
+	"hardware":  {"OEM", "BIOS", "CPU", "Arch", "HwCap", "GPU", "RAM"},
+	"storage":   {"Disks", "Partitions"},
+	"display":   {"Screens"},
+	"session":   {"Autologin", "LivePatch", "Session"},
+	"locale":    {"Language", "Timezone"},
+	"installer": {"Install"},
+	"upgrade":   {"Upgrade", "PreviousRelease"},
+}
+
+// SectionFields returns the top-level report fields of section s
+func SectionFields(s string) ([]string, error) {
+	f, ok := sectionFields[s]
+	if !ok {
+		return nil, errors.Errorf("unknown section %q, expected one of %s", s, strings.Join(Sections, ", "))
+	}
+	return f, nil
+}
+
+// RemoveSections returns report, as returned by Collect, pretty printed without the fields of sections
+func RemoveSections(report []byte, sections []string) ([]byte, error) {
+	var r metrics
+	if err := json.Unmarshal(report, &r); err != nil {
+		return nil, errors.Wrapf(err, "report isn't valid")
+	}
+
+	v := reflect.ValueOf(&r).Elem()
+	for _, s := range sections {
+		fields, err := SectionFields(s)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range fields {
+			fv := v.FieldByName(f)
+			fv.Set(reflect.Zero(fv.Type()))
+		}
+	}
+
+	b, err := json.MarshalIndent(r, "", "  ")
+	return b, errors.Wrapf(err, "couldn't serialize report")
+}
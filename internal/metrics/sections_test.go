@@ -0,0 +1,71 @@
+package metrics_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/ubuntu/ubuntu-report/internal/helper"
+	"github.com/ubuntu/ubuntu-report/internal/metrics"
+)
+
+func TestRemoveSections(t *testing.T) {
+	t.Parallel()
+
+	report, err := ioutil.ReadFile(filepath.Join("testdata", "good", "gold", "collect"))
+	if err != nil {
+		t.Fatal("couldn't read report:", err)
+	}
+
+	testCases := []struct {
+		name     string
+		sections []string
+
+		wantFields []string
+		wantErr    bool
+	}{
+		{"no section", nil, []string{"Version", "Variant", "OEM", "BIOS", "CPU", "Arch", "HwCap", "GPU", "RAM", "Disks", "Partitions",
+			"Screens", "Autologin", "LivePatch", "Session", "Language", "Timezone", "Install", "Upgrade"}, false},
+		{"one section", []string{"storage"}, []string{"Version", "Variant", "OEM", "BIOS", "CPU", "Arch", "HwCap", "GPU", "RAM",
+			"Screens", "Autologin", "LivePatch", "Session", "Language", "Timezone", "Install", "Upgrade"}, false},
+		{"multiple sections", []string{"hardware", "installer", "upgrade"}, []string{"Version", "Variant", "Disks", "Partitions",
+			"Screens", "Autologin", "LivePatch", "Session", "Language", "Timezone"}, false},
+		{"every section", metrics.Sections, []string{"Version", "Variant"}, false},
+
+		{"unknown section", []string{"network"}, nil, true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			got, err := metrics.RemoveSections(report, tc.sections)
+
+			a.CheckWantedErr(err, tc.wantErr)
+			if tc.wantErr {
+				return
+			}
+			a.Equal(topLevelFields(t, got), tc.wantFields)
+		})
+	}
+}
+
+// topLevelFields returns the top-level fields of report, in order
+func topLevelFields(t *testing.T, report []byte) []string {
+	t.Helper()
+
+	var fields []string
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(report, &m); err != nil {
+		t.Fatal("report isn't valid:", err)
+	}
+	for _, f := range []string{"Version", "Variant", "OEM", "BIOS", "CPU", "Arch", "HwCap", "GPU", "RAM", "Disks", "Partitions",
+		"Screens", "Autologin", "LivePatch", "Session", "Language", "Timezone", "Install", "Upgrade"} {
+		if _, ok := m[f]; ok {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,164 @@
+package metrics
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/ubuntu/ubuntu-report/internal/utils"
+)
+
+// Product variants reports are sent for
+const (
+	VariantDesktop = "desktop"
+	VariantServer  = "server"
+	VariantCloud   = "cloud"
+	VariantCore    = "core"
+	VariantWSL     = "wsl"
+)
+
+// Variants are the product variants which can be detected or requested
+var Variants = []string{VariantDesktop, VariantServer, VariantCloud, VariantCore, VariantWSL}
+
+const (
+	// dpkgInfoDir has a <package>.list file for each installed package
+	dpkgInfoDir = "var/lib/dpkg/info"
+	// cloudBuildInfoPath is only shipped in cloud images
+	cloudBuildInfoPath = "etc/cloud/build.info"
+	// cloudIDPath is the cloud cloud-init detected at boot
+	cloudIDPath = "run/cloud-init/cloud-id"
+)
+
+// modelAssertionPaths are where the snapd model assertion is, on Ubuntu Core 16 and 18 then on later releases
+var modelAssertionPaths = []string{"var/lib/snapd/seed/assertions/model", "run/mnt/ubuntu-seed/systems/*/model"}
+
+// seeds are the meta-packages installed by each variant, in detection order: a desktop can have the
+// server seed installed, but not the opposite.
+var seeds = []struct {
+	pkg     string
+	variant string
+}{
+	{"ubuntu-wsl", VariantWSL},
+	{"ubuntu-desktop", VariantDesktop},
+	{"ubuntu-desktop-minimal", VariantDesktop},
+	{"ubuntu-server", VariantServer},
+}
+
+// WithVariant reports as the product variant v, one of Variants, instead of detecting it
+func WithVariant(v string) func(*Metrics) error {
+	return func(m *Metrics) error {
+		if err := CheckVariant(v); err != nil {
+			return err
+		}
+		m.variant = v
+		return nil
+	}
+}
+
+// CheckVariant returns an error if v isn't one of Variants
+func CheckVariant(v string) error {
+	for _, known := range Variants {
+		if v == known {
+			return nil
+		}
+	}
+	return errors.Errorf("unknown product variant %q, expected one of %s", v, strings.Join(Variants, ", "))
+}
+
+// GetVariant returns the product variant of the system, unless one was requested. It's detected from,
+// in order: VARIANT_ID in os-release, the snapd model assertion of Ubuntu Core, cloud-init markers of
+// cloud images and installed seed meta-packages. Systems matching none of them are desktops.
+func (m Metrics) GetVariant() string {
+	if m.variant != "" {
+		return m.variant
+	}
+
+	r, err := m.GetOSRelease()
+	if err != nil {
+		log.Infof("couldn't get variant from os-release: "+utils.ErrFormat, err)
+	}
+	if CheckVariant(r.VariantID) == nil {
+		return r.VariantID
+	}
+
+	if m.isCore() {
+		return VariantCore
+	}
+	if m.isCloud() {
+		return VariantCloud
+	}
+	for _, s := range seeds {
+		if _, err := os.Stat(filepath.Join(m.root, dpkgInfoDir, s.pkg+".list")); err == nil {
+			return s.variant
+		}
+	}
+	return VariantDesktop
+}
+
+// isCore returns if the snapd model assertion describes an Ubuntu Core system, rather than a classic one
+func (m Metrics) isCore() bool {
+	for _, pattern := range modelAssertionPaths {
+		paths, err := filepath.Glob(filepath.Join(m.root, pattern))
+		if err != nil {
+			continue
+		}
+		for _, p := range paths {
+			headers, err := readAssertionHeaders(p)
+			if err != nil {
+				log.Infof("couldn't read model assertion: "+utils.ErrFormat, err)
+				continue
+			}
+			if headers["type"] == "model" && headers["classic"] != "true" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isCloud returns if cloud-init marks the system as a cloud image or as running on a cloud
+func (m Metrics) isCloud() bool {
+	if _, err := os.Stat(filepath.Join(m.root, cloudBuildInfoPath)); err == nil {
+		return true
+	}
+	id, err := getFromFileTrimmed(filepath.Join(m.root, cloudIDPath))
+	if err != nil {
+		return false
+	}
+	// cloud-init also runs on installed servers and containers, without any cloud
+	switch id {
+	case "", "none", "nocloud", "lxd":
+		return false
+	}
+	return true
+}
+
+// readAssertionHeaders returns the single-line headers of the snapd assertion at p
+func readAssertionHeaders(p string) (map[string]string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't open %s", p)
+	}
+	defer f.Close()
+
+	headers := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		// headers end with the first empty line, before the body and signature
+		if line == "" {
+			break
+		}
+		// multi-line values are indented
+		if strings.HasPrefix(line, " ") {
+			continue
+		}
+		if i := strings.Index(line, ":"); i > 0 {
+			headers[line[:i]] = strings.TrimSpace(line[i+1:])
+		}
+	}
+	return headers, errors.Wrapf(scanner.Err(), "couldn't read %s", p)
+}
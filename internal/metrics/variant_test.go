@@ -0,0 +1,93 @@
+package metrics_test
+
+import (
+	"testing"
+
+	"github.com/ubuntu/ubuntu-report/internal/helper"
+	"github.com/ubuntu/ubuntu-report/internal/metrics"
+)
+
+const (
+	coreModel    = "type: model\nauthority-id: canonical\nseries: 16\nbrand-id: canonical\nmodel: ubuntu-core-20-amd64\n\nsignature\n"
+	classicModel = "type: model\nauthority-id: canonical\nseries: 16\nbrand-id: canonical\nmodel: generic-classic\nclassic: true\n\nsignature\n"
+)
+
+func TestGetVariant(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name    string
+		files   map[string]string
+		variant string
+
+		want string
+	}{
+		{"variant in os-release", map[string]string{"etc/os-release": "ID=ubuntu\nVARIANT_ID=server\n"}, "", "server"},
+		{"quoted variant in os-release", map[string]string{"etc/os-release": "ID=ubuntu\nVARIANT_ID=\"cloud\"\n"}, "", "cloud"},
+		{"os-release first", map[string]string{"etc/os-release": "VARIANT_ID=wsl\n", "etc/cloud/build.info": ""}, "", "wsl"},
+		{"unknown variant in os-release", map[string]string{"etc/os-release": "VARIANT_ID=workstation\n",
+			"var/lib/dpkg/info/ubuntu-server.list": ""}, "", "server"},
+		{"core 16 and 18", map[string]string{"var/lib/snapd/seed/assertions/model": coreModel}, "", "core"},
+		{"core 20 and later", map[string]string{"run/mnt/ubuntu-seed/systems/20230101/model": coreModel}, "", "core"},
+		{"classic model", map[string]string{"var/lib/snapd/seed/assertions/model": classicModel,
+			"var/lib/dpkg/info/ubuntu-server.list": ""}, "", "server"},
+		{"cloud image", map[string]string{"etc/cloud/build.info": "build_name: server\n",
+			"var/lib/dpkg/info/ubuntu-server.list": ""}, "", "cloud"},
+		{"running on a cloud", map[string]string{"run/cloud-init/cloud-id": "aws\n"}, "", "cloud"},
+		{"cloud-init without cloud", map[string]string{"run/cloud-init/cloud-id": "nocloud\n",
+			"var/lib/dpkg/info/ubuntu-server.list": ""}, "", "server"},
+		{"wsl seed", map[string]string{"var/lib/dpkg/info/ubuntu-wsl.list": ""}, "", "wsl"},
+		{"desktop seed", map[string]string{"var/lib/dpkg/info/ubuntu-desktop-minimal.list": ""}, "", "desktop"},
+		{"desktop with server seed", map[string]string{"var/lib/dpkg/info/ubuntu-desktop.list": "",
+			"var/lib/dpkg/info/ubuntu-server.list": ""}, "", "desktop"},
+		{"server seed", map[string]string{"var/lib/dpkg/info/ubuntu-server.list": ""}, "", "server"},
+		{"nothing detected", nil, "", "desktop"},
+		{"requested variant", map[string]string{"etc/os-release": "VARIANT_ID=server\n"}, "core", "core"},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			root, tearDown := helper.TempDir(t)
+			defer tearDown()
+			writeFiles(t, root, tc.files)
+			opts := []func(*metrics.Metrics) error{metrics.WithRootAt(root)}
+			if tc.variant != "" {
+				opts = append(opts, metrics.WithVariant(tc.variant))
+			}
+
+			m := newTestMetrics(t, opts...)
+
+			a.Equal(m.GetVariant(), tc.want)
+		})
+	}
+}
+
+func TestWithVariant(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		variant string
+
+		wantErr bool
+	}{
+		{"desktop", false},
+		{"wsl", false},
+
+		{"workstation", true},
+		{"", true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.variant, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			_, err := metrics.New(metrics.WithVariant(tc.variant))
+
+			a.CheckWantedErr(err, tc.wantErr)
+		})
+	}
+}
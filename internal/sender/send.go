@@ -2,10 +2,18 @@ package sender
 
 import (
 	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
 	"io/ioutil"
 	"net/http"
+	"net/http/httputil"
 	"net/url"
 	"path"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -15,38 +23,373 @@ import (
 // BaseURL server to send metrics to
 const BaseURL = "https://metrics.ubuntu.com"
 
+// Response contains what we learnt from the server while sending a report
+type Response struct {
+	// GzipRefused is true if the server answered 415 to a gzip-encoded payload
+	// and the report was sent again as plain json
+	GzipRefused bool
+	// StatusCode is the HTTP status the server answered, 0 if it couldn't be reached
+	StatusCode int
+	// Directive is what the server asked us in its answer
+	Directive Directive
+}
+
+// Directive is an optional json answer of the server to a report.
+// Unknown fields are ignored, so that servers can extend it.
+type Directive struct {
+	// ReceiptID identifies the report on the server
+	ReceiptID string
+	// StopReporting asks not to send reports for this release anymore
+	StopReporting bool
+	// MinSchemaVersion is the oldest report format the server accepts
+	MinSchemaVersion int
+	// PrivacyPolicyVersion is the current version of the server privacy policy
+	PrivacyPolicyVersion string
+}
+
+// TLSConfig defines how we trust and authenticate to the metrics server
+type TLSConfig struct {
+	// CAFile is a PEM bundle of certificate authorities trusted in addition to the system ones
+	CAFile string
+	// CertFile and KeyFile are the PEM client certificate and key used for mutual TLS
+	CertFile string
+	KeyFile  string
+	// PinnedSPKI are base64-encoded sha256 hashes of a SubjectPublicKeyInfo.
+	// If set, the verified server certificate chain must contain one of them.
+	PinnedSPKI []string
+	// Insecure allows sending reports to non https URLs
+	Insecure bool
+}
+
+type options struct {
+	gzip           bool
+	tls            TLSConfig
+	idempotencyKey string
+	receiptID      string
+}
+
+// Option customizes how the report is sent
+type Option func(*options)
+
+// WithGzip compresses the payload and sends it with a gzip Content-Encoding.
+// It falls back to plain json if the server doesn't support it.
+func WithGzip() Option {
+	return func(o *options) {
+		o.gzip = true
+	}
+}
+
+// WithIdempotencyKey sets the key letting the server detect a report it already received
+func WithIdempotencyKey(key string) Option {
+	return func(o *options) {
+		o.idempotencyKey = key
+	}
+}
+
+// WithReceiptID sets the receipt ID the server answered to identify a report
+func WithReceiptID(id string) Option {
+	return func(o *options) {
+		o.receiptID = id
+	}
+}
+
+// WithTLS sets how the server is trusted and how we authenticate to it
+func WithTLS(c TLSConfig) Option {
+	return func(o *options) {
+		o.tls = c
+	}
+}
+
 // Send to url the json data
-func Send(url string, data []byte) error {
-	log.Debugf("sending %s to %s", data, url)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(data))
+func Send(url string, data []byte, opts ...Option) (Response, error) {
+	o := options{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	var r Response
+	if err := CheckURL(url, o.tls.Insecure); err != nil {
+		return r, err
+	}
+	client, err := newClient(o.tls)
 	if err != nil {
-		return errors.Wrap(err, "couldn't create http request")
+		return r, err
+	}
+
+	if o.gzip {
+		r.Directive, r.StatusCode, err = post(client, url, data, true, o.idempotencyKey)
+		if errors.Cause(err) != errUnsupportedMediaType {
+			return r, err
+		}
+		log.Infof("%s doesn't support gzip-encoded reports, sending plain json", url)
+		r.GzipRefused = true
 	}
-	req.Header.Set("Content-Type", "application/json")
 
+	r.Directive, r.StatusCode, err = post(client, url, data, false, o.idempotencyKey)
+	return r, err
+}
+
+// DryRun returns the request Send would first POST data to url with, without sending it: its method and
+// url, the headers going on the wire and the payload, before any compression. As the payload is shown
+// uncompressed, the headers describing its compression are annotated.
+func DryRun(url string, data []byte, opts ...Option) ([]byte, error) {
+	o := options{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if err := CheckURL(url, o.tls.Insecure); err != nil {
+		return nil, err
+	}
+	req, err := newPostRequest(url, data, o.gzip, o.idempotencyKey)
+	if err != nil {
+		return nil, err
+	}
+	dump, err := httputil.DumpRequestOut(req, false)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't dump http request")
+	}
+
+	// the request line only has the path: replace it with the full url
+	lines := strings.Split(strings.TrimRight(string(dump), "\r\n"), "\r\n")
+	lines[0] = req.Method + " " + url
+	if o.gzip {
+		for i, l := range lines {
+			if strings.HasPrefix(l, "Content-Encoding:") || strings.HasPrefix(l, "Content-Length:") {
+				lines[i] = l + " (compressed payload, shown uncompressed below)"
+			}
+		}
+	}
+	return []byte(strings.Join(lines, "\n") + "\n\n" + string(data)), nil
+}
+
+// Delete asks the server to delete the report it received at url, identified by the receipt ID it answered
+// and the idempotency key it was sent with. It returns the HTTP status the server answered.
+// A server which doesn't know the report answers 404: there is then nothing to delete.
+func Delete(url string, opts ...Option) (int, error) {
+	o := options{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.receiptID == "" && o.idempotencyKey == "" {
+		return 0, errors.New("a receipt ID or an idempotency key is needed to identify the report to delete")
+	}
+	if err := CheckURL(url, o.tls.Insecure); err != nil {
+		return 0, err
+	}
+	client, err := newClient(o.tls)
+	if err != nil {
+		return 0, err
+	}
+
+	log.Debugf("requesting deletion of report at %s", url)
+	req, err := http.NewRequest("DELETE", url, nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "couldn't create http request")
+	}
+	if o.receiptID != "" {
+		req.Header.Set("Receipt-ID", o.receiptID)
+	}
+	if o.idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", o.idempotencyKey)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, errors.Wrap(err, "couldn't send delete http request")
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusAccepted, http.StatusNoContent:
+	case http.StatusNotFound:
+		log.Infof("%s doesn't know this report, nothing to delete", url)
+	default:
+		return resp.StatusCode, errors.Errorf("incorrect status code received: %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// Ping checks the server at url can be reached and returns the HTTP status it answered.
+// Any answer, even an error status, means the server is reachable.
+func Ping(url string, opts ...Option) (int, error) {
+	o := options{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if err := CheckURL(url, o.tls.Insecure); err != nil {
+		return 0, err
+	}
+	client, err := newClient(o.tls)
+	if err != nil {
+		return 0, err
+	}
+
+	log.Debugf("checking %s is reachable", url)
+	resp, err := client.Head(url)
+	if err != nil {
+		return 0, errors.Wrapf(err, "couldn't reach %s", url)
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// CheckURL returns an error if u isn't an https url, unless insecure is set
+func CheckURL(u string, insecure bool) error {
+	pu, err := url.Parse(u)
+	if err != nil {
+		return errors.Wrapf(err, "invalid URL: %s", u)
+	}
+	if pu.Scheme != "https" && !insecure {
+		return errors.Errorf("refusing to send report to %s: only https URLs are allowed unless insecure mode is set", u)
+	}
+	return nil
+}
+
+func newClient(c TLSConfig) (*http.Client, error) {
 	client := &http.Client{
 		Timeout: time.Second * 10,
 	}
+	if c.CAFile == "" && c.CertFile == "" && c.KeyFile == "" && len(c.PinnedSPKI) == 0 {
+		return client, nil
+	}
+
+	tlsConfig := &tls.Config{}
+	if c.CAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			log.Infof("couldn't load system certificate authorities, only trusting %s: %v", c.CAFile, err)
+			pool = x509.NewCertPool()
+		}
+		b, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "couldn't read CA bundle")
+		}
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, errors.Errorf("no valid PEM certificate found in CA bundle %s", c.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if c.CertFile != "" || c.KeyFile != "" {
+		if c.CertFile == "" || c.KeyFile == "" {
+			return nil, errors.New("client certificate and key should both be set")
+		}
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "couldn't load client certificate")
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if len(c.PinnedSPKI) > 0 {
+		pins := make(map[string]bool)
+		for _, p := range c.PinnedSPKI {
+			pins[p] = true
+		}
+		tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+			for _, chain := range cs.VerifiedChains {
+				for _, cert := range chain {
+					h := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+					if pins[base64.StdEncoding.EncodeToString(h[:])] {
+						return nil
+					}
+				}
+			}
+			return errors.New("server certificate chain doesn't match any pinned public key")
+		}
+	}
+
+	client.Transport = &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: tlsConfig,
+	}
+	return client, nil
+}
+
+// errUnsupportedMediaType is returned when the server answers 415 to our POST
+var errUnsupportedMediaType = errors.New("unsupported media type")
+
+// post sends data to url and returns the server directive and HTTP status
+func post(client *http.Client, url string, data []byte, compress bool, idempotencyKey string) (Directive, int, error) {
+	log.Debugf("sending %s to %s", data, url)
+
+	req, err := newPostRequest(url, data, compress, idempotencyKey)
+	if err != nil {
+		return Directive{}, 0, err
+	}
+
 	resp, err := client.Do(req)
 	if err != nil {
-		return errors.Wrap(err, "couldn't send post http request")
+		return Directive{}, 0, errors.Wrap(err, "couldn't send post http request")
 	}
 	defer resp.Body.Close()
 
+	if compress && resp.StatusCode == http.StatusUnsupportedMediaType {
+		return Directive{}, resp.StatusCode, errUnsupportedMediaType
+	}
 	if resp.StatusCode != http.StatusOK {
-		return errors.Errorf("incorrect status code received: %s", resp.Status)
+		return Directive{}, resp.StatusCode, errors.Errorf("incorrect status code received: %s", resp.Status)
 	}
 
-	_, err = ioutil.ReadAll(resp.Body)
-	return errors.Wrap(err, "POST body answer contained an error")
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return Directive{}, resp.StatusCode, errors.Wrap(err, "POST body answer contained an error")
+	}
+	return parseDirective(b), resp.StatusCode, nil
+}
+
+// newPostRequest returns the request sending data to url, gzip-compressed if compress is set
+func newPostRequest(url string, data []byte, compress bool, idempotencyKey string) (*http.Request, error) {
+	body := data
+	if compress {
+		var b bytes.Buffer
+		w := gzip.NewWriter(&b)
+		if _, err := w.Write(data); err != nil {
+			return nil, errors.Wrap(err, "couldn't compress report")
+		}
+		if err := w.Close(); err != nil {
+			return nil, errors.Wrap(err, "couldn't compress report")
+		}
+		body = b.Bytes()
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't create http request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if compress {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+	return req, nil
+}
+
+// parseDirective returns the directive the server answered, if any.
+// Servers not answering any or invalid json are ignored.
+func parseDirective(b []byte) Directive {
+	var d Directive
+	if len(bytes.TrimSpace(b)) == 0 {
+		return d
+	}
+	if err := json.Unmarshal(b, &d); err != nil {
+		log.Debugf("ignoring server answer which isn't a directive: %v", err)
+		return Directive{}
+	}
+	return d
 }
 
-// GetURL with distro and version marshalling
-func GetURL(URL, distro, version string) (string, error) {
+// GetURL with distro, product variant and version marshalling
+func GetURL(URL, distro, variant, version string) (string, error) {
 	u, err := url.Parse(URL)
 	if err != nil {
 		return "", errors.Wrapf(err, "invalid base URL: %s", URL)
 	}
-	u.Path = path.Join(u.Path, distro, "desktop", version)
+	u.Path = path.Join(u.Path, distro, variant, version)
 	return u.String(), nil
 }
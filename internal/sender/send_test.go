@@ -1,9 +1,24 @@
 package sender_test
 
 import (
+	"compress/gzip"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -21,7 +36,7 @@ func TestGetURL(t *testing.T) {
 		want    string
 		wantErr bool
 	}{
-		{"regular", "https://myurl.com", "https://myurl.com/distroname/desktop/versionnumber", false},
+		{"regular", "https://myurl.com", "https://myurl.com/distroname/variantname/versionnumber", false},
 		{"bad parsing", "http://a b.com/", "", true},
 	}
 	for _, tc := range testCases {
@@ -30,7 +45,7 @@ func TestGetURL(t *testing.T) {
 			t.Parallel()
 			a := helper.Asserter{T: t}
 
-			got, err := sender.GetURL(tc.baseURL, "distroname", "versionnumber")
+			got, err := sender.GetURL(tc.baseURL, "distroname", "variantname", "versionnumber")
 
 			a.CheckWantedErr(err, tc.wantErr)
 			if err != nil {
@@ -61,20 +76,342 @@ func TestSend(t *testing.T) {
 			ts := httptest.NewServer(&status)
 			defer ts.Close()
 
-			err := sender.Send(ts.URL, []byte("some content"))
+			r, err := sender.Send(ts.URL, []byte("some content"), insecure)
 
 			a.CheckWantedErr(err, tc.wantErr)
+			a.Equal(r.StatusCode, tc.status)
 		})
 	}
 }
 
+func TestSendGzip(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name         string
+		gzip         bool
+		supportsGzip bool
+
+		wantHits        int
+		wantGzipRefused bool
+		wantErr         bool
+	}{
+		{"plain json", false, true, 1, false, false},
+		{"gzip supported", true, true, 1, false, false},
+		{"gzip unsupported fallback to plain json", true, false, 2, true, false},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			hits := 0
+			var got []byte
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				hits++
+				var body io.Reader = r.Body
+				if r.Header.Get("Content-Encoding") == "gzip" {
+					if !tc.supportsGzip {
+						w.WriteHeader(http.StatusUnsupportedMediaType)
+						return
+					}
+					gz, err := gzip.NewReader(r.Body)
+					if err != nil {
+						w.WriteHeader(http.StatusBadRequest)
+						return
+					}
+					body = gz
+				}
+				got, _ = ioutil.ReadAll(body)
+			}))
+			defer ts.Close()
+
+			opts := []sender.Option{insecure}
+			if tc.gzip {
+				opts = append(opts, sender.WithGzip())
+			}
+			r, err := sender.Send(ts.URL, []byte("some content"), opts...)
+
+			a.CheckWantedErr(err, tc.wantErr)
+			a.Equal(hits, tc.wantHits)
+			a.Equal(r.GzipRefused, tc.wantGzipRefused)
+			a.Equal(string(got), "some content")
+		})
+	}
+}
+
+func TestSendDirective(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name   string
+		answer string
+
+		want sender.Directive
+	}{
+		{"no answer", "", sender.Directive{}},
+		{"not json", "thanks!", sender.Directive{}},
+		{"receipt", `{"ReceiptID": "abc"}`, sender.Directive{ReceiptID: "abc"}},
+		{"all directives",
+			`{"ReceiptID": "abc", "StopReporting": true, "MinSchemaVersion": 2, "PrivacyPolicyVersion": "2.0"}`,
+			sender.Directive{ReceiptID: "abc", StopReporting: true, MinSchemaVersion: 2, PrivacyPolicyVersion: "2.0"}},
+		{"unknown fields are ignored", `{"ReceiptID": "abc", "SomethingNew": {"a": 1}}`, sender.Directive{ReceiptID: "abc"}},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, tc.answer)
+			}))
+			defer ts.Close()
+
+			r, err := sender.Send(ts.URL, []byte("some content"), insecure)
+
+			a.CheckWantedErr(err, false)
+			a.Equal(r.Directive, tc.want)
+		})
+	}
+}
+
+func TestSendTLS(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name              string
+		plainHTTP         bool
+		requireClientCert bool
+		trustCA           bool
+		pin               string
+		clientCert        bool
+		clientKey         bool
+		caFile            string
+		insecure          bool
+
+		wantErr bool
+	}{
+		{"https with CA bundle", false, false, true, "", false, false, "", false, false},
+		{"https with unknown CA", false, false, false, "", false, false, "", false, true},
+		{"matching pin", false, false, true, "server", false, false, "", false, false},
+		{"non matching pin", false, false, true, "other", false, false, "", false, true},
+		{"client certificate", false, true, true, "", true, true, "", false, false},
+		{"missing client certificate", false, true, true, "", false, false, "", false, true},
+		{"client certificate without key", false, true, true, "", true, false, "", false, true},
+		{"client key without certificate", false, true, true, "", false, true, "", false, true},
+		{"invalid CA bundle", false, false, false, "", false, false, "invalid", false, true},
+		{"missing CA bundle", false, false, false, "", false, false, "doesnotexist", false, true},
+		{"http refused", true, false, false, "", false, false, "", false, true},
+		{"http allowed in insecure mode", true, false, false, "", false, false, "", true, false},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			d, tearDown := helper.TempDir(t)
+			defer tearDown()
+
+			serverHit := false
+			ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				serverHit = true
+			}))
+			if tc.plainHTTP {
+				ts.Start()
+			} else {
+				if tc.requireClientCert {
+					ts.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+				}
+				ts.StartTLS()
+			}
+			defer ts.Close()
+
+			c := sender.TLSConfig{Insecure: tc.insecure}
+			if tc.trustCA {
+				c.CAFile = filepath.Join(d, "ca.pem")
+				writePEM(t, c.CAFile, "CERTIFICATE", ts.Certificate().Raw)
+			}
+			switch tc.caFile {
+			case "invalid":
+				c.CAFile = filepath.Join(d, "ca.pem")
+				if err := ioutil.WriteFile(c.CAFile, []byte("garbage"), 0600); err != nil {
+					t.Fatalf("couldn't write invalid CA bundle: %v", err)
+				}
+			case "doesnotexist":
+				c.CAFile = filepath.Join(d, "doesnotexist")
+			}
+			switch tc.pin {
+			case "server":
+				h := sha256.Sum256(ts.Certificate().RawSubjectPublicKeyInfo)
+				c.PinnedSPKI = []string{base64.StdEncoding.EncodeToString(h[:])}
+			case "other":
+				c.PinnedSPKI = []string{base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))}
+			}
+			certFile, keyFile := generateClientCertificate(t, d)
+			if tc.clientCert {
+				c.CertFile = certFile
+			}
+			if tc.clientKey {
+				c.KeyFile = keyFile
+			}
+
+			_, err := sender.Send(ts.URL, []byte("some content"), sender.WithTLS(c))
+
+			helper.Asserter{T: t}.CheckWantedErr(err, tc.wantErr)
+			if err != nil && serverHit && !tc.requireClientCert {
+				t.Error("server was hit when the connection should have been refused")
+			}
+		})
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		url  string
+		opts []sender.Option
+
+		wantHeaders []string
+		wantErr     bool
+	}{
+		{"plain json", "https://metrics.ubuntu.com/ubuntu/desktop/18.04", nil,
+			[]string{"Host: metrics.ubuntu.com", "Content-Type: application/json", "Content-Length: 11"}, false},
+		{"gzip", "https://metrics.ubuntu.com/ubuntu/desktop/18.04", []sender.Option{sender.WithGzip()},
+			[]string{"Content-Encoding: gzip (compressed payload, shown uncompressed below)", "Content-Type: application/json"}, false},
+		{"idempotency key", "https://metrics.ubuntu.com/ubuntu/desktop/18.04", []sender.Option{sender.WithIdempotencyKey("abc")},
+			[]string{"Idempotency-Key: abc"}, false},
+		{"insecure url allowed", "http://localhost/ubuntu/desktop/18.04", []sender.Option{insecure},
+			[]string{"Host: localhost"}, false},
+
+		{"insecure url", "http://localhost/ubuntu/desktop/18.04", nil, nil, true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			got, err := sender.DryRun(tc.url, []byte(`{"some": 1}`), tc.opts...)
+
+			a.CheckWantedErr(err, tc.wantErr)
+			if tc.wantErr {
+				return
+			}
+			parts := strings.SplitN(string(got), "\n\n", 2)
+			if len(parts) != 2 {
+				t.Fatalf("expected headers and body to be separated by an empty line, got: %s", got)
+			}
+			headers := strings.Split(parts[0], "\n")
+			a.Equal(headers[0], "POST "+tc.url)
+			for _, h := range tc.wantHeaders {
+				if !stringInSlice(h, headers[1:]) {
+					t.Errorf("expected header %q, got: %v", h, headers[1:])
+				}
+			}
+			a.Equal(parts[1], `{"some": 1}`)
+		})
+	}
+}
+
+func TestDelete(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name      string
+		receiptID string
+		key       string
+		status    int
+
+		wantHit bool
+		wantErr bool
+	}{
+		{"deleted", "abc", "123", http.StatusOK, true, false},
+		{"deletion accepted for later", "abc", "", http.StatusAccepted, true, false},
+		{"deleted without content", "", "123", http.StatusNoContent, true, false},
+		{"unknown report", "abc", "123", http.StatusNotFound, true, false},
+
+		{"server error", "abc", "123", http.StatusInternalServerError, true, true},
+		{"report not identified", "", "", http.StatusOK, false, true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			hit := false
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				hit = true
+				a.Equal(r.Method, "DELETE")
+				a.Equal(r.Header.Get("Receipt-ID"), tc.receiptID)
+				a.Equal(r.Header.Get("Idempotency-Key"), tc.key)
+				w.WriteHeader(tc.status)
+			}))
+			defer ts.Close()
+
+			status, err := sender.Delete(ts.URL, insecure, sender.WithReceiptID(tc.receiptID), sender.WithIdempotencyKey(tc.key))
+
+			a.CheckWantedErr(err, tc.wantErr)
+			a.Equal(hit, tc.wantHit)
+			if tc.wantHit {
+				a.Equal(status, tc.status)
+			}
+		})
+	}
+}
+
+func TestPing(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name   string
+		status int
+	}{
+		{"server answering", http.StatusOK},
+		{"server answering an error", http.StatusMethodNotAllowed},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				a.Equal(r.Method, "HEAD")
+				w.WriteHeader(tc.status)
+			}))
+			defer ts.Close()
+
+			status, err := sender.Ping(ts.URL, insecure)
+
+			a.CheckWantedErr(err, false)
+			a.Equal(status, tc.status)
+		})
+	}
+}
+
+func TestPingNoServer(t *testing.T) {
+	t.Parallel()
+	a := helper.Asserter{T: t}
+
+	status, err := sender.Ping("https://localhost:4299")
+
+	a.CheckWantedErr(err, true)
+	a.Equal(status, 0)
+}
+
 func TestSendNoServer(t *testing.T) {
 	t.Parallel()
 	a := helper.Asserter{T: t}
 
-	err := sender.Send("https://localhost:4299", []byte("some content"))
+	r, err := sender.Send("https://localhost:4299", []byte("some content"))
 
 	a.CheckWantedErr(err, true)
+	a.Equal(r.StatusCode, 0)
 }
 
 func TestSendInfiniteRequestServer(t *testing.T) {
@@ -97,7 +434,7 @@ func TestSendInfiniteRequestServer(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	err := sender.Send(ts.URL, []byte("some content"))
+	_, err := sender.Send(ts.URL, []byte("some content"), insecure)
 
 	// ensure we get the handler close to setup cancelled flag if timeout not reached
 	close(closehandler)
@@ -109,8 +446,58 @@ func TestSendInfiniteRequestServer(t *testing.T) {
 	}
 }
 
+func writePEM(t *testing.T, p, blockType string, data []byte) {
+	t.Helper()
+	b := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: data})
+	if err := ioutil.WriteFile(p, b, 0600); err != nil {
+		t.Fatalf("couldn't write %s: %v", p, err)
+	}
+}
+
+// generateClientCertificate returns a self-signed certificate and its key, saved as PEM in d
+func generateClientCertificate(t *testing.T, d string) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("couldn't generate client key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "ubuntu-report tests"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("couldn't generate client certificate: %v", err)
+	}
+	k, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("couldn't marshal client key: %v", err)
+	}
+
+	certFile, keyFile := filepath.Join(d, "client.pem"), filepath.Join(d, "client.key")
+	writePEM(t, certFile, "CERTIFICATE", cert)
+	writePEM(t, keyFile, "EC PRIVATE KEY", k)
+	return certFile, keyFile
+}
+
+// insecure allows sending to httptest plain http servers
+var insecure = sender.WithTLS(sender.TLSConfig{Insecure: true})
+
 type statusHandler int
 
 func (h *statusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(int(*h))
 }
+
+func stringInSlice(s string, l []string) bool {
+	for _, e := range l {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrLocked is the cause of errors returned when the lock is still held by another process after the timeout
+var ErrLocked = errors.New("another ubuntu-report instance is running")
+
+// lockPollInterval is how often we check if the lock was released
+var lockPollInterval = 100 * time.Millisecond
+
+// Lock takes an exclusive advisory lock on the file p, waiting up to timeout for other processes to release it.
+// The lock file is removed once released by calling the returned function.
+func Lock(p string, timeout time.Duration) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return nil, errors.Wrapf(err, "couldn't create parent directory of %s", p)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		f, err := os.OpenFile(p, os.O_RDWR|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, errors.Wrapf(err, "couldn't open lock file")
+		}
+
+		err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			// the previous owner removes the lock file when releasing it: retry if we locked a removed one
+			if sameFile(f, p) {
+				return func() {
+					os.Remove(p)
+					f.Close()
+				}, nil
+			}
+			f.Close()
+			continue
+		}
+		f.Close()
+
+		if err != syscall.EWOULDBLOCK {
+			return nil, errors.Wrapf(err, "couldn't lock %s", p)
+		}
+		if time.Now().After(deadline) {
+			return nil, errors.Wrapf(ErrLocked, "%s is still locked after %s", p, timeout)
+		}
+		time.Sleep(lockPollInterval)
+	}
+}
+
+// sameFile returns true if f is still the file at path p
+func sameFile(f *os.File, p string) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	pi, err := os.Stat(p)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(fi, pi)
+}
@@ -0,0 +1,64 @@
+package utils_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/ubuntu/ubuntu-report/internal/helper"
+	"github.com/ubuntu/ubuntu-report/internal/utils"
+)
+
+func TestLock(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name        string
+		heldFor     time.Duration
+		lockTimeout time.Duration
+
+		wantErr bool
+	}{
+		{"not locked", 0, 10 * time.Millisecond, false},
+		{"released while waiting", 100 * time.Millisecond, 5 * time.Second, false},
+		{"still locked after timeout", time.Second, 100 * time.Millisecond, true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			d, tearDown := helper.TempDir(t)
+			defer tearDown()
+			p := filepath.Join(d, "ubuntu-report", "lock")
+			if tc.heldFor != 0 {
+				unlock, err := utils.Lock(p, 0)
+				if err != nil {
+					t.Fatal("couldn't take initial lock:", err)
+				}
+				released := make(chan struct{})
+				defer func() { <-released }()
+				go func() {
+					time.Sleep(tc.heldFor)
+					unlock()
+					close(released)
+				}()
+			}
+
+			unlock, err := utils.Lock(p, tc.lockTimeout)
+
+			a.CheckWantedErr(err, tc.wantErr)
+			if tc.wantErr {
+				a.Equal(errors.Cause(err), utils.ErrLocked)
+				return
+			}
+			unlock()
+			if _, err := os.Stat(p); !os.IsNotExist(err) {
+				t.Errorf("we expected the lock file to be removed once released")
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// migrateReportDir moves reports state saved by previous versions in oldD to newD, then removes oldD.
+// Files already present in newD are more recent and kept over their old version.
+// A crash while migrating is safe: the next run resumes where it stopped.
+func migrateReportDir(oldD, newD string) error {
+	if filepath.Clean(oldD) == filepath.Clean(newD) {
+		return nil
+	}
+	files, err := ioutil.ReadDir(oldD)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return errors.Wrapf(err, "couldn't list %s", oldD)
+	}
+	if err := os.MkdirAll(newD, 0700); err != nil {
+		return errors.Wrapf(err, "couldn't create %s", newD)
+	}
+
+	for _, f := range files {
+		if f.IsDir() || IsChecksumFile(f.Name()) {
+			continue
+		}
+		src, dst := filepath.Join(oldD, f.Name()), filepath.Join(newD, f.Name())
+		if _, err := os.Stat(dst); err == nil {
+			if err := RemoveFile(src); err != nil {
+				return errors.Wrapf(err, "couldn't remove outdated %s", src)
+			}
+			continue
+		}
+		// data goes first: a file without its checksum is accepted, not the other way around
+		if err := moveFile(src, dst); err != nil {
+			return err
+		}
+		if err := moveFile(src+ChecksumExt, dst+ChecksumExt); err != nil && !os.IsNotExist(errors.Cause(err)) {
+			return err
+		}
+	}
+
+	// remaining checksums were left behind by an interrupted migration
+	files, err = ioutil.ReadDir(oldD)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't list %s", oldD)
+	}
+	for _, f := range files {
+		if IsChecksumFile(f.Name()) {
+			if err := os.Remove(filepath.Join(oldD, f.Name())); err != nil {
+				return errors.Wrapf(err, "couldn't remove %s", f.Name())
+			}
+		}
+	}
+	if err := os.Remove(oldD); err != nil {
+		return errors.Wrapf(err, "couldn't remove %s", oldD)
+	}
+	return syncDir(newD)
+}
+
+// moveFile renames src to dst, copying it if they are on different file systems
+func moveFile(src, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil {
+		return nil
+	}
+	if lerr, ok := err.(*os.LinkError); !ok || lerr.Err != syscall.EXDEV {
+		return errors.Wrapf(err, "couldn't move %s to %s", src, dst)
+	}
+
+	fi, err := os.Stat(src)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't stat %s", src)
+	}
+	data, err := ioutil.ReadFile(src)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't read %s", src)
+	}
+	tmp, err := writeTemp(filepath.Dir(dst), filepath.Base(dst), data, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return errors.Wrapf(err, "couldn't save %s", dst)
+	}
+	return os.Remove(src)
+}
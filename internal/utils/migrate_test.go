@@ -0,0 +1,126 @@
+package utils_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ubuntu/ubuntu-report/internal/helper"
+	"github.com/ubuntu/ubuntu-report/internal/utils"
+)
+
+func TestMigrateFromCache(t *testing.T) {
+	testCases := []struct {
+		name     string
+		oldFiles map[string]string
+		newFiles map[string]string
+
+		want map[string]string
+	}{
+		{"no previous state", nil, nil, nil},
+		{"move reports", map[string]string{"ubuntu.18.04": "old report", "pending": "old pending"}, nil,
+			map[string]string{"ubuntu.18.04": "old report", "pending": "old pending"}},
+		{"new state takes precedence", map[string]string{"ubuntu.18.04": "old report", "ubuntu.18.10": "old report"},
+			map[string]string{"ubuntu.18.04": "new report"},
+			map[string]string{"ubuntu.18.04": "new report", "ubuntu.18.10": "old report"}},
+		{"already migrated", nil, map[string]string{"ubuntu.18.04": "new report"}, map[string]string{"ubuntu.18.04": "new report"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			a := helper.Asserter{T: t}
+
+			d, tearDown := helper.TempDir(t)
+			defer tearDown()
+			cacheD, stateD := filepath.Join(d, "cache"), filepath.Join(d, "state")
+			defer changeEnv(t, "XDG_CACHE_HOME", cacheD)()
+			defer changeEnv(t, "XDG_STATE_HOME", stateD)()
+			for f, content := range tc.oldFiles {
+				if err := utils.WriteFile(filepath.Join(cacheD, "ubuntu-report", f), []byte(content)); err != nil {
+					t.Fatal("couldn't setup old state:", err)
+				}
+			}
+			for f, content := range tc.newFiles {
+				if err := utils.WriteFile(filepath.Join(stateD, "ubuntu-report", f), []byte(content)); err != nil {
+					t.Fatal("couldn't setup new state:", err)
+				}
+			}
+
+			// looking up paths doesn't change anything
+			p, err := utils.ReportPath("ubuntu", "18.04", "")
+			a.CheckWantedErr(err, false)
+			a.Equal(p, filepath.Join(stateD, "ubuntu-report", "ubuntu.18.04"))
+			if len(tc.oldFiles) > 0 {
+				if _, err := os.Stat(filepath.Join(cacheD, "ubuntu-report")); err != nil {
+					t.Errorf("old state directory shouldn't be migrated by looking up paths, got: %v", err)
+				}
+			}
+
+			err = utils.MigrateStateDir()
+
+			a.CheckWantedErr(err, false)
+			if _, err := os.Stat(filepath.Join(cacheD, "ubuntu-report")); !os.IsNotExist(err) {
+				t.Errorf("old state directory should have been removed, got: %v", err)
+			}
+			files, _ := ioutil.ReadDir(filepath.Join(stateD, "ubuntu-report"))
+			// each file has its checksum
+			a.Equal(len(files), 2*len(tc.want))
+			for f, content := range tc.want {
+				got, err := utils.ReadFile(filepath.Join(stateD, "ubuntu-report", f))
+				if err != nil {
+					t.Fatalf("couldn't read migrated %s: %v", f, err)
+				}
+				a.Equal(string(got), content)
+			}
+		})
+	}
+}
+
+func TestUnmigratedStateDir(t *testing.T) {
+	testCases := []struct {
+		name     string
+		oldFiles bool
+		newFiles bool
+
+		want bool
+	}{
+		{"no previous state", false, false, false},
+		{"not migrated", true, false, true},
+		{"migrated", false, true, false},
+		{"new state takes precedence", true, true, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			a := helper.Asserter{T: t}
+
+			d, tearDown := helper.TempDir(t)
+			defer tearDown()
+			cacheD, stateD := filepath.Join(d, "cache"), filepath.Join(d, "state")
+			defer changeEnv(t, "XDG_CACHE_HOME", cacheD)()
+			defer changeEnv(t, "XDG_STATE_HOME", stateD)()
+			if tc.oldFiles {
+				if err := utils.WriteFile(filepath.Join(cacheD, "ubuntu-report", "ubuntu.18.04"), []byte("old report")); err != nil {
+					t.Fatal("couldn't setup old state:", err)
+				}
+			}
+			if tc.newFiles {
+				if err := utils.WriteFile(filepath.Join(stateD, "ubuntu-report", "ubuntu.18.04"), []byte("new report")); err != nil {
+					t.Fatal("couldn't setup new state:", err)
+				}
+			}
+
+			got, ok, err := utils.UnmigratedStateDir()
+
+			a.CheckWantedErr(err, false)
+			a.Equal(ok, tc.want)
+			if tc.want {
+				a.Equal(got, cacheD)
+			}
+			if tc.oldFiles {
+				if _, err := os.Stat(filepath.Join(cacheD, "ubuntu-report", "ubuntu.18.04")); err != nil {
+					t.Errorf("old state shouldn't be migrated, got: %v", err)
+				}
+			}
+		})
+	}
+}
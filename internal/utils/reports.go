@@ -9,10 +9,16 @@ import (
 )
 
 const (
-	defaultCacheDir = ".cache"
-	reportDir       = "ubuntu-report"
+	defaultCacheDir  = ".cache"
+	defaultStateDir  = ".local/state"
+	defaultConfigDir = ".config"
+	reportDir        = "ubuntu-report"
+	configFile       = "config.yaml"
 )
 
+// MachineStateDir is the base directory of machine-wide reporting state, shared by all users
+const MachineStateDir = "/var/lib"
+
 var (
 	// ErrFormat used to print debug messages.
 	// Only for log.() msg, not errors.() error wrapping!
@@ -21,34 +27,118 @@ var (
 
 // ReportPath of last saved report
 func ReportPath(distro, version string, cacheP string) (string, error) {
-	if cacheP == "" {
-		var err error
-		if cacheP, err = cacheDir(); err != nil {
-			return "", err
-		}
-	}
-	return filepath.Join(cacheP, reportDir, distro+"."+version), nil
+	return statePath(cacheP, distro+"."+version)
 }
 
 // PendingReportPath of last saved pending report
 func PendingReportPath(cacheP string) (string, error) {
+	return statePath(cacheP, "pending")
+}
+
+// ExportedBundlePath of a bundle exported for an offline upload, waiting for its receipt
+func ExportedBundlePath(key, cacheP string) (string, error) {
+	return statePath(cacheP, "exported."+key)
+}
+
+// ReceiptsPath of receipt IDs servers answered to saved reports
+func ReceiptsPath(cacheP string) (string, error) {
+	return statePath(cacheP, "receipts")
+}
+
+// LockPath of the lock file preventing multiple instances to act on reports at the same time
+func LockPath(cacheP string) (string, error) {
+	return statePath(cacheP, "lock")
+}
+
+// ServerStatePath of what we learnt about metrics servers capabilities
+func ServerStatePath(cacheP string) (string, error) {
+	return statePath(cacheP, "servers")
+}
+
+// ConsentPath of the user decision about reporting metrics
+func ConsentPath(cacheP string) (string, error) {
+	return statePath(cacheP, "user-consent")
+}
+
+// LedgerPath of the append-only record of every attempt to send a report
+func LedgerPath(cacheP string) (string, error) {
+	return statePath(cacheP, "uploads")
+}
+
+// statePath returns the path of name in the reports state directory under cacheP, or under the state
+// directory of the user if cacheP is empty
+func statePath(cacheP, name string) (string, error) {
 	if cacheP == "" {
 		var err error
-		if cacheP, err = cacheDir(); err != nil {
+		if cacheP, err = stateDir(); err != nil {
 			return "", err
 		}
 	}
-	return filepath.Join(cacheP, reportDir, "pending"), nil
+	return filepath.Join(cacheP, reportDir, name), nil
+}
+
+// UserConfigPath of user configuration file
+func UserConfigPath() (string, error) {
+	d, err := xdgDir("XDG_CONFIG_HOME", defaultConfigDir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(d, reportDir, configFile), nil
+}
+
+// stateDir returns where reports state is stored
+func stateDir() (string, error) {
+	return xdgDir("XDG_STATE_HOME", defaultStateDir)
+}
+
+// MigrateStateDir moves reports state saved by previous versions in the cache directory to the state directory.
+// It changes files: it's only meant to be called by actions changing reports state, while holding the reports lock.
+func MigrateStateDir() error {
+	d, err := stateDir()
+	if err != nil {
+		return err
+	}
+	old, err := xdgDir("XDG_CACHE_HOME", defaultCacheDir)
+	if err != nil {
+		return err
+	}
+	return migrateReportDir(filepath.Join(old, reportDir), filepath.Join(d, reportDir))
+}
+
+// UnmigratedStateDir returns the cache directory reports state was saved under by previous versions, and true,
+// as long as it wasn't migrated to the state directory. It's meant for actions which only read reports state,
+// and thus can't migrate it, like dry runs: they can pass it as base path to read state where it still is.
+func UnmigratedStateDir() (string, bool, error) {
+	d, err := stateDir()
+	if err != nil {
+		return "", false, err
+	}
+	old, err := xdgDir("XDG_CACHE_HOME", defaultCacheDir)
+	if err != nil {
+		return "", false, err
+	}
+	if filepath.Clean(old) == filepath.Clean(d) {
+		return "", false, nil
+	}
+	// migrations create the state directory before moving anything to it
+	if _, err := os.Stat(filepath.Join(d, reportDir)); !os.IsNotExist(err) {
+		return "", false, nil
+	}
+	if _, err := os.Stat(filepath.Join(old, reportDir)); err != nil {
+		return "", false, nil
+	}
+	return old, true, nil
 }
 
-func cacheDir() (string, error) {
-	d := os.Getenv("XDG_CACHE_HOME")
+// xdgDir returns the directory set by env, or defaultDir relative to user home directory
+func xdgDir(env, defaultDir string) (string, error) {
+	d := os.Getenv(env)
 	if filepath.IsAbs(d) {
 		return d, nil
 	}
 
 	if d == "" {
-		d = defaultCacheDir
+		d = defaultDir
 	}
 	h, err := getHomeDir()
 	if err != nil {
@@ -20,7 +20,7 @@ func TestReportPath(t *testing.T) {
 	testCases := []struct {
 		name            string
 		home            string
-		xdg_cache_dir   string
+		xdg_state_dir   string
 		distro          string
 		version         string
 		explicitacheDir string
@@ -28,19 +28,20 @@ func TestReportPath(t *testing.T) {
 		want    string
 		wantErr bool
 	}{
-		{"regular", "/some/dir", "", "distroname", "versionnumber", "", "/some/dir/.cache/ubuntu-report/distroname.versionnumber", false},
-		{"relative xdg path", "/some/dir", "xdg_cache_path", "distroname", "versionnumber", "", "/some/dir/xdg_cache_path/ubuntu-report/distroname.versionnumber", false},
-		{"absolute xdg path", "/some/dir", "/xdg_cache_path", "distroname", "versionnumber", "", "/xdg_cache_path/ubuntu-report/distroname.versionnumber", false},
-		{"no home dir", "", "", "distroname", "versionnumber", "", u.HomeDir + "/.cache/ubuntu-report/distroname.versionnumber", false},
-		{"no distro name", "/some/dir", "", "", "versionnumber", "", "/some/dir/.cache/ubuntu-report/.versionnumber", false},
-		{"no version name", "/some/dir", "", "distroname", "", "", "/some/dir/.cache/ubuntu-report/distroname.", false},
+		{"regular", "/some/dir", "", "distroname", "versionnumber", "", "/some/dir/.local/state/ubuntu-report/distroname.versionnumber", false},
+		{"relative xdg path", "/some/dir", "xdg_state_path", "distroname", "versionnumber", "", "/some/dir/xdg_state_path/ubuntu-report/distroname.versionnumber", false},
+		{"absolute xdg path", "/some/dir", "/xdg_state_path", "distroname", "versionnumber", "", "/xdg_state_path/ubuntu-report/distroname.versionnumber", false},
+		{"no home dir", "", "", "distroname", "versionnumber", "", u.HomeDir + "/.local/state/ubuntu-report/distroname.versionnumber", false},
+		{"no distro name", "/some/dir", "", "", "versionnumber", "", "/some/dir/.local/state/ubuntu-report/.versionnumber", false},
+		{"no version name", "/some/dir", "", "distroname", "", "", "/some/dir/.local/state/ubuntu-report/distroname.", false},
 		{"explicit cache dir", "", "", "distroname", "versionnumber", "/explicit/cachedir", "/explicit/cachedir/ubuntu-report/distroname.versionnumber", false},
-		{"explicit cache dir takes predecedence", "/some/dir", "/xdg_cache_path", "distroname", "versionnumber", "/explicit/cachedir", "/explicit/cachedir/ubuntu-report/distroname.versionnumber", false},
+		{"explicit cache dir takes predecedence", "/some/dir", "/xdg_state_path", "distroname", "versionnumber", "/explicit/cachedir", "/explicit/cachedir/ubuntu-report/distroname.versionnumber", false},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			defer changeEnv(t, "HOME", tc.home)()
-			defer changeEnv(t, "XDG_CACHE_HOME", tc.xdg_cache_dir)()
+			defer changeEnv(t, "XDG_STATE_HOME", tc.xdg_state_dir)()
+			defer changeEnv(t, "XDG_CACHE_HOME", "/nonexistent")()
 			a := helper.Asserter{T: t}
 
 			got, err := utils.ReportPath(tc.distro, tc.version, tc.explicitacheDir)
@@ -62,23 +63,24 @@ func TestPendingReportPath(t *testing.T) {
 	testCases := []struct {
 		name            string
 		home            string
-		xdg_cache_dir   string
+		xdg_state_dir   string
 		explicitacheDir string
 
 		want    string
 		wantErr bool
 	}{
-		{"regular", "/some/dir", "", "", "/some/dir/.cache/ubuntu-report/pending", false},
-		{"relative xdg path", "/some/dir", "xdg_cache_path", "", "/some/dir/xdg_cache_path/ubuntu-report/pending", false},
-		{"absolute xdg path", "/some/dir", "/xdg_cache_path", "", "/xdg_cache_path/ubuntu-report/pending", false},
-		{"no home dir", "", "", "", u.HomeDir + "/.cache/ubuntu-report/pending", false},
+		{"regular", "/some/dir", "", "", "/some/dir/.local/state/ubuntu-report/pending", false},
+		{"relative xdg path", "/some/dir", "xdg_state_path", "", "/some/dir/xdg_state_path/ubuntu-report/pending", false},
+		{"absolute xdg path", "/some/dir", "/xdg_state_path", "", "/xdg_state_path/ubuntu-report/pending", false},
+		{"no home dir", "", "", "", u.HomeDir + "/.local/state/ubuntu-report/pending", false},
 		{"explicit cache dir", "", "", "/explicit/cachedir", "/explicit/cachedir/ubuntu-report/pending", false},
-		{"explicit cache dir takes predecedence", "/some/dir", "/xdg_cache_path", "/explicit/cachedir", "/explicit/cachedir/ubuntu-report/pending", false},
+		{"explicit cache dir takes predecedence", "/some/dir", "/xdg_state_path", "/explicit/cachedir", "/explicit/cachedir/ubuntu-report/pending", false},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			defer changeEnv(t, "HOME", tc.home)()
-			defer changeEnv(t, "XDG_CACHE_HOME", tc.xdg_cache_dir)()
+			defer changeEnv(t, "XDG_STATE_HOME", tc.xdg_state_dir)()
+			defer changeEnv(t, "XDG_CACHE_HOME", "/nonexistent")()
 			a := helper.Asserter{T: t}
 
 			got, err := utils.PendingReportPath(tc.explicitacheDir)
@@ -89,6 +91,33 @@ func TestPendingReportPath(t *testing.T) {
 	}
 }
 
+func TestUserConfigPath(t *testing.T) {
+	testCases := []struct {
+		name           string
+		home           string
+		xdg_config_dir string
+
+		want    string
+		wantErr bool
+	}{
+		{"regular", "/some/dir", "", "/some/dir/.config/ubuntu-report/config.yaml", false},
+		{"relative xdg path", "/some/dir", "xdg_config_path", "/some/dir/xdg_config_path/ubuntu-report/config.yaml", false},
+		{"absolute xdg path", "/some/dir", "/xdg_config_path", "/xdg_config_path/ubuntu-report/config.yaml", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			defer changeEnv(t, "HOME", tc.home)()
+			defer changeEnv(t, "XDG_CONFIG_HOME", tc.xdg_config_dir)()
+			a := helper.Asserter{T: t}
+
+			got, err := utils.UserConfigPath()
+
+			a.CheckWantedErr(err, tc.wantErr)
+			a.Equal(got, tc.want)
+		})
+	}
+}
+
 func changeEnv(t *testing.T, key, value string) func() {
 	t.Helper()
 	orig := os.Getenv(key)
@@ -102,3 +131,177 @@ func changeEnv(t *testing.T, key, value string) func() {
 		}
 	}
 }
+
+func TestServerStatePath(t *testing.T) {
+	testCases := []struct {
+		name            string
+		home            string
+		xdg_state_dir   string
+		explicitacheDir string
+
+		want    string
+		wantErr bool
+	}{
+		{"regular", "/some/dir", "", "", "/some/dir/.local/state/ubuntu-report/servers", false},
+		{"absolute xdg path", "/some/dir", "/xdg_state_path", "", "/xdg_state_path/ubuntu-report/servers", false},
+		{"explicit cache dir takes predecedence", "/some/dir", "/xdg_state_path", "/explicit/cachedir", "/explicit/cachedir/ubuntu-report/servers", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			defer changeEnv(t, "HOME", tc.home)()
+			defer changeEnv(t, "XDG_STATE_HOME", tc.xdg_state_dir)()
+			defer changeEnv(t, "XDG_CACHE_HOME", "/nonexistent")()
+			a := helper.Asserter{T: t}
+
+			got, err := utils.ServerStatePath(tc.explicitacheDir)
+
+			a.CheckWantedErr(err, tc.wantErr)
+			a.Equal(got, tc.want)
+		})
+	}
+}
+
+func TestReceiptsPath(t *testing.T) {
+	testCases := []struct {
+		name            string
+		home            string
+		xdg_state_dir   string
+		explicitacheDir string
+
+		want    string
+		wantErr bool
+	}{
+		{"regular", "/some/dir", "", "", "/some/dir/.local/state/ubuntu-report/receipts", false},
+		{"absolute xdg path", "/some/dir", "/xdg_state_path", "", "/xdg_state_path/ubuntu-report/receipts", false},
+		{"explicit cache dir takes predecedence", "/some/dir", "/xdg_state_path", "/explicit/cachedir", "/explicit/cachedir/ubuntu-report/receipts", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			defer changeEnv(t, "HOME", tc.home)()
+			defer changeEnv(t, "XDG_STATE_HOME", tc.xdg_state_dir)()
+			defer changeEnv(t, "XDG_CACHE_HOME", "/nonexistent")()
+			a := helper.Asserter{T: t}
+
+			got, err := utils.ReceiptsPath(tc.explicitacheDir)
+
+			a.CheckWantedErr(err, tc.wantErr)
+			a.Equal(got, tc.want)
+		})
+	}
+}
+
+func TestExportedBundlePath(t *testing.T) {
+	testCases := []struct {
+		name            string
+		home            string
+		xdg_state_dir   string
+		explicitacheDir string
+
+		want    string
+		wantErr bool
+	}{
+		{"regular", "/some/dir", "", "", "/some/dir/.local/state/ubuntu-report/exported.key", false},
+		{"absolute xdg path", "/some/dir", "/xdg_state_path", "", "/xdg_state_path/ubuntu-report/exported.key", false},
+		{"explicit cache dir takes predecedence", "/some/dir", "/xdg_state_path", "/explicit/cachedir", "/explicit/cachedir/ubuntu-report/exported.key", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			defer changeEnv(t, "HOME", tc.home)()
+			defer changeEnv(t, "XDG_STATE_HOME", tc.xdg_state_dir)()
+			defer changeEnv(t, "XDG_CACHE_HOME", "/nonexistent")()
+			a := helper.Asserter{T: t}
+
+			got, err := utils.ExportedBundlePath("key", tc.explicitacheDir)
+
+			a.CheckWantedErr(err, tc.wantErr)
+			a.Equal(got, tc.want)
+		})
+	}
+}
+
+func TestLockPath(t *testing.T) {
+	testCases := []struct {
+		name            string
+		home            string
+		xdg_state_dir   string
+		explicitacheDir string
+
+		want    string
+		wantErr bool
+	}{
+		{"regular", "/some/dir", "", "", "/some/dir/.local/state/ubuntu-report/lock", false},
+		{"absolute xdg path", "/some/dir", "/xdg_state_path", "", "/xdg_state_path/ubuntu-report/lock", false},
+		{"explicit cache dir takes predecedence", "/some/dir", "/xdg_state_path", "/explicit/cachedir", "/explicit/cachedir/ubuntu-report/lock", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			defer changeEnv(t, "HOME", tc.home)()
+			defer changeEnv(t, "XDG_STATE_HOME", tc.xdg_state_dir)()
+			defer changeEnv(t, "XDG_CACHE_HOME", "/nonexistent")()
+			a := helper.Asserter{T: t}
+
+			got, err := utils.LockPath(tc.explicitacheDir)
+
+			a.CheckWantedErr(err, tc.wantErr)
+			a.Equal(got, tc.want)
+		})
+	}
+}
+
+func TestConsentPath(t *testing.T) {
+	testCases := []struct {
+		name            string
+		home            string
+		xdg_state_dir   string
+		explicitacheDir string
+
+		want    string
+		wantErr bool
+	}{
+		{"regular", "/some/dir", "", "", "/some/dir/.local/state/ubuntu-report/user-consent", false},
+		{"absolute xdg path", "/some/dir", "/xdg_state_path", "", "/xdg_state_path/ubuntu-report/user-consent", false},
+		{"explicit cache dir takes predecedence", "/some/dir", "/xdg_state_path", "/explicit/cachedir", "/explicit/cachedir/ubuntu-report/user-consent", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			defer changeEnv(t, "HOME", tc.home)()
+			defer changeEnv(t, "XDG_STATE_HOME", tc.xdg_state_dir)()
+			defer changeEnv(t, "XDG_CACHE_HOME", "/nonexistent")()
+			a := helper.Asserter{T: t}
+
+			got, err := utils.ConsentPath(tc.explicitacheDir)
+
+			a.CheckWantedErr(err, tc.wantErr)
+			a.Equal(got, tc.want)
+		})
+	}
+}
+
+func TestLedgerPath(t *testing.T) {
+	testCases := []struct {
+		name            string
+		home            string
+		xdg_state_dir   string
+		explicitacheDir string
+
+		want    string
+		wantErr bool
+	}{
+		{"regular", "/some/dir", "", "", "/some/dir/.local/state/ubuntu-report/uploads", false},
+		{"absolute xdg path", "/some/dir", "/xdg_state_path", "", "/xdg_state_path/ubuntu-report/uploads", false},
+		{"explicit cache dir takes predecedence", "/some/dir", "/xdg_state_path", "/explicit/cachedir", "/explicit/cachedir/ubuntu-report/uploads", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			defer changeEnv(t, "HOME", tc.home)()
+			defer changeEnv(t, "XDG_STATE_HOME", tc.xdg_state_dir)()
+			defer changeEnv(t, "XDG_CACHE_HOME", "/nonexistent")()
+			a := helper.Asserter{T: t}
+
+			got, err := utils.LedgerPath(tc.explicitacheDir)
+
+			a.CheckWantedErr(err, tc.wantErr)
+			a.Equal(got, tc.want)
+		})
+	}
+}
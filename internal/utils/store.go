@@ -0,0 +1,198 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ChecksumExt is appended to a stored file path to store its checksum.
+// The checksum file is compatible with sha256sum -c.
+const ChecksumExt = ".sha256"
+
+// ErrCorrupted is the cause of errors returned when reading a stored file which doesn't match its checksum
+var ErrCorrupted = errors.New("file doesn't match its checksum")
+
+// WriteFile saves data to p, readable only by the current user.
+// The file is replaced atomically and its checksum is saved alongside it, so that a crash while
+// writing either leaves the previous version or the new one in place.
+func WriteFile(p string, data []byte) error {
+	return WriteFileWithMode(p, data, 0600)
+}
+
+// WriteFileWithMode is WriteFile with perm permissions on the file and its checksum.
+// Parent directories are created if needed, only accessible by the current user.
+func WriteFileWithMode(p string, data []byte, perm os.FileMode) error {
+	d := filepath.Dir(p)
+	if err := os.MkdirAll(d, 0700); err != nil {
+		return errors.Wrapf(err, "couldn't create parent directory of %s", p)
+	}
+
+	tmpData, err := writeTemp(d, filepath.Base(p), data, perm)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpData)
+	h := sha256.Sum256(data)
+	tmpSum, err := writeTemp(d, filepath.Base(p)+ChecksumExt, []byte(fmt.Sprintf("%x  %s\n", h, filepath.Base(p))), perm)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpSum)
+
+	// the old checksum goes first: a crash before the new one is in place leaves a file without
+	// checksum, which isn't reported as corrupted
+	if err := os.Remove(p + ChecksumExt); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "couldn't remove previous checksum of %s", p)
+	}
+	if err := os.Rename(tmpData, p); err != nil {
+		return errors.Wrapf(err, "couldn't save %s", p)
+	}
+	if err := os.Rename(tmpSum, p+ChecksumExt); err != nil {
+		return errors.Wrapf(err, "couldn't save checksum of %s", p)
+	}
+	return syncDir(d)
+}
+
+// ReadFile returns the content of p, saved by WriteFile.
+// Its cause is ErrCorrupted if the content doesn't match its checksum. Files without any
+// checksum are returned as is.
+func ReadFile(p string) ([]byte, error) {
+	data, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+
+	sum, err := ioutil.ReadFile(p + ChecksumExt)
+	if os.IsNotExist(err) {
+		return data, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "couldn't read checksum of %s", p)
+	}
+	fields := strings.Fields(string(sum))
+	h := sha256.Sum256(data)
+	if len(fields) == 0 || fields[0] != hex.EncodeToString(h[:]) {
+		return nil, errors.Wrapf(ErrCorrupted, "%s is corrupted", p)
+	}
+	return data, nil
+}
+
+// RemoveFile deletes p, saved by WriteFile, and its checksum
+func RemoveFile(p string) error {
+	if err := os.Remove(p + ChecksumExt); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "couldn't remove checksum of %s", p)
+	}
+	return os.Remove(p)
+}
+
+// AppendLine adds line and a newline at the end of p, readable only by the current user,
+// and flushes it to disk. It's meant for append-only records, which aren't checksummed: an
+// interrupted write can leave a partial last line, which readers should skip. It's terminated
+// before appending, so that the new line stays on its own.
+func AppendLine(p string, line []byte) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return errors.Wrapf(err, "couldn't create parent directory of %s", p)
+	}
+	f, err := os.OpenFile(p, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't open %s", p)
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return errors.Wrapf(err, "couldn't stat %s", p)
+	}
+	var buf bytes.Buffer
+	if fi.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, fi.Size()-1); err != nil {
+			return errors.Wrapf(err, "couldn't read end of %s", p)
+		}
+		if last[0] != '\n' {
+			buf.WriteByte('\n')
+		}
+	}
+	buf.Write(line)
+	buf.WriteByte('\n')
+	if _, err := buf.WriteTo(f); err != nil {
+		return errors.Wrapf(err, "couldn't append to %s", p)
+	}
+	if err := f.Sync(); err != nil {
+		return errors.Wrapf(err, "couldn't flush %s to disk", p)
+	}
+	return nil
+}
+
+// ReplaceLines replaces the content of p, written by AppendLine, with lines, like when pruning old records.
+// The file is replaced atomically, readable only by the current user.
+func ReplaceLines(p string, lines [][]byte) error {
+	var buf bytes.Buffer
+	for _, l := range lines {
+		buf.Write(l)
+		buf.WriteByte('\n')
+	}
+	d := filepath.Dir(p)
+	tmp, err := writeTemp(d, filepath.Base(p), buf.Bytes(), 0600)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, p); err != nil {
+		os.Remove(tmp)
+		return errors.Wrapf(err, "couldn't save %s", p)
+	}
+	return syncDir(d)
+}
+
+// IsChecksumFile returns true if p is the checksum of a stored file
+func IsChecksumFile(p string) bool {
+	return strings.HasSuffix(p, ChecksumExt)
+}
+
+// writeTemp saves data to a new temporary file in d, flushed to disk, and returns its path
+func writeTemp(d, name string, data []byte, perm os.FileMode) (string, error) {
+	f, err := ioutil.TempFile(d, "."+name+".")
+	if err != nil {
+		return "", errors.Wrapf(err, "couldn't create temporary file for %s", name)
+	}
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", errors.Wrapf(err, "couldn't set permissions of %s", name)
+	}
+	if _, err := bytes.NewReader(data).WriteTo(f); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", errors.Wrapf(err, "couldn't write %s", name)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", errors.Wrapf(err, "couldn't flush %s to disk", name)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", errors.Wrapf(err, "couldn't close %s", name)
+	}
+	return f.Name(), nil
+}
+
+// syncDir flushes renames in d to disk
+func syncDir(d string) error {
+	f, err := os.Open(d)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't open %s", d)
+	}
+	defer f.Close()
+	if err := f.Sync(); err != nil {
+		return errors.Wrapf(err, "couldn't flush %s to disk", d)
+	}
+	return nil
+}
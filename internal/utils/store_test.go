@@ -0,0 +1,183 @@
+package utils_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/ubuntu/ubuntu-report/internal/helper"
+	"github.com/ubuntu/ubuntu-report/internal/utils"
+)
+
+func TestWriteAndReadFile(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		previous string
+		data     string
+	}{
+		{"new file", "", "some data"},
+		{"replace file", "previous data", "some data"},
+		{"empty file", "", ""},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			d, tearDown := helper.TempDir(t)
+			defer tearDown()
+			p := filepath.Join(d, "ubuntu-report", "ubuntu.18.04")
+			if tc.previous != "" {
+				if err := utils.WriteFile(p, []byte(tc.previous)); err != nil {
+					t.Fatal("couldn't write previous file:", err)
+				}
+			}
+
+			err := utils.WriteFile(p, []byte(tc.data))
+
+			a.CheckWantedErr(err, false)
+			got, err := utils.ReadFile(p)
+			a.CheckWantedErr(err, false)
+			a.Equal(string(got), tc.data)
+			for _, f := range []string{p, p + utils.ChecksumExt} {
+				fi, err := os.Stat(f)
+				if err != nil {
+					t.Fatalf("%s should exist: %v", f, err)
+				}
+				a.Equal(fi.Mode().Perm(), os.FileMode(0600))
+			}
+			// no temporary file is left behind
+			files, _ := ioutil.ReadDir(filepath.Dir(p))
+			a.Equal(len(files), 2)
+		})
+	}
+}
+
+func TestReadFileCorrupted(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		checksum *string
+
+		wantCorrupted bool
+	}{
+		{"file without checksum is accepted", nil, false},
+		{"checksum mismatch", strPtr("0000  ubuntu.18.04\n"), true},
+		{"empty checksum", strPtr(""), true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			d, tearDown := helper.TempDir(t)
+			defer tearDown()
+			p := filepath.Join(d, "ubuntu.18.04")
+			if err := ioutil.WriteFile(p, []byte("some data"), 0600); err != nil {
+				t.Fatal("couldn't write file:", err)
+			}
+			if tc.checksum != nil {
+				if err := ioutil.WriteFile(p+utils.ChecksumExt, []byte(*tc.checksum), 0600); err != nil {
+					t.Fatal("couldn't write checksum:", err)
+				}
+			}
+
+			got, err := utils.ReadFile(p)
+
+			a.Equal(errors.Cause(err) == utils.ErrCorrupted, tc.wantCorrupted)
+			if !tc.wantCorrupted {
+				a.Equal(string(got), "some data")
+			}
+		})
+	}
+}
+
+func TestRemoveFile(t *testing.T) {
+	t.Parallel()
+	a := helper.Asserter{T: t}
+
+	d, tearDown := helper.TempDir(t)
+	defer tearDown()
+	p := filepath.Join(d, "pending")
+	if err := utils.WriteFile(p, []byte("some data")); err != nil {
+		t.Fatal("couldn't write file:", err)
+	}
+
+	err := utils.RemoveFile(p)
+
+	a.CheckWantedErr(err, false)
+	files, _ := ioutil.ReadDir(d)
+	a.Equal(len(files), 0)
+	a.CheckWantedErr(utils.RemoveFile(p), true)
+}
+
+func TestAppendLine(t *testing.T) {
+	t.Parallel()
+	a := helper.Asserter{T: t}
+
+	d, tearDown := helper.TempDir(t)
+	defer tearDown()
+	p := filepath.Join(d, "ubuntu-report", "uploads")
+
+	a.CheckWantedErr(utils.AppendLine(p, []byte("first")), false)
+	a.CheckWantedErr(utils.AppendLine(p, []byte("second")), false)
+
+	got, err := ioutil.ReadFile(p)
+	a.CheckWantedErr(err, false)
+	a.Equal(string(got), "first\nsecond\n")
+	fi, err := os.Stat(p)
+	if err != nil {
+		t.Fatalf("%s should exist: %v", p, err)
+	}
+	a.Equal(fi.Mode().Perm(), os.FileMode(0600))
+}
+
+func TestAppendLineAfterPartialLine(t *testing.T) {
+	t.Parallel()
+	a := helper.Asserter{T: t}
+
+	d, tearDown := helper.TempDir(t)
+	defer tearDown()
+	p := filepath.Join(d, "uploads")
+	// an interrupted write left a partial last line
+	if err := ioutil.WriteFile(p, []byte("first\nsec"), 0600); err != nil {
+		t.Fatal("couldn't write file:", err)
+	}
+
+	a.CheckWantedErr(utils.AppendLine(p, []byte("third")), false)
+
+	got, err := ioutil.ReadFile(p)
+	a.CheckWantedErr(err, false)
+	a.Equal(string(got), "first\nsec\nthird\n")
+}
+
+func TestReplaceLines(t *testing.T) {
+	t.Parallel()
+	a := helper.Asserter{T: t}
+
+	d, tearDown := helper.TempDir(t)
+	defer tearDown()
+	p := filepath.Join(d, "uploads")
+	a.CheckWantedErr(utils.AppendLine(p, []byte("first")), false)
+
+	err := utils.ReplaceLines(p, [][]byte{[]byte("new first"), []byte("second")})
+
+	a.CheckWantedErr(err, false)
+	got, err := ioutil.ReadFile(p)
+	a.CheckWantedErr(err, false)
+	a.Equal(string(got), "new first\nsecond\n")
+	files, _ := ioutil.ReadDir(d)
+	a.Equal(len(files), 1)
+	a.Equal(files[0].Mode().Perm(), os.FileMode(0600))
+}
+
+func strPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+
+	"github.com/pkg/errors"
+)
+
+// TTYPath is the controlling terminal of the process
+const TTYPath = "/dev/tty"
+
+// IsTerminal returns if f is a terminal. Other character devices, like /dev/null, aren't.
+func IsTerminal(f *os.File) bool {
+	var t syscall.Termios
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), syscall.TCGETS, uintptr(unsafe.Pointer(&t)))
+	return errno == 0
+}
+
+// MakeRaw puts the terminal f in raw mode: keys are read as soon as typed, without echo nor signals.
+// The returned function restores its previous mode.
+func MakeRaw(f *os.File) (func() error, error) {
+	var old syscall.Termios
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), syscall.TCGETS, uintptr(unsafe.Pointer(&old))); errno != 0 {
+		return nil, errors.Wrapf(errno, "couldn't get terminal mode")
+	}
+
+	raw := old
+	raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cflag &^= syscall.CSIZE | syscall.PARENB
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), syscall.TCSETS, uintptr(unsafe.Pointer(&raw))); errno != 0 {
+		return nil, errors.Wrapf(errno, "couldn't set terminal in raw mode")
+	}
+
+	return func() error {
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), syscall.TCSETS, uintptr(unsafe.Pointer(&old))); errno != 0 {
+			return errors.Wrapf(errno, "couldn't restore terminal mode")
+		}
+		return nil
+	}, nil
+}
+
+// TerminalRows returns the number of rows of the terminal f, or 0 if unknown
+func TerminalRows(f *os.File) int {
+	var ws struct{ Row, Col, Xpixel, Ypixel uint16 }
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), syscall.TIOCGWINSZ, uintptr(unsafe.Pointer(&ws))); errno != 0 {
+		return 0
+	}
+	return int(ws.Row)
+}
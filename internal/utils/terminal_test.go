@@ -0,0 +1,82 @@
+package utils_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ubuntu/ubuntu-report/internal/helper"
+	"github.com/ubuntu/ubuntu-report/internal/utils"
+)
+
+func TestIsTerminal(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		// path is a new regular file if empty
+		path string
+	}{
+		{"regular file", ""},
+		{"character device which isn't a terminal", os.DevNull},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			p := tc.path
+			if p == "" {
+				d, tearDown := helper.TempDir(t)
+				defer tearDown()
+				p = filepath.Join(d, "file")
+				if err := ioutil.WriteFile(p, nil, 0600); err != nil {
+					t.Fatal("couldn't create file:", err)
+				}
+			}
+			f, err := os.Open(p)
+			if err != nil {
+				t.Fatal("couldn't open file:", err)
+			}
+			defer f.Close()
+
+			a.Equal(utils.IsTerminal(f), false)
+		})
+	}
+}
+
+func TestMakeRaw(t *testing.T) {
+	a := helper.Asserter{T: t}
+
+	typed, tearDown := helper.CaptureStdinTerminal(t)
+	defer tearDown()
+
+	restore, err := utils.MakeRaw(os.Stdin)
+	a.CheckWantedErr(err, false)
+	// keys are read as soon as typed, without waiting for a new line
+	if _, err := typed.Write([]byte("a")); err != nil {
+		t.Fatal("couldn't type into terminal:", err)
+	}
+	b := make([]byte, 1)
+	_, err = os.Stdin.Read(b)
+	a.CheckWantedErr(err, false)
+	a.Equal(string(b), "a")
+	a.CheckWantedErr(restore(), false)
+}
+
+func TestMakeRawNotTerminal(t *testing.T) {
+	t.Parallel()
+	a := helper.Asserter{T: t}
+
+	f, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal("couldn't open file:", err)
+	}
+	defer f.Close()
+
+	_, err = utils.MakeRaw(f)
+	a.CheckWantedErr(err, true)
+	a.Equal(utils.TerminalRows(f), 0)
+}
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"strconv"
+	"strings"
+)
+
+// CompareVersions orders release versions, like "9.10" < "17.04" < "18.04" < "18.04.1", numerically component
+// by component. Non numeric components are compared as strings, after numeric ones.
+// It returns -1 if a is older than b, 1 if it's newer and 0 if they are the same.
+func CompareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if c := compareVersionComponents(as[i], bs[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(as) < len(bs):
+		return -1
+	case len(as) > len(bs):
+		return 1
+	}
+	return 0
+}
+
+func compareVersionComponents(a, b string) int {
+	an, aErr := strconv.Atoi(a)
+	bn, bErr := strconv.Atoi(b)
+	switch {
+	case aErr == nil && bErr == nil:
+		return compareInts(an, bn)
+	case aErr == nil:
+		return -1
+	case bErr == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
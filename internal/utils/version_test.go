@@ -0,0 +1,42 @@
+package utils_test
+
+import (
+	"testing"
+
+	"github.com/ubuntu/ubuntu-report/internal/helper"
+	"github.com/ubuntu/ubuntu-report/internal/utils"
+)
+
+func TestCompareVersions(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		a string
+		b string
+
+		want int
+	}{
+		{"18.04", "18.04", 0},
+		{"17.10", "18.04", -1},
+		{"18.10", "18.04", 1},
+		{"9.10", "17.04", -1},
+		{"100.04", "99.10", 1},
+		{"18.04", "18.04.1", -1},
+		{"18.04.1", "18.04", 1},
+		{"18.04.2", "18.04.10", -1},
+		{"11", "9", 1},
+		{"2023.1", "2023.01", 0},
+		{"18.04", "18.devel", -1},
+		{"alpha", "beta", -1},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.a+" "+tc.b, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			a.Equal(utils.CompareVersions(tc.a, tc.b), tc.want)
+			a.Equal(utils.CompareVersions(tc.b, tc.a), -tc.want)
+		})
+	}
+}
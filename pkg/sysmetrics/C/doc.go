@@ -90,14 +90,16 @@
 //
 // sysmetrics_report_type is the following enum:
 //    typedef enum {
-//      // sysmetrics_report_interactive will show report content on stdout and read anwser on stdin
+//      // sysmetrics_report_interactive will show report content on stdout and read anwser on stdin.
+//      // It fails without prompting when stdin isn't a terminal.
 //      sysmetrics_report_interactive = 0,
 //      // sysmetrics_report_auto will send a report without printing report
 //      sysmetrics_report_auto = 1,
 //      // sysmetrics_report_optout will send opt-out message without printing report
 //      sysmetrics_report_optout = 2,
 //    } sysmetrics_report_type;
-// You should generally prefer in bindings the auto or optout report. Interactive is based on stdout and stdin.
+// You should generally prefer in bindings the auto or optout report. Interactive is based on stdout and stdin,
+// and returns an error when stdin isn't a terminal instead of prompting.
 // The report will not be sent if a report has already been sent for this version unless "alwaysReport" is true.
 // It can be sent to an alternative url via "baseURL" to send the report to. Empty string will send to default server.
 //
@@ -121,6 +123,20 @@
 //       free(err);
 //   }
 //
+// Configuration
+//
+// TLS settings (custom certificate authorities, client certificate, public key pinning) and the default
+// server url are read from /etc/ubuntu-report/config.yaml and $XDG_CONFIG_HOME/ubuntu-report/config.yaml.
+// Reports are only sent to https urls unless "insecure: true" is set in the "tls" section.
+// "scope: machine" in the system configuration records reports once for all users of the machine.
+// This library never asks for authentication: reports are only recorded machine-wide when running as root.
+//
+// Locking
+//
+// Calls sending reports wait for other processes using this library or the ubuntu-report tool to finish
+// acting on reports. They return an error if the lock is still held after "lock-timeout" from the
+// configuration, 30 seconds by default.
+//
 // Building as a shared library
 //
 // The following command (in the pkg/sysmetrics/C directory) will provide a .h and .so file:
@@ -23,9 +23,11 @@ import (
 // Similar technic than in https://golang.org/misc/cgo/test/cgo_test.go
 func TestCollect(t *testing.T)                      { testCollect(t) }
 func TestSendReport(t *testing.T)                   { testSendReport(t) }
+func TestSendReportLocked(t *testing.T)             { testSendReportLocked(t) }
 func TestSendDecline(t *testing.T)                  { testSendDecline(t) }
 func TestNonInteractiveCollectAndSend(t *testing.T) { testNonInteractiveCollectAndSend(t) }
 func TestInteractiveCollectAndSend(t *testing.T)    { testInteractiveCollectAndSend(t) }
+func TestInteractiveWithoutTerminal(t *testing.T)   { testInteractiveWithoutTerminal(t) }
 
 func TestCollectExample(t *testing.T) {
 	helper.SkipIfShort(t)
@@ -76,7 +78,7 @@ func TestSendReportExample(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	cmd := exec.CommandContext(ctx, binary)
-	cmd.Env = append(cmd.Env, "LD_LIBRARY_PATH="+out, "XDG_CACHE_HOME="+out)
+	cmd.Env = append(cmd.Env, "LD_LIBRARY_PATH="+out, "XDG_CACHE_HOME="+out, "XDG_STATE_HOME="+out, "XDG_CONFIG_HOME="+allowInsecure(t, out))
 	err := cmd.Run()
 
 	if err != nil {
@@ -89,7 +91,7 @@ func TestSendReportExample(t *testing.T) {
 
 	a.Equal(serverHit, true)
 	xdgP := filepath.Join(out, "ubuntu-report")
-	p = filepath.Join(xdgP, helper.FindInDirectory(t, "", xdgP))
+	p = filepath.Join(xdgP, helper.FindReportInDirectory(t, xdgP))
 	data, err := ioutil.ReadFile(p)
 	if err != nil {
 		t.Fatalf("couldn't open report file %s", p)
@@ -124,7 +126,7 @@ func TestSendDeclineExample(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	cmd := exec.CommandContext(ctx, binary)
-	cmd.Env = append(cmd.Env, "LD_LIBRARY_PATH="+out, "XDG_CACHE_HOME="+out)
+	cmd.Env = append(cmd.Env, "LD_LIBRARY_PATH="+out, "XDG_CACHE_HOME="+out, "XDG_STATE_HOME="+out, "XDG_CONFIG_HOME="+allowInsecure(t, out))
 	err := cmd.Run()
 
 	if err != nil {
@@ -137,7 +139,7 @@ func TestSendDeclineExample(t *testing.T) {
 
 	a.Equal(serverHit, true)
 	xdgP := filepath.Join(out, "ubuntu-report")
-	p = filepath.Join(xdgP, helper.FindInDirectory(t, "", xdgP))
+	p = filepath.Join(xdgP, helper.FindReportInDirectory(t, xdgP))
 	data, err := ioutil.ReadFile(p)
 	if err != nil {
 		t.Fatalf("couldn't open report file %s", p)
@@ -172,7 +174,7 @@ func TestCollectAndSendExample(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	cmd := exec.CommandContext(ctx, binary)
-	cmd.Env = append(cmd.Env, "LD_LIBRARY_PATH="+out, "XDG_CACHE_HOME="+out)
+	cmd.Env = append(cmd.Env, "LD_LIBRARY_PATH="+out, "XDG_CACHE_HOME="+out, "XDG_STATE_HOME="+out, "XDG_CONFIG_HOME="+allowInsecure(t, out))
 	err := cmd.Run()
 
 	if err != nil {
@@ -185,7 +187,7 @@ func TestCollectAndSendExample(t *testing.T) {
 
 	a.Equal(serverHit, true)
 	xdgP := filepath.Join(out, "ubuntu-report")
-	p = filepath.Join(xdgP, helper.FindInDirectory(t, "", xdgP))
+	p = filepath.Join(xdgP, helper.FindReportInDirectory(t, xdgP))
 	data, err := ioutil.ReadFile(p)
 	if err != nil {
 		t.Fatalf("couldn't open report file %s", p)
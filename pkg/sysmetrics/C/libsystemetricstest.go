@@ -30,6 +30,7 @@ import (
 	"unsafe"
 
 	"github.com/ubuntu/ubuntu-report/internal/helper"
+	"github.com/ubuntu/ubuntu-report/internal/utils"
 	"github.com/ubuntu/ubuntu-report/pkg/sysmetrics"
 )
 
@@ -81,6 +82,8 @@ func testSendReport(t *testing.T) {
 			out, tearDown := helper.TempDir(t)
 			defer tearDown()
 			defer helper.ChangeEnv("XDG_CACHE_HOME", out)()
+			defer helper.ChangeEnv("XDG_STATE_HOME", out)()
+			defer helper.ChangeEnv("XDG_CONFIG_HOME", allowInsecure(t, out))()
 			out = filepath.Join(out, "ubuntu-report")
 			// we don't really care where we hit for this API integration test, internal ones test it
 			// and we don't really control /etc/os-release version and id.
@@ -103,7 +106,7 @@ func testSendReport(t *testing.T) {
 			}
 
 			a.Equal(serverHit, tc.shouldHitServer)
-			p := filepath.Join(out, helper.FindInDirectory(t, "", out))
+			p := filepath.Join(out, helper.FindReportInDirectory(t, out))
 			data, errread := ioutil.ReadFile(p)
 			if errread != nil {
 				t.Fatalf("couldn't open report file %s", out)
@@ -136,6 +139,8 @@ func testSendDecline(t *testing.T) {
 			out, tearDown := helper.TempDir(t)
 			defer tearDown()
 			defer helper.ChangeEnv("XDG_CACHE_HOME", out)()
+			defer helper.ChangeEnv("XDG_STATE_HOME", out)()
+			defer helper.ChangeEnv("XDG_CONFIG_HOME", allowInsecure(t, out))()
 			out = filepath.Join(out, "ubuntu-report")
 			// we don't really care where we hit for this API integration test, internal ones test it
 			// and we don't really control /etc/os-release version and id.
@@ -157,7 +162,7 @@ func testSendDecline(t *testing.T) {
 			}
 
 			a.Equal(serverHit, tc.shouldHitServer)
-			p := filepath.Join(out, helper.FindInDirectory(t, "", out))
+			p := filepath.Join(out, helper.FindReportInDirectory(t, out))
 			data, errread := ioutil.ReadFile(p)
 			if errread != nil {
 				t.Fatalf("couldn't open report file %s", out)
@@ -170,6 +175,41 @@ func testSendDecline(t *testing.T) {
 	}
 }
 
+func testSendReportLocked(t *testing.T) {
+	// we change current path and env variable: not parallelizable tests
+	helper.SkipIfShort(t)
+	a := helper.Asserter{T: t}
+
+	out, tearDown := helper.TempDir(t)
+	defer tearDown()
+	defer helper.ChangeEnv("XDG_CACHE_HOME", out)()
+	defer helper.ChangeEnv("XDG_STATE_HOME", out)()
+	defer helper.ChangeEnv("XDG_CONFIG_HOME", writeConfig(t, out, "tls:\n  insecure: true\nlock-timeout: 100ms\n"))()
+	// another instance is acting on reports
+	unlock, errLock := utils.Lock(filepath.Join(out, "ubuntu-report", "lock"), 0)
+	if errLock != nil {
+		t.Fatal("couldn't take the lock:", errLock)
+	}
+	defer unlock()
+	serverHit := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serverHit = true
+	}))
+	defer ts.Close()
+
+	cData := C.CString(fmt.Sprintf(`{ %s: "18.04" }`, expectedReportItem))
+	url := C.CString(ts.URL)
+	defer C.free(unsafe.Pointer(url))
+
+	err := C.sysmetrics_send_report(cData, C.uchar(0), url)
+	defer C.free(unsafe.Pointer(err))
+
+	if err == nil {
+		t.Fatal("we expected an error as another instance holds the lock and got none")
+	}
+	a.Equal(serverHit, false)
+}
+
 func testNonInteractiveCollectAndSend(t *testing.T) {
 	// we change current path and env variable: not parallelizable tests
 	helper.SkipIfShort(t)
@@ -192,6 +232,8 @@ func testNonInteractiveCollectAndSend(t *testing.T) {
 			out, tearDown := helper.TempDir(t)
 			defer tearDown()
 			defer helper.ChangeEnv("XDG_CACHE_HOME", out)()
+			defer helper.ChangeEnv("XDG_STATE_HOME", out)()
+			defer helper.ChangeEnv("XDG_CONFIG_HOME", allowInsecure(t, out))()
 			out = filepath.Join(out, "ubuntu-report")
 			// we don't really care where we hit for this API integration test, internal ones test it
 			// and we don't really control /etc/os-release version and id.
@@ -213,7 +255,7 @@ func testNonInteractiveCollectAndSend(t *testing.T) {
 			}
 
 			a.Equal(serverHit, tc.shouldHitServer)
-			p := filepath.Join(out, helper.FindInDirectory(t, "", out))
+			p := filepath.Join(out, helper.FindReportInDirectory(t, out))
 			data, errread := ioutil.ReadFile(p)
 			if errread != nil {
 				t.Fatalf("couldn't open report file %s", out)
@@ -268,6 +310,8 @@ func testInteractiveCollectAndSend(t *testing.T) {
 			out, tearDown := helper.TempDir(t)
 			defer tearDown()
 			defer helper.ChangeEnv("XDG_CACHE_HOME", out)()
+			defer helper.ChangeEnv("XDG_STATE_HOME", out)()
+			defer helper.ChangeEnv("XDG_CONFIG_HOME", allowInsecure(t, out))()
 			out = filepath.Join(out, "ubuntu-report")
 			// we don't really care where we hit for this API integration test, internal ones test it
 			// and we don't really control /etc/os-release version and id.
@@ -281,7 +325,8 @@ func testInteractiveCollectAndSend(t *testing.T) {
 
 			stdout, tearDown := helper.CaptureStdout(t)
 			defer tearDown()
-			stdin, tearDown := helper.CaptureStdin(t)
+			// the library only prompts in a terminal
+			stdin, tearDown := helper.CaptureStdinTerminal(t)
 			defer tearDown()
 
 			cmdErrs := helper.RunFunctionWithTimeout(t, func() error {
@@ -337,7 +382,7 @@ func testInteractiveCollectAndSend(t *testing.T) {
 				}
 				return
 			}
-			p := filepath.Join(out, helper.FindInDirectory(t, "", out))
+			p := filepath.Join(out, helper.FindReportInDirectory(t, out))
 			data, err := ioutil.ReadFile(p)
 			if err != nil {
 				t.Fatalf("couldn't open report file %s", out)
@@ -382,3 +427,77 @@ func dropCR(data []byte) []byte {
 	}
 	return data
 }
+
+func testInteractiveWithoutTerminal(t *testing.T) {
+	// we change current path and env variable: not parallelizable tests
+	helper.SkipIfShort(t)
+	a := helper.Asserter{T: t}
+
+	out, tearDown := helper.TempDir(t)
+	defer tearDown()
+	defer helper.ChangeEnv("XDG_CACHE_HOME", out)()
+	defer helper.ChangeEnv("XDG_STATE_HOME", out)()
+	defer helper.ChangeEnv("XDG_CONFIG_HOME", allowInsecure(t, out))()
+	out = filepath.Join(out, "ubuntu-report")
+	serverHit := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serverHit = true
+	}))
+	defer ts.Close()
+
+	stdout, restoreStdout := helper.CaptureStdout(t)
+	defer restoreStdout()
+	// stdin is a pipe, never a terminal: the library shouldn't prompt
+	stdin, tearDown := helper.CaptureStdin(t)
+	defer tearDown()
+	stdin.Write([]byte("yes\n"))
+	stdin.Close()
+
+	cmdErrs := helper.RunFunctionWithTimeout(t, func() error {
+		url := C.CString(ts.URL)
+		defer C.free(unsafe.Pointer(url))
+
+		errstr := C.sysmetrics_collect_and_send(C.sysmetrics_report_type(sysmetrics.ReportInteractive), C.uchar(0), url)
+		defer C.free(unsafe.Pointer(errstr))
+		restoreStdout()
+		if errstr != nil {
+			return errors.New(C.GoString(errstr))
+		}
+		return nil
+	})
+
+	err := <-cmdErrs
+	if err == nil {
+		t.Fatal("expected an error as stdin isn't a terminal, got none")
+	}
+	a.Equal(err.Error(), sysmetrics.ErrNoTerminal.Error())
+	printed, _ := ioutil.ReadAll(stdout)
+	a.Equal(string(printed), "")
+	a.Equal(serverHit, false)
+	if _, err := os.Stat(filepath.Join(out, "ubuntu-report")); err == nil || (err != nil && !os.IsNotExist(err)) {
+		t.Fatal("we didn't want to get a report but we got one")
+	}
+}
+
+// allowInsecure writes a user configuration under d allowing to send reports to plain http test servers.
+// It returns the directory to use as XDG_CONFIG_HOME.
+func allowInsecure(t *testing.T, d string) string {
+	t.Helper()
+
+	return writeConfig(t, d, "tls:\n  insecure: true\n")
+}
+
+// writeConfig writes content as the user configuration under d.
+// It returns the directory to use as XDG_CONFIG_HOME.
+func writeConfig(t *testing.T, d, content string) string {
+	t.Helper()
+
+	d = filepath.Join(d, "config")
+	if err := os.MkdirAll(filepath.Join(d, "ubuntu-report"), 0700); err != nil {
+		t.Fatalf("couldn't create configuration directory: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(d, "ubuntu-report", "config.yaml"), []byte(content), 0600); err != nil {
+		t.Fatalf("couldn't write configuration: %v", err)
+	}
+	return d
+}
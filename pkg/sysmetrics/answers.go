@@ -0,0 +1,197 @@
+package sysmetrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/ubuntu/ubuntu-report/internal/i18n"
+	"github.com/ubuntu/ubuntu-report/internal/utils"
+)
+
+// ErrNoTerminal is returned by interactive reports required to be answered in a terminal when stdin isn't one
+var ErrNoTerminal error = localizedError("stdin isn't a terminal: interactive reports can't be answered, use an automated or opt-out report instead")
+
+// WithAnswerTimeout gives up on interactive reports if the user doesn't answer within d: nothing is sent,
+// as when quitting. There is no timeout by default.
+func WithAnswerTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.answerTimeout = d
+	}
+}
+
+// WithTerminalRequired makes interactive reports fail with ErrNoTerminal when stdin isn't a terminal,
+// instead of asking on the controlling terminal of the process.
+func WithTerminalRequired() Option {
+	return func(o *options) {
+		o.terminalRequired = true
+	}
+}
+
+// isTerminal returns if s is a terminal
+func isTerminal(s interface{}) bool {
+	f, ok := s.(*os.File)
+	return ok && utils.IsTerminal(f)
+}
+
+// userCatalog returns the translations of messages in the language of the user
+func userCatalog() *i18n.Catalog {
+	return i18n.Load("", i18n.Language(os.Getenv))
+}
+
+// openTTY opens the controlling terminal of the process
+func openTTY() (io.ReadCloser, error) {
+	return os.Open(utils.TTYPath)
+}
+
+// answers are the lines, or keys in a raw terminal, typed by the user at interactive prompts
+type answers struct {
+	// in is where answers are read from
+	in      io.Reader
+	closeIn func() error
+	// out is where the user is told they didn't answer in time
+	out     io.Writer
+	catalog *i18n.Catalog
+	timeout time.Duration
+
+	// requests asks the reader goroutine to read the next answer with a function, sent on received.
+	// Answers are only read when asked for, so that nothing typed in between, like in an editor, is taken for one.
+	requests chan func(*bufio.Reader) answer
+	received chan answer
+	// reading is set while the requested answer wasn't received, like when the user didn't answer in time
+	reading bool
+	// done stops the reader goroutine
+	done chan struct{}
+}
+
+type answer struct {
+	text string
+	ok   bool
+}
+
+// answers returns the answers of the user to prompts written to out. They must be closed once done.
+// When stdin isn't a terminal but out is, like with redirected input, they are read from the controlling
+// terminal, if any. Other readers, and fully redirected stdin and stdout, are read as is.
+func (o options) answers(in io.Reader, out io.Writer) (*answers, error) {
+	a := &answers{closeIn: func() error { return nil }, out: out, catalog: o.catalog(), timeout: o.answerTimeout,
+		requests: make(chan func(*bufio.Reader) answer), received: make(chan answer), done: make(chan struct{})}
+
+	if f, ok := in.(*os.File); ok && !o.isTerminal(f) {
+		if o.terminalRequired {
+			return nil, ErrNoTerminal
+		}
+		if o.isTerminal(out) {
+			tty, err := o.openTTY()
+			if err != nil {
+				log.Infof("stdin isn't a terminal and there is no controlling terminal, reading answers from stdin: "+utils.ErrFormat, err)
+			} else {
+				log.Debugf("stdin isn't a terminal, reading answers from %s", utils.TTYPath)
+				in, a.closeIn = tty, tty.Close
+			}
+		}
+	}
+
+	a.in = in
+	go a.read(bufio.NewReader(in))
+	return a, nil
+}
+
+// read sends an answer read from r on received each time one is requested, until answers are closed.
+// A read blocked on an input which isn't closed with answers, like stdin, only ends with that input.
+func (a *answers) read(r *bufio.Reader) {
+	for {
+		var read func(*bufio.Reader) answer
+		select {
+		case read = <-a.requests:
+		case <-a.done:
+			return
+		}
+		l := read(r)
+		select {
+		case a.received <- l:
+		case <-a.done:
+			return
+		}
+	}
+}
+
+// readLine reads a line, without its end of line characters
+func readLine(r *bufio.Reader) answer {
+	l, err := r.ReadString('\n')
+	if err != nil && l == "" {
+		return answer{}
+	}
+	return answer{strings.TrimSuffix(strings.TrimSuffix(l, "\n"), "\r"), true}
+}
+
+// readKey reads a key typed in a raw terminal: a character, or the escape sequence of special keys, like arrows
+func readKey(r *bufio.Reader) answer {
+	c, _, err := r.ReadRune()
+	if err != nil {
+		return answer{}
+	}
+	// escape sequences are received at once, while the escape key is alone
+	if c != '\x1b' || r.Buffered() == 0 {
+		return answer{string(c), true}
+	}
+	seq := []rune{c}
+	for r.Buffered() > 0 {
+		c, _, err := r.ReadRune()
+		if err != nil {
+			break
+		}
+		seq = append(seq, c)
+		// sequences are ended by their final byte, after their control sequence introducer
+		if (len(seq) == 2 && c != '[' && c != 'O') || (len(seq) > 2 && c >= 0x40 && c <= 0x7e) {
+			break
+		}
+	}
+	return answer{string(seq), true}
+}
+
+// next returns the next line, or false if there is none: input ended or the user didn't answer in time
+func (a *answers) next() (string, bool) {
+	return a.get(readLine)
+}
+
+// nextKey returns the next key typed in a raw terminal, or false if there is none, as next
+func (a *answers) nextKey() (string, bool) {
+	return a.get(readKey)
+}
+
+// get returns the next answer read with read, or the one already requested if the user didn't answer in time
+func (a *answers) get(read func(*bufio.Reader) answer) (string, bool) {
+	if !a.reading {
+		a.requests <- read
+		a.reading = true
+	}
+
+	var timeout <-chan time.Time
+	if a.timeout > 0 {
+		t := time.NewTimer(a.timeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	select {
+	case l := <-a.received:
+		a.reading = false
+		return l.text, l.ok
+	case <-timeout:
+		tr := a.catalog
+		fmt.Fprintf(a.out, "\n"+tr.Get("No answer after %s, nothing was sent.")+"\n", a.timeout)
+		return "", false
+	}
+}
+
+// close stops reading answers and releases the controlling terminal if they were read from it
+func (a *answers) close() {
+	close(a.done)
+	if err := a.closeIn(); err != nil {
+		log.Debugf("couldn't close answers input: "+utils.ErrFormat, err)
+	}
+}
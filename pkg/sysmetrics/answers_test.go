@@ -0,0 +1,287 @@
+package sysmetrics
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ubuntu/ubuntu-report/internal/helper"
+	"github.com/ubuntu/ubuntu-report/internal/i18n"
+	"github.com/ubuntu/ubuntu-report/internal/utils"
+)
+
+func TestInteractiveMetricsCollectAndSendAnswers(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name             string
+		stdin            string
+		outTerminal      bool
+		tty              io.Reader
+		terminalRequired bool
+		timeout          time.Duration
+
+		wantSent   bool
+		wantOptOut bool
+		wantOut    string
+		wantErr    error
+	}{
+		{"redirected stdin reads from terminal", "n\n", true, strings.NewReader("y\n"), false, 0, true, false, "Do you agree", nil},
+		{"redirected stdin without terminal reads from stdin", "n\n", true, nil, false, 0, true, true, "Do you agree", nil},
+		{"redirected stdin and stdout read from stdin", "n\n", false, strings.NewReader("y\n"), false, 0, true, true, "Do you agree", nil},
+		{"answered before timeout", "", true, strings.NewReader("y\n"), false, time.Minute, true, false, "Do you agree", nil},
+		{"no answer before timeout", "", true, blockingReader(t), false, 10 * time.Millisecond, false, false, "No answer after 10ms", nil},
+
+		{"terminal required", "y\n", true, strings.NewReader("y\n"), true, 0, false, false, "", ErrNoTerminal},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			defer ts.Close()
+
+			p := filepath.Join(out, "stdin")
+			if err := ioutil.WriteFile(p, []byte(tc.stdin), 0600); err != nil {
+				t.Fatal("couldn't write stdin:", err)
+			}
+			stdin, err := os.Open(p)
+			if err != nil {
+				t.Fatal("couldn't open stdin:", err)
+			}
+			defer stdin.Close()
+			stdout := &bytes.Buffer{}
+
+			opts := []Option{WithInsecure(), WithAnswerTimeout(tc.timeout), func(o *options) {
+				o.isTerminal = func(s interface{}) bool { return s == stdout && tc.outTerminal }
+				o.openTTY = func() (io.ReadCloser, error) {
+					if tc.tty == nil {
+						return nil, errors.New("no controlling terminal")
+					}
+					return ioutil.NopCloser(tc.tty), nil
+				}
+			}}
+			if tc.terminalRequired {
+				opts = append(opts, WithTerminalRequired())
+			}
+
+			m, cancel := newDiffTestMetrics(t)
+			defer cancel()
+			err = metricsCollectAndSend(m, ReportInteractive, false, ts.URL, out, stdin, stdout, opts...)
+
+			a.CheckWantedErr(err, tc.wantErr != nil)
+			if tc.wantErr != nil {
+				a.Equal(err, tc.wantErr)
+			}
+			if !strings.Contains(stdout.String(), tc.wantOut) {
+				t.Errorf("expected %q to be printed, got: %s", tc.wantOut, stdout.String())
+			}
+			if tc.wantOut == "" {
+				a.Equal(stdout.String(), "")
+			}
+			b, err := ioutil.ReadFile(filepath.Join(out, "ubuntu-report", "ubuntu.18.04"))
+			if !tc.wantSent {
+				if !os.IsNotExist(err) {
+					t.Errorf("we didn't expect any report to be sent, got: %s", b)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("we expected a report to be sent:", err)
+			}
+			a.Equal(isOptOut(b), tc.wantOptOut)
+		})
+	}
+}
+
+// blockingReader returns a reader waiting for input until the test ends
+func blockingReader(t *testing.T) io.Reader {
+	r, w := io.Pipe()
+	t.Cleanup(func() { w.Close() })
+	return r
+}
+
+func TestAnswersCloseStopsReading(t *testing.T) {
+	t.Parallel()
+	a := helper.Asserter{T: t}
+
+	tty, ttyW := io.Pipe()
+	defer ttyW.Close()
+	stdin, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal("couldn't open stdin:", err)
+	}
+	defer stdin.Close()
+	stdout := &bytes.Buffer{}
+	stopped := make(chan struct{})
+	o := newOptions([]Option{WithAnswerTimeout(10 * time.Millisecond), func(o *options) {
+		o.isTerminal = func(s interface{}) bool { return s == stdout }
+		o.openTTY = func() (io.ReadCloser, error) {
+			return readCloser{tty, func() error {
+				defer close(stopped)
+				return tty.Close()
+			}}, nil
+		}
+	}})
+
+	answers, err := o.answers(stdin, stdout)
+	a.CheckWantedErr(err, false)
+	_, ok := answers.next()
+	a.Equal(ok, false)
+	answers.close()
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("closing answers didn't release the terminal")
+	}
+	// the pending read ends with the terminal instead of waiting for an answer which will never be asked for
+	if _, err := ttyW.Write([]byte("y\n")); err != io.ErrClosedPipe {
+		t.Errorf("expected the terminal to be closed, got: %v", err)
+	}
+}
+
+// readCloser closes a reader with its close function
+type readCloser struct {
+	io.Reader
+	close func() error
+}
+
+func (r readCloser) Close() error {
+	return r.close()
+}
+
+func TestInteractiveMetricsCollectAndSendLocalized(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name    string
+		answers string
+
+		wantSent   bool
+		wantOptOut bool
+	}{
+		{"localized yes", "o\n", true, false},
+		{"localized no", "non\n", true, true},
+		{"english answers are still accepted", "yes\n", true, false},
+		{"unknown answers", "ja\nq\n", false, false},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			defer ts.Close()
+
+			root := filepath.Join(out, "root")
+			helper.WriteMO(t, filepath.Join(root, "usr/share/locale/fr/LC_MESSAGES", i18n.Domain+".mo"), map[string]string{
+				"Do you agree to report this? [y (send metrics)/n (send opt out message)/e (edit report)/Q (quit)]": "Acceptez-vous d'envoyer ce rapport ?",
+			})
+			if err := utils.WriteFile(filepath.Join(root, "usr/share/i18n/locales/fr_FR"),
+				[]byte("LC_MESSAGES\nyesexpr \"^[oOyY]\"\nnoexpr \"^[nN]\"\nyesstr \"oui\"\nnostr \"non\"\nEND LC_MESSAGES\n")); err != nil {
+				t.Fatal("couldn't write locale definition:", err)
+			}
+
+			m, cancel := newDiffTestMetrics(t)
+			defer cancel()
+			stdout := &bytes.Buffer{}
+			err := metricsCollectAndSend(m, ReportInteractive, false, ts.URL, out, strings.NewReader(tc.answers), stdout,
+				WithInsecure(), func(o *options) { o.catalog = func() *i18n.Catalog { return i18n.Load(root, "fr_FR") } })
+
+			a.CheckWantedErr(err, false)
+			if !strings.Contains(stdout.String(), "Acceptez-vous d'envoyer ce rapport ?") {
+				t.Errorf("expected the prompt to be translated, got: %s", stdout.String())
+			}
+			b, err := ioutil.ReadFile(filepath.Join(out, "ubuntu-report", "ubuntu.18.04"))
+			if !tc.wantSent {
+				if !os.IsNotExist(err) {
+					t.Errorf("we didn't expect any report to be sent, got: %s", b)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("we expected a report to be sent:", err)
+			}
+			a.Equal(isOptOut(b), tc.wantOptOut)
+		})
+	}
+}
+
+func TestInteractiveMetricsCollectAndSendCommandsFirst(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name    string
+		answers string
+
+		wantEdited bool
+		wantSent   bool
+		wantOptOut bool
+	}{
+		{"edit letter answers yes in the language", "e\nq\n", true, false, false},
+		{"quit", "q\n", false, false, false},
+		{"localized yes", "y\n", false, true, false},
+		{"localized no", "h\n", false, true, true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			defer ts.Close()
+
+			root := filepath.Join(out, "root")
+			if err := utils.WriteFile(filepath.Join(root, "usr/share/i18n/locales/tr_TR"),
+				[]byte("LC_MESSAGES\nyesexpr \"^[+1eEyY]\"\nnoexpr \"^[-0hHnN]\"\nyesstr \"evet\"\nnostr \"hay\u0131r\"\nEND LC_MESSAGES\n")); err != nil {
+				t.Fatal("couldn't write locale definition:", err)
+			}
+			edited := false
+			editFile := func(p string) error {
+				edited = true
+				return nil
+			}
+
+			m, cancel := newDiffTestMetrics(t)
+			defer cancel()
+			err := metricsCollectAndSend(m, ReportInteractive, false, ts.URL, out, strings.NewReader(tc.answers), ioutil.Discard,
+				WithInsecure(), func(o *options) {
+					o.catalog = func() *i18n.Catalog { return i18n.Load(root, "tr_TR") }
+					o.editFile = editFile
+				})
+
+			a.CheckWantedErr(err, false)
+			a.Equal(edited, tc.wantEdited)
+			b, err := ioutil.ReadFile(filepath.Join(out, "ubuntu-report", "ubuntu.18.04"))
+			if !tc.wantSent {
+				if !os.IsNotExist(err) {
+					t.Errorf("we didn't expect any report to be sent, got: %s", b)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("we expected a report to be sent:", err)
+			}
+			a.Equal(isOptOut(b), tc.wantOptOut)
+		})
+	}
+}
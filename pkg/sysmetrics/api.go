@@ -4,17 +4,22 @@ package sysmetrics
 
 import (
 	"os"
+	"time"
 
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	"github.com/ubuntu/ubuntu-report/internal/config"
 	"github.com/ubuntu/ubuntu-report/internal/metrics"
+	"github.com/ubuntu/ubuntu-report/internal/sender"
+	"github.com/ubuntu/ubuntu-report/internal/utils"
 )
 
 // ReportType define the desired kind of interaction in CollectAndSend()
 type ReportType int
 
 const (
-	// ReportInteractive will show report content on stdout and read anwser on stdin
+	// ReportInteractive will show report content on stdout and read anwser on stdin, or on the controlling
+	// terminal when stdin is redirected but stdout is a terminal
 	ReportInteractive ReportType = iota
 	// ReportAuto will send a report without printing report
 	ReportAuto
@@ -22,54 +27,253 @@ const (
 	ReportOptOut
 )
 
+// Option customizes how reports are sent.
+// Options override the system and user configuration files.
+type Option func(*options)
+
+// WithCABundle trusts, in addition to the system ones, the certificate authorities of the PEM file at p
+func WithCABundle(p string) Option {
+	return func(o *options) {
+		o.tls.CAFile = p
+	}
+}
+
+// WithClientCertificate authenticates to the server with the PEM client certificate and key files
+func WithClientCertificate(cert, key string) Option {
+	return func(o *options) {
+		o.tls.CertFile = cert
+		o.tls.KeyFile = key
+	}
+}
+
+// WithPinnedSPKI only accepts server certificate chains containing one of those base64-encoded
+// sha256 hashes of a SubjectPublicKeyInfo
+func WithPinnedSPKI(pins ...string) Option {
+	return func(o *options) {
+		o.tls.PinnedSPKI = pins
+	}
+}
+
+// WithInsecure allows sending reports to non https URLs
+func WithInsecure() Option {
+	return func(o *options) {
+		o.tls.Insecure = true
+	}
+}
+
+// WithBundleFile exports the report to a bundle file at p instead of sending it,
+// so that it can be uploaded later from another machine with UploadBundles.
+func WithBundleFile(p string) Option {
+	return func(o *options) {
+		o.bundlePath = p
+	}
+}
+
+// WithLockTimeout sets how long to wait for other ubuntu-report instances acting on reports.
+// It defaults to 30 seconds.
+func WithLockTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.lockTimeout = d
+	}
+}
+
+// WithDryRun prints the requests reports would be sent with, instead of sending them.
+// Previous, pending and exported reports, consent and server states are left untouched.
+func WithDryRun() Option {
+	return func(o *options) {
+		o.dryRun = true
+	}
+}
+
+// WithVariant reports as the product variant v, one of Variants, instead of the detected one.
+// It's both the Variant field of the report and part of the url reports are sent to.
+func WithVariant(v string) Option {
+	return func(o *options) {
+		o.variant = v
+	}
+}
+
+// WithDerivatives reports derivatives as the distribution they are mapped to. Keys are matched against
+// ID then ID_LIKE entries of os-release, like {"pop": "ubuntu"}, or {"ubuntu": "ubuntu"} for every
+// derivative of Ubuntu. They are reported as the release they are based on, found from the codename in
+// os-release and the releases listed by distro-info, or as themselves if it can't be found.
+func WithDerivatives(d map[string]string) Option {
+	return func(o *options) {
+		o.derivatives = d
+	}
+}
+
+// Variants are the product variants reports can be sent for
+var Variants = metrics.Variants
+
+// Destination is an additional server receiving a copy of every report sent to the main server.
+// Reports which couldn't be delivered are kept pending per destination, so that a failure on one
+// of them doesn't resend the report to others.
+type Destination struct {
+	// URL of the server, distro, product variant and version are appended to it
+	URL string
+	// CAFile, CertFile, KeyFile, PinnedSPKI and Insecure are the TLS settings of that destination,
+	// with the same meaning as WithCABundle, WithClientCertificate, WithPinnedSPKI and WithInsecure.
+	CAFile     string
+	CertFile   string
+	KeyFile    string
+	PinnedSPKI []string
+	Insecure   bool
+	// Required makes sending a report fail if this destination can't be reached.
+	// The main server is always required.
+	Required bool
+}
+
+// WithDestination sends a copy of the reports to d
+func WithDestination(d Destination) Option {
+	return func(o *options) {
+		o.additionalDestinations = append(o.additionalDestinations, destination{
+			baseURL: d.URL,
+			tls: sender.TLSConfig{
+				CAFile:     d.CAFile,
+				CertFile:   d.CertFile,
+				KeyFile:    d.KeyFile,
+				PinnedSPKI: d.PinnedSPKI,
+				Insecure:   d.Insecure,
+			},
+			required: d.Required,
+		})
+	}
+}
+
 // Collect system info and return a pretty printed version of collected data
-func Collect() ([]byte, error) {
+func Collect(opts ...Option) ([]byte, error) {
 	log.Debug("collect system information")
 
-	m, err := metrics.New()
+	opts, err := withConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	m, err := newMetrics(opts)
 	if err != nil {
-		return nil, errors.Wrapf(err, "couldn't create a metric collector")
+		return nil, err
 	}
 	return metricsCollect(m)
 }
 
+// CollectAnnotated gathers system info and returns a pretty printed version of collected data, with comments
+// describing where each field comes from, why it's collected and what it can tell. It isn't valid json.
+func CollectAnnotated(opts ...Option) ([]byte, error) {
+	log.Debug("collect system information with field descriptions")
+
+	opts, err := withConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	m, err := newMetrics(opts)
+	if err != nil {
+		return nil, err
+	}
+	return metricsCollectAnnotated(m)
+}
+
+// Formats are the formats FormatReport renders reports in
+var Formats = metrics.Formats
+
+// FormatReport renders a report, as returned by Collect, in one of Formats: json, yaml, a table of fields and values,
+// shell variable assignments (env) or an html table for graphical front-ends.
+// If "field" isn't empty, only this field is rendered. It can be a path, like CPU.Name or GPU[0].Vendor,
+// or a JSON pointer, like /GPU/0/Vendor.
+func FormatReport(report []byte, format, field string) ([]byte, error) {
+	return metrics.Format(report, format, field)
+}
+
+// CollectWithDiagnostics gathers system info and returns a pretty printed version of collected data,
+// alongside how each section of the report was collected: found, missing, skipped or failed and why.
+func CollectWithDiagnostics(opts ...Option) ([]byte, []Diagnostic, error) {
+	log.Debug("collect system information with diagnostics")
+
+	opts, err := withConfig(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	m, err := newMetrics(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return metricsCollectWithDiagnostics(m)
+}
+
+// Explain returns the description of a report field, like "CPU.Name", or of all its subfields.
+// Every field is described if "field" is empty.
+func Explain(field string) ([]FieldInfo, error) {
+	if field == "" {
+		return metrics.Fields(), nil
+	}
+	return metrics.Explain(field)
+}
+
+// Diff collects system info and returns how it differs from a stored report.
+// "against" is the path of a report file or a release of this distro; the latest stored
+// report is used if it's empty.
+func Diff(against string, opts ...Option) ([]Change, error) {
+	log.Debug("compare system information with a stored report")
+
+	opts, err := withConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	m, err := newMetrics(opts)
+	if err != nil {
+		return nil, err
+	}
+	return metricsDiff(m, against, "", opts...)
+}
+
 // SendReport POST to the baseURL server data coming from a previous collect.
 // The report will not be sent if a report has already been sent for this version unless "alwaysReport" is true.
 // If "baseURL" is not an empty string, this overrides the server the report is sent to.
-func SendReport(data []byte, alwaysReport bool, baseURL string) error {
+func SendReport(data []byte, alwaysReport bool, baseURL string, opts ...Option) error {
 	log.Debug("report system information")
 
-	m, err := metrics.New()
+	opts, err := withConfig(opts)
+	if err != nil {
+		return err
+	}
+	m, err := newMetrics(opts)
 	if err != nil {
-		return errors.Wrapf(err, "couldn't create a metric collector")
+		return err
 	}
-	return metricsSend(m, data, true, alwaysReport, baseURL, "", os.Stdin, os.Stdout)
+	return metricsSend(m, data, true, alwaysReport, baseURL, "", os.Stdin, os.Stdout, opts...)
 }
 
 // SendDecline POST to the baseURL server data denial report message.
 // The denial message will not be sent if a report has already been sent for this version unless "alwaysReport" is true.
 // If "baseURL" is not an empty string, this overrides the server the report is sent to.
-func SendDecline(alwaysReport bool, baseURL string) error {
+func SendDecline(alwaysReport bool, baseURL string, opts ...Option) error {
 	log.Debug("report system information")
 
-	m, err := metrics.New()
+	opts, err := withConfig(opts)
 	if err != nil {
-		return errors.Wrapf(err, "couldn't create a metric collector")
+		return err
 	}
-	return metricsSend(m, nil, false, alwaysReport, baseURL, "", os.Stdin, os.Stdout)
+	m, err := newMetrics(opts)
+	if err != nil {
+		return err
+	}
+	return metricsSend(m, nil, false, alwaysReport, baseURL, "", os.Stdin, os.Stdout, opts...)
 }
 
 // CollectAndSend gather system info and send them
 // The report will not be sent if a report has already been sent for this version unless "alwaysReport" is true.
 // If "baseURL" is not an empty string, this overrides the server the report is sent to.
-func CollectAndSend(r ReportType, alwaysReport bool, baseURL string) error {
+func CollectAndSend(r ReportType, alwaysReport bool, baseURL string, opts ...Option) error {
 	log.Debug("collect and report system information")
 
-	m, err := metrics.New()
+	opts, err := withConfig(opts)
 	if err != nil {
-		return errors.Wrapf(err, "couldn't create a metric collector")
+		return err
 	}
-	return metricsCollectAndSend(m, r, alwaysReport, baseURL, "", os.Stdin, os.Stdout)
+	m, err := newMetrics(opts)
+	if err != nil {
+		return err
+	}
+	return metricsCollectAndSend(m, r, alwaysReport, baseURL, "", os.Stdin, os.Stdout, opts...)
 }
 
 // CollectAndSendOnUpgrade gather system info and send them
@@ -77,24 +281,247 @@ func CollectAndSend(r ReportType, alwaysReport bool, baseURL string) error {
 // It will only send if a previous report has been found, collect latest report answer (opt-in or opt-out)
 // and decides what to send on that new version based on those facts.
 // If "baseURL" is not an empty string, this overrides the server the report is sent to.
-func CollectAndSendOnUpgrade(alwaysReport bool, baseURL string) error {
+func CollectAndSendOnUpgrade(alwaysReport bool, baseURL string, opts ...Option) error {
 	log.Debug("collect and report system information on upgrade")
 
-	m, err := metrics.New()
+	opts, err := withConfig(opts)
 	if err != nil {
-		return errors.Wrapf(err, "couldn't create a metric collector")
+		return err
 	}
-	return metricsCollectAndSendOnUpgrade(m, alwaysReport, baseURL, "", os.Stdin, os.Stdout)
+	m, err := newMetrics(opts)
+	if err != nil {
+		return err
+	}
+	return metricsCollectAndSendOnUpgrade(m, alwaysReport, baseURL, "", os.Stdin, os.Stdout, opts...)
 }
 
 // SendPendingReport will try to send any pending report which didn't succeed previously due to network issues.
 // It will try sending and exponentially back off until a send is successful.
-func SendPendingReport(baseURL string) error {
+func SendPendingReport(baseURL string, opts ...Option) error {
 	log.Debug("try sending previous report")
 
-	m, err := metrics.New()
+	opts, err := withConfig(opts)
+	if err != nil {
+		return err
+	}
+	m, err := newMetrics(opts)
 	if err != nil {
-		return errors.Wrapf(err, "couldn't create a metric collector")
+		return err
+	}
+	return metricsSendPendingReport(m, baseURL, "", os.Stdin, os.Stdout, opts...)
+}
+
+// GetConsent returns the recorded decision of the user about reporting metrics.
+// If "baseURL" is not an empty string, the privacy policy of this server is the one checked for changes.
+func GetConsent(baseURL string, opts ...Option) (Consent, error) {
+	log.Debug("get reporting consent")
+
+	opts, err := withConfig(opts)
+	if err != nil {
+		return Consent{}, err
+	}
+	m, err := newMetrics(opts)
+	if err != nil {
+		return Consent{}, err
+	}
+	distro, version, err := m.GetIDS()
+	if err != nil {
+		return Consent{}, errors.Wrapf(err, "couldn't get mandatory information")
+	}
+	return newOptions(opts).loadConsent(baseURL, distro, version, "")
+}
+
+// GrantConsent records that the user agrees to report metrics and sends a report for the current release,
+// replacing an opt-out message sent previously.
+// If "baseURL" is not an empty string, this overrides the server the report is sent to.
+func GrantConsent(baseURL string, opts ...Option) error {
+	log.Debug("grant reporting consent")
+
+	opts, err := withConfig(opts)
+	if err != nil {
+		return err
+	}
+	m, err := newMetrics(opts)
+	if err != nil {
+		return err
+	}
+	return metricsSetConsent(m, true, baseURL, "", os.Stdin, os.Stdout, opts...)
+}
+
+// RevokeConsent records that the user doesn't agree to report metrics anymore and sends an opt-out
+// message for the current release, replacing a report sent previously.
+// If "baseURL" is not an empty string, this overrides the server the message is sent to.
+func RevokeConsent(baseURL string, opts ...Option) error {
+	log.Debug("revoke reporting consent")
+
+	opts, err := withConfig(opts)
+	if err != nil {
+		return err
+	}
+	m, err := newMetrics(opts)
+	if err != nil {
+		return err
+	}
+	return metricsSetConsent(m, false, baseURL, "", os.Stdin, os.Stdout, opts...)
+}
+
+// Forget asks the server, and the additional destinations which received a copy, to delete the report of "version"
+// they received, or of the current release if empty, or every report of this distro if "all" is true.
+// The reports are then replaced locally, and machine-wide if they were recorded there, with an opt-out message,
+// so that they are not sent again, and the user is recorded as not agreeing to report metrics anymore.
+// If "baseURL" is not an empty string, this overrides the server the deletion is requested to.
+func Forget(version string, all bool, baseURL string, opts ...Option) error {
+	log.Debug("forget sent reports")
+
+	opts, err := withConfig(opts)
+	if err != nil {
+		return err
+	}
+	m, err := newMetrics(opts)
+	if err != nil {
+		return err
+	}
+	return metricsForget(m, version, all, baseURL, "", opts...)
+}
+
+// Status returns what was reported for the current release, the reports waiting to be delivered,
+// the server and configuration in use and why the server may refuse reports. Misconfigured destinations are
+// returned as part of the status rather than as an error. It doesn't change anything.
+// If "baseURL" is not an empty string, this overrides the server the status is returned for.
+func Status(baseURL string, opts ...Option) (ReportingStatus, error) {
+	log.Debug("get reporting status")
+
+	opts, err := withConfig(opts)
+	if err != nil {
+		return ReportingStatus{}, err
+	}
+	m, err := newMetrics(opts)
+	if err != nil {
+		return ReportingStatus{}, err
+	}
+	return metricsStatus(m, baseURL, "", opts...)
+}
+
+// Doctor checks what reporting relies on: os-release, the commands metrics are collected from, collecting
+// each section of the report, the state directories, the configuration and the servers reports are sent to.
+// Failed checks come with advice on fixing them. Nothing is sent.
+// If "baseURL" is not an empty string, this overrides the server which is checked.
+func Doctor(baseURL string, opts ...Option) ([]Finding, error) {
+	log.Debug("check reporting prerequisites")
+
+	var findings []Finding
+	if configOpts, err := withConfig(opts); err != nil {
+		findings = append(findings, Finding{Check: "configuration", Status: FindingError, Detail: err.Error(),
+			Advice: "Fix or remove the invalid configuration file: it's ignored by this check only."})
+	} else {
+		opts = configOpts
+	}
+	m, err := newMetrics(opts)
+	if err != nil {
+		return nil, err
+	}
+	return append(findings, metricsDoctor(m, baseURL, "", opts...)...), nil
+}
+
+// History returns every attempt to send a report, oldest first
+func History() ([]Transmission, error) {
+	log.Debug("list report transmissions")
+
+	return loadLedger("")
+}
+
+// UploadBundles sends reports exported with WithBundleFile, possibly from other machines.
+// A receipt is written next to each delivered bundle, to be imported with ImportReceipts on
+// the machine which exported it. It returns the paths of those receipts.
+// If "baseURL" is not an empty string, this overrides the server the reports are sent to.
+func UploadBundles(bundles []string, baseURL string, opts ...Option) ([]string, error) {
+	log.Debug("upload exported reports")
+
+	opts, err := withConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	return metricsUploadBundles(bundles, baseURL, "", opts...)
+}
+
+// ImportReceipts marks reports exported from this machine as reported, given the receipts
+// returned by UploadBundles.
+func ImportReceipts(receipts []string, opts ...Option) error {
+	log.Debug("import receipts of uploaded reports")
+
+	opts, err := withConfig(opts)
+	if err != nil {
+		return err
+	}
+	return metricsImportReceipts(receipts, "", opts...)
+}
+
+// RecordMachineReport saves data as the report of this machine for distro and version, shared by all users
+// when reporting once per machine. It needs write access to the machine-wide state directory and is
+// meant to be called by the privileged helper.
+func RecordMachineReport(distro, version string, data []byte) error {
+	log.Debug("record report machine-wide")
+
+	return saveMachineReport(distro, version, data, utils.MachineStateDir)
+}
+
+// withConfig prepends options from configuration files to opts, so that opts take precedence
+func withConfig(opts []Option) ([]Option, error) {
+	c, sources, err := config.Load()
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't load configuration")
+	}
+	if len(sources) == 0 {
+		return opts, nil
+	}
+
+	configOpts := []Option{func(o *options) {
+		o.configSources = sources
+		o.defaultURL = c.URL
+		o.tls = tlsFromConfig(c.TLS)
+		if c.LockTimeout != 0 {
+			o.lockTimeout = c.LockTimeout
+		}
+		if c.Scope == config.ScopeMachine {
+			o.machineStateDir = utils.MachineStateDir
+		}
+		o.variant = c.Variant
+		o.derivatives = c.Derivatives
+	}}
+	for _, d := range c.Destinations {
+		configOpts = append(configOpts, WithDestination(Destination{
+			URL:        d.URL,
+			CAFile:     d.TLS.CAFile,
+			CertFile:   d.TLS.CertFile,
+			KeyFile:    d.TLS.KeyFile,
+			PinnedSPKI: d.TLS.PinnedSPKI,
+			Insecure:   d.TLS.Insecure,
+			Required:   d.Required,
+		}))
+	}
+	return append(configOpts, opts...), nil
+}
+
+// newMetrics returns a metric collector reporting as the product variant and distribution requested in options, if any
+func newMetrics(opts []Option) (metrics.Metrics, error) {
+	var mopts []func(*metrics.Metrics) error
+	o := newOptions(opts)
+	if o.variant != "" {
+		mopts = append(mopts, metrics.WithVariant(o.variant))
+	}
+	if len(o.derivatives) > 0 {
+		mopts = append(mopts, metrics.WithDerivatives(o.derivatives))
+	}
+	m, err := metrics.New(mopts...)
+	return m, errors.Wrapf(err, "couldn't create a metric collector")
+}
+
+func tlsFromConfig(c config.TLS) sender.TLSConfig {
+	return sender.TLSConfig{
+		CAFile:     c.CAFile,
+		CertFile:   c.CertFile,
+		KeyFile:    c.KeyFile,
+		PinnedSPKI: c.PinnedSPKI,
+		Insecure:   c.Insecure,
 	}
-	return metricsSendPendingReport(m, baseURL, "", os.Stdin, os.Stdout)
 }
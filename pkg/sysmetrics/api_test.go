@@ -12,6 +12,7 @@ import (
 	"testing"
 
 	"github.com/ubuntu/ubuntu-report/internal/helper"
+	"github.com/ubuntu/ubuntu-report/internal/utils"
 	"github.com/ubuntu/ubuntu-report/pkg/sysmetrics"
 )
 
@@ -50,6 +51,7 @@ func TestSendReport(t *testing.T) {
 			out, tearDown := helper.TempDir(t)
 			defer tearDown()
 			defer helper.ChangeEnv("XDG_CACHE_HOME", out)()
+			defer helper.ChangeEnv("XDG_STATE_HOME", out)()
 			out = filepath.Join(out, "ubuntu-report")
 			// we don't really care where we hit for this API integration test, internal ones test it
 			// and we don't really control /etc/os-release version and id.
@@ -61,11 +63,11 @@ func TestSendReport(t *testing.T) {
 			defer ts.Close()
 
 			err := sysmetrics.SendReport([]byte(fmt.Sprintf(`{ %s: "18.04" }`, sysmetrics.ExpectedReportItem)),
-				tc.alwaysReport, ts.URL)
+				tc.alwaysReport, ts.URL, sysmetrics.WithInsecure())
 
 			a.CheckWantedErr(err, tc.wantErr)
 			a.Equal(serverHit, tc.shouldHitServer)
-			p := filepath.Join(out, helper.FindInDirectory(t, "", out))
+			p := filepath.Join(out, helper.FindReportInDirectory(t, out))
 			data, err := ioutil.ReadFile(p)
 			if err != nil {
 				t.Fatalf("couldn't open report file %s", out)
@@ -98,6 +100,7 @@ func TestSendDecline(t *testing.T) {
 			out, tearDown := helper.TempDir(t)
 			defer tearDown()
 			defer helper.ChangeEnv("XDG_CACHE_HOME", out)()
+			defer helper.ChangeEnv("XDG_STATE_HOME", out)()
 			out = filepath.Join(out, "ubuntu-report")
 			// we don't really care where we hit for this API integration test, internal ones test it
 			// and we don't really control /etc/os-release version and id.
@@ -108,14 +111,14 @@ func TestSendDecline(t *testing.T) {
 			}))
 			defer ts.Close()
 
-			err := sysmetrics.SendDecline(tc.alwaysReport, ts.URL)
+			err := sysmetrics.SendDecline(tc.alwaysReport, ts.URL, sysmetrics.WithInsecure())
 
 			if err != nil {
 				t.Fatal("we didn't expect getting an error, got:", err)
 			}
 
 			a.Equal(serverHit, tc.shouldHitServer)
-			p := filepath.Join(out, helper.FindInDirectory(t, "", out))
+			p := filepath.Join(out, helper.FindReportInDirectory(t, out))
 			data, err := ioutil.ReadFile(p)
 			if err != nil {
 				t.Fatalf("couldn't open report file %s", out)
@@ -149,6 +152,7 @@ func TestSendReportTwice(t *testing.T) {
 			out, tearDown := helper.TempDir(t)
 			defer tearDown()
 			defer helper.ChangeEnv("XDG_CACHE_HOME", out)()
+			defer helper.ChangeEnv("XDG_STATE_HOME", out)()
 			out = filepath.Join(out, "ubuntu-report")
 			// we don't really care where we hit for this API integration test, internal ones test it
 			// and we don't really control /etc/os-release version and id.
@@ -161,12 +165,12 @@ func TestSendReportTwice(t *testing.T) {
 
 			// first call
 			err := sysmetrics.SendReport([]byte(fmt.Sprintf(`{ %s: "18.04" }`, sysmetrics.ExpectedReportItem)),
-				tc.alwaysReport, ts.URL)
+				tc.alwaysReport, ts.URL, sysmetrics.WithInsecure())
 			if err != nil {
 				t.Fatal("we didn't expect getting an error, got:", err)
 			}
 			a.Equal(serverHit, true)
-			p := filepath.Join(out, helper.FindInDirectory(t, "", out))
+			p := filepath.Join(out, helper.FindReportInDirectory(t, out))
 			data, err := ioutil.ReadFile(p)
 			if err != nil {
 				t.Fatalf("couldn't open report file %s", out)
@@ -177,14 +181,14 @@ func TestSendReportTwice(t *testing.T) {
 			}
 
 			// scratch data file
-			if err != ioutil.WriteFile(p, []byte(""), 0644) {
+			if err != utils.WriteFile(p, []byte("")) {
 				t.Fatalf("couldn't reset %s: %v", p, err)
 			}
 
 			// second call, reset server
 			serverHit = false
 			err = sysmetrics.SendReport([]byte(fmt.Sprintf(`{ %s: "18.04" }`, sysmetrics.ExpectedReportItem)),
-				tc.alwaysReport, ts.URL)
+				tc.alwaysReport, ts.URL, sysmetrics.WithInsecure())
 			a.CheckWantedErr(err, tc.wantErr)
 
 			a.Equal(serverHit, tc.alwaysReport)
@@ -230,6 +234,7 @@ func TestSendDeclineTwice(t *testing.T) {
 			out, tearDown := helper.TempDir(t)
 			defer tearDown()
 			defer helper.ChangeEnv("XDG_CACHE_HOME", out)()
+			defer helper.ChangeEnv("XDG_STATE_HOME", out)()
 			out = filepath.Join(out, "ubuntu-report")
 			// we don't really care where we hit for this API integration test, internal ones test it
 			// and we don't really control /etc/os-release version and id.
@@ -241,12 +246,12 @@ func TestSendDeclineTwice(t *testing.T) {
 			defer ts.Close()
 
 			// first call
-			err := sysmetrics.SendDecline(tc.alwaysReport, ts.URL)
+			err := sysmetrics.SendDecline(tc.alwaysReport, ts.URL, sysmetrics.WithInsecure())
 			if err != nil {
 				t.Fatal("we didn't expect getting an error, got:", err)
 			}
 			a.Equal(serverHit, true)
-			p := filepath.Join(out, helper.FindInDirectory(t, "", out))
+			p := filepath.Join(out, helper.FindReportInDirectory(t, out))
 			data, err := ioutil.ReadFile(p)
 			if err != nil {
 				t.Fatalf("couldn't open report file %s", out)
@@ -257,13 +262,13 @@ func TestSendDeclineTwice(t *testing.T) {
 			}
 
 			// scratch data file
-			if err != ioutil.WriteFile(p, []byte(""), 0644) {
+			if err != utils.WriteFile(p, []byte("")) {
 				t.Fatalf("couldn't reset %s: %v", p, err)
 			}
 
 			// second call, reset server
 			serverHit = false
-			err = sysmetrics.SendDecline(tc.alwaysReport, ts.URL)
+			err = sysmetrics.SendDecline(tc.alwaysReport, ts.URL, sysmetrics.WithInsecure())
 			a.CheckWantedErr(err, tc.wantErr)
 
 			a.Equal(serverHit, tc.alwaysReport)
@@ -311,6 +316,7 @@ func TestNonInteractiveCollectAndSend(t *testing.T) {
 			out, tearDown := helper.TempDir(t)
 			defer tearDown()
 			defer helper.ChangeEnv("XDG_CACHE_HOME", out)()
+			defer helper.ChangeEnv("XDG_STATE_HOME", out)()
 			out = filepath.Join(out, "ubuntu-report")
 			// we don't really care where we hit for this API integration test, internal ones test it
 			// and we don't really control /etc/os-release version and id.
@@ -321,14 +327,14 @@ func TestNonInteractiveCollectAndSend(t *testing.T) {
 			}))
 			defer ts.Close()
 
-			err := sysmetrics.CollectAndSend(tc.r, tc.alwaysReport, ts.URL)
+			err := sysmetrics.CollectAndSend(tc.r, tc.alwaysReport, ts.URL, sysmetrics.WithInsecure())
 
 			if err != nil {
 				t.Fatal("we didn't expect getting an error, got:", err)
 			}
 
 			a.Equal(serverHit, tc.shouldHitServer)
-			p := filepath.Join(out, helper.FindInDirectory(t, "", out))
+			p := filepath.Join(out, helper.FindReportInDirectory(t, out))
 			data, err := ioutil.ReadFile(p)
 			if err != nil {
 				t.Fatalf("couldn't open report file %s", out)
@@ -369,6 +375,7 @@ func TestCollectAndSendTwice(t *testing.T) {
 			out, tearDown := helper.TempDir(t)
 			defer tearDown()
 			defer helper.ChangeEnv("XDG_CACHE_HOME", out)()
+			defer helper.ChangeEnv("XDG_STATE_HOME", out)()
 			out = filepath.Join(out, "ubuntu-report")
 			// we don't really care where we hit for this API integration test, internal ones test it
 			// and we don't really control /etc/os-release version and id.
@@ -380,12 +387,12 @@ func TestCollectAndSendTwice(t *testing.T) {
 			defer ts.Close()
 
 			// first call
-			err := sysmetrics.CollectAndSend(sysmetrics.ReportAuto, tc.alwaysReport, ts.URL)
+			err := sysmetrics.CollectAndSend(sysmetrics.ReportAuto, tc.alwaysReport, ts.URL, sysmetrics.WithInsecure())
 			if err != nil {
 				t.Fatal("we didn't expect getting an error, got:", err)
 			}
 			a.Equal(serverHit, true)
-			p := filepath.Join(out, helper.FindInDirectory(t, "", out))
+			p := filepath.Join(out, helper.FindReportInDirectory(t, out))
 			data, err := ioutil.ReadFile(p)
 			if err != nil {
 				t.Fatalf("couldn't open report file %s", out)
@@ -396,13 +403,13 @@ func TestCollectAndSendTwice(t *testing.T) {
 			}
 
 			// scratch data file
-			if err != ioutil.WriteFile(p, []byte(""), 0644) {
+			if err != utils.WriteFile(p, []byte("")) {
 				t.Fatalf("couldn't reset %s: %v", p, err)
 			}
 
 			// second call, reset server
 			serverHit = false
-			err = sysmetrics.CollectAndSend(sysmetrics.ReportAuto, tc.alwaysReport, ts.URL)
+			err = sysmetrics.CollectAndSend(sysmetrics.ReportAuto, tc.alwaysReport, ts.URL, sysmetrics.WithInsecure())
 			a.CheckWantedErr(err, tc.wantErr)
 
 			a.Equal(serverHit, tc.alwaysReport)
@@ -462,6 +469,7 @@ func TestInteractiveCollectAndSend(t *testing.T) {
 			out, tearDown := helper.TempDir(t)
 			defer tearDown()
 			defer helper.ChangeEnv("XDG_CACHE_HOME", out)()
+			defer helper.ChangeEnv("XDG_STATE_HOME", out)()
 			out = filepath.Join(out, "ubuntu-report")
 			// we don't really care where we hit for this API integration test, internal ones test it
 			// and we don't really control /etc/os-release version and id.
@@ -477,7 +485,9 @@ func TestInteractiveCollectAndSend(t *testing.T) {
 			stdin, tearDown := helper.CaptureStdin(t)
 			defer tearDown()
 
-			cmdErrs := helper.RunFunctionWithTimeout(t, func() error { return sysmetrics.CollectAndSend(sysmetrics.ReportInteractive, false, ts.URL) })
+			cmdErrs := helper.RunFunctionWithTimeout(t, func() error {
+				return sysmetrics.CollectAndSend(sysmetrics.ReportInteractive, false, ts.URL, sysmetrics.WithInsecure())
+			})
 
 			gotJSONReport := false
 			answerIndex := 0
@@ -519,7 +529,7 @@ func TestInteractiveCollectAndSend(t *testing.T) {
 				}
 				return
 			}
-			p := filepath.Join(out, helper.FindInDirectory(t, "", out))
+			p := filepath.Join(out, helper.FindReportInDirectory(t, out))
 			data, err := ioutil.ReadFile(p)
 			if err != nil {
 				t.Fatalf("couldn't open report file %s", out)
@@ -563,6 +573,7 @@ func TestCollectAndSendOnUpgrade(t *testing.T) {
 			out, tearDown := helper.TempDir(t)
 			defer tearDown()
 			defer helper.ChangeEnv("XDG_CACHE_HOME", out)()
+			defer helper.ChangeEnv("XDG_STATE_HOME", out)()
 			out = filepath.Join(out, "ubuntu-report")
 			// we don't really care where we hit for this API integration test, internal ones test it
 			// and we don't really control /etc/os-release version and id.
@@ -592,7 +603,7 @@ func TestCollectAndSendOnUpgrade(t *testing.T) {
 				}
 			}
 
-			err := sysmetrics.CollectAndSendOnUpgrade(false, ts.URL)
+			err := sysmetrics.CollectAndSendOnUpgrade(false, ts.URL, sysmetrics.WithInsecure())
 
 			if err != nil {
 				t.Fatal("we didn't expect getting an error, got:", err)
@@ -651,6 +662,7 @@ func TestSendPendingReport(t *testing.T) {
 			out, tearDown := helper.TempDir(t)
 			defer tearDown()
 			defer helper.ChangeEnv("XDG_CACHE_HOME", out)()
+			defer helper.ChangeEnv("XDG_STATE_HOME", out)()
 			out = filepath.Join(out, "ubuntu-report")
 
 			pendingReportData, err := ioutil.ReadFile(filepath.Join("testdata", "good", "ubuntu-report", "pending"))
@@ -674,7 +686,7 @@ func TestSendPendingReport(t *testing.T) {
 			}))
 			defer ts.Close()
 
-			err = sysmetrics.SendPendingReport(ts.URL)
+			err = sysmetrics.SendPendingReport(ts.URL, sysmetrics.WithInsecure())
 
 			a.CheckWantedErr(err, tc.wantErr)
 			a.Equal(serverHit, tc.shouldHitServer)
@@ -683,7 +695,7 @@ func TestSendPendingReport(t *testing.T) {
 				t.Errorf("we expected the pending report to be removed and it wasn't")
 			}
 
-			p := filepath.Join(out, helper.FindInDirectory(t, "", out))
+			p := filepath.Join(out, helper.FindReportInDirectory(t, out))
 			got, err := ioutil.ReadFile(p)
 			if err != nil {
 				t.Fatalf("couldn't open report file %s", out)
@@ -692,3 +704,62 @@ func TestSendPendingReport(t *testing.T) {
 		})
 	}
 }
+
+func TestSendReportConfiguration(t *testing.T) {
+	// we change current path and env variable: not parallelizable tests
+	helper.SkipIfShort(t)
+
+	testCases := []struct {
+		name        string
+		config      string
+		explicitURL bool
+
+		shouldHitServer bool
+		wantErr         bool
+	}{
+		{"no configuration refuses http", "", true, false, true},
+		{"insecure configuration allows http", "tls:\n  insecure: true\n", true, true, false},
+		{"url from configuration", "url: %s\ntls:\n  insecure: true\n", false, true, false},
+		{"invalid configuration", "tls: [", true, false, true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			a := helper.Asserter{T: t}
+
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			defer helper.ChangeEnv("XDG_CACHE_HOME", out)()
+			defer helper.ChangeEnv("XDG_STATE_HOME", out)()
+			defer helper.ChangeEnv("XDG_CONFIG_HOME", out)()
+
+			serverHit := false
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				serverHit = true
+			}))
+			defer ts.Close()
+
+			if tc.config != "" {
+				if err := os.MkdirAll(filepath.Join(out, "ubuntu-report"), 0700); err != nil {
+					t.Fatalf("couldn't create configuration directory: %v", err)
+				}
+				c := tc.config
+				if strings.Contains(c, "%s") {
+					c = fmt.Sprintf(c, ts.URL)
+				}
+				if err := ioutil.WriteFile(filepath.Join(out, "ubuntu-report", "config.yaml"), []byte(c), 0600); err != nil {
+					t.Fatalf("couldn't write configuration: %v", err)
+				}
+			}
+			url := ""
+			if tc.explicitURL {
+				url = ts.URL
+			}
+
+			err := sysmetrics.SendDecline(true, url)
+
+			a.CheckWantedErr(err, tc.wantErr)
+			a.Equal(serverHit, tc.shouldHitServer)
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package sysmetrics
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/ubuntu/ubuntu-report/internal/utils"
+)
+
+// bundleFormat is the version of the bundle file format. Bundles of format 1 didn't record their variant.
+const bundleFormat = 2
+
+// receiptFormat is the version of the receipt file format
+const receiptFormat = 1
+
+// receiptExt is appended to a bundle path to store its receipt
+const receiptExt = ".receipt"
+
+// bundle is a self-describing report, exported on a machine without network
+// access to be uploaded from another one
+type bundle struct {
+	Format int
+	Distro string
+	// Variant is the product variant of the exporting machine
+	Variant        string
+	Version        string
+	IdempotencyKey string
+	Checksum       string
+	Payload        json.RawMessage
+}
+
+// receipt proves that a bundle was delivered
+type receipt struct {
+	Format         int
+	Distro         string
+	Version        string
+	IdempotencyKey string
+	Checksum       string
+	URL            string
+	DeliveredAt    time.Time
+	// ReceiptID is what the metrics server answered to identify the report, if any
+	ReceiptID string `json:",omitempty"`
+}
+
+// compact returns the json payload without formatting, so that its checksum
+// survives being indented in a bundle
+func compact(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		return nil, errors.Wrapf(err, "payload isn't valid json")
+	}
+	return buf.Bytes(), nil
+}
+
+func checksum(data []byte) string {
+	h := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(h[:])
+}
+
+// newIdempotencyKey returns a random key identifying a report
+func newIdempotencyKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "couldn't generate idempotency key")
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// exportBundle saves data as a bundle to p. A copy is kept in the cache
+// directory until the matching receipt is imported.
+func exportBundle(p string, data []byte, distro, variant, version, reportBasePath string) error {
+	key, err := newIdempotencyKey()
+	if err != nil {
+		return err
+	}
+	if data, err = compact(data); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(bundle{
+		Format:         bundleFormat,
+		Distro:         distro,
+		Variant:        variant,
+		Version:        version,
+		IdempotencyKey: key,
+		Checksum:       checksum(data),
+		Payload:        json.RawMessage(data),
+	}, "", "  ")
+	if err != nil {
+		return errors.Wrapf(err, "couldn't serialize bundle")
+	}
+
+	exportedP, err := utils.ExportedBundlePath(key, reportBasePath)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't get where exported bundles are stored on disk")
+	}
+	if err := saveMetrics(exportedP, b); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(p, b, 0600); err != nil {
+		return errors.Wrapf(err, "couldn't export bundle")
+	}
+	return nil
+}
+
+func loadBundle(p string) (bundle, error) {
+	var b bundle
+	data, err := utils.ReadFile(p)
+	if err != nil {
+		return b, errors.Wrapf(err, "couldn't read bundle")
+	}
+	if err := json.Unmarshal(data, &b); err != nil {
+		return b, errors.Wrapf(err, "%s isn't a valid bundle", p)
+	}
+	tr := errorsCatalog()
+	if b.Format != bundleFormat {
+		return b, errors.Errorf(tr.Get("%s has an unsupported bundle format: %d"), p, b.Format)
+	}
+	if b.Distro == "" || b.Variant == "" || b.Version == "" || b.IdempotencyKey == "" {
+		return b, errors.Errorf(tr.Get("%s is missing its target distribution, variant, version or idempotency key"), p)
+	}
+	payload, err := compact(b.Payload)
+	if err != nil {
+		return b, errors.Wrapf(err, "%s has an invalid payload", p)
+	}
+	b.Payload = payload
+	if checksum(b.Payload) != b.Checksum {
+		return b, errors.Errorf(tr.Get("%s is corrupted: payload doesn't match its checksum"), p)
+	}
+	return b, nil
+}
+
+// metricsUploadBundles sends every bundle and writes a receipt next to each delivered one.
+// It returns the path of the receipts which were written.
+func metricsUploadBundles(bundles []string, baseURL, reportBasePath string, opts ...Option) ([]string, error) {
+	o := newOptions(opts)
+
+	if err := migrateState(reportBasePath, o.lockTimeout); err != nil {
+		return nil, err
+	}
+	unlock, err := lockReports(reportBasePath, o.lockTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	var receipts []string
+	var errs []error
+	for _, p := range bundles {
+		r, err := uploadBundle(p, baseURL, reportBasePath, o)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		receipts = append(receipts, r)
+	}
+	return receipts, joinErrors(errs)
+}
+
+func uploadBundle(p, baseURL, reportBasePath string, o options) (string, error) {
+	b, err := loadBundle(p)
+	if err != nil {
+		return "", err
+	}
+
+	dests, urls, err := o.destinations(baseURL, b.Distro, b.Variant, b.Version)
+	if err != nil {
+		return "", err
+	}
+	var receiptID string
+	for i, d := range dests {
+		id, err := sendReport(urls[i], b.Payload, d, b.Distro, b.Version, reportBasePath, b.IdempotencyKey)
+		if err == nil {
+			if d.main {
+				receiptID = id
+			}
+			continue
+		}
+		err = errors.Wrapf(err, "%s was not delivered successfully to %s", p, d.name())
+		if d.required {
+			return "", err
+		}
+		log.Warningf(utils.ErrFormat, err)
+	}
+
+	data, err := json.MarshalIndent(receipt{
+		Format:         receiptFormat,
+		Distro:         b.Distro,
+		Version:        b.Version,
+		IdempotencyKey: b.IdempotencyKey,
+		Checksum:       b.Checksum,
+		URL:            urls[0],
+		DeliveredAt:    time.Now().UTC(),
+		ReceiptID:      receiptID,
+	}, "", "  ")
+	if err != nil {
+		return "", errors.Wrapf(err, "couldn't serialize receipt")
+	}
+	rp := p + receiptExt
+	if err := ioutil.WriteFile(rp, data, 0600); err != nil {
+		return "", errors.Wrapf(err, "couldn't save receipt")
+	}
+	return rp, nil
+}
+
+// metricsImportReceipts marks bundles exported from this machine as reported, once delivered.
+func metricsImportReceipts(receipts []string, reportBasePath string, opts ...Option) error {
+	o := newOptions(opts)
+
+	if err := migrateState(reportBasePath, o.lockTimeout); err != nil {
+		return err
+	}
+	unlock, err := lockReports(reportBasePath, o.lockTimeout)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	var errs []error
+	for _, p := range receipts {
+		if err := importReceipt(p, reportBasePath, o.machineStateDir, o.privilegedHelper); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return joinErrors(errs)
+}
+
+func importReceipt(p, reportBasePath, machineStateDir string, privilegedHelper bool) error {
+	data, err := ioutil.ReadFile(p)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't read receipt")
+	}
+	var r receipt
+	if err := json.Unmarshal(data, &r); err != nil {
+		return errors.Wrapf(err, "%s isn't a valid receipt", p)
+	}
+	tr := errorsCatalog()
+	if r.Format != receiptFormat || r.IdempotencyKey == "" {
+		return errors.Errorf(tr.Get("%s isn't a valid receipt"), p)
+	}
+
+	exportedP, err := utils.ExportedBundlePath(r.IdempotencyKey, reportBasePath)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't get where exported bundles are stored on disk")
+	}
+	b, err := loadBundle(exportedP)
+	if err != nil {
+		return errors.Wrapf(err, "no matching bundle was exported from this machine for %s", p)
+	}
+	if b.Checksum != r.Checksum || b.Distro != r.Distro || b.Version != r.Version {
+		return errors.Errorf(tr.Get("%s doesn't match the exported bundle it refers to"), p)
+	}
+
+	reportP, err := utils.ReportPath(b.Distro, b.Version, reportBasePath)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't get where to save reported metrics on disk")
+	}
+	if err := saveReport(reportP, b.Payload, b.Distro, b.Version, reportIDs{ReceiptID: r.ReceiptID, IdempotencyKey: r.IdempotencyKey, Variant: b.Variant}, reportBasePath, machineStateDir, privilegedHelper); err != nil {
+		return err
+	}
+	log.Infof("report for %s %s delivered to %s on %s", b.Distro, b.Version, r.URL, r.DeliveredAt)
+	if err := utils.RemoveFile(exportedP); err != nil {
+		return errors.Wrapf(err, "couldn't remove exported bundle once delivered")
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package sysmetrics
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ubuntu/ubuntu-report/internal/helper"
+	"github.com/ubuntu/ubuntu-report/internal/metrics"
+)
+
+func TestBundleExportUploadAndImport(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name       string
+		tamper     func(t *testing.T, bundleP string)
+		serverDown bool
+
+		wantUploadErr bool
+	}{
+		{"regular", nil, false, false},
+		{"corrupted payload", corruptBundle, false, true},
+		{"missing variant", removeBundleVariant, false, true},
+		{"previous bundle format", previousBundleFormat, false, true},
+		{"server unreachable", nil, true, true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			// source machine without network, and connected machine uploading the bundle
+			source, tearDown := helper.TempDir(t)
+			defer tearDown()
+			connected, tearDown := helper.TempDir(t)
+			defer tearDown()
+			bundleP := filepath.Join(source, "report.bundle")
+
+			serverHit := false
+			var gotKey, gotURL string
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				serverHit = true
+				gotKey = r.Header.Get("Idempotency-Key")
+				gotURL = r.URL.String()
+				if tc.serverDown {
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}
+			}))
+			defer ts.Close()
+
+			m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+			err := metricsSend(m, []byte(`{ "some-data": true }`), true, false, ts.URL, source, os.Stdin, os.Stdout, WithInsecure(), WithBundleFile(bundleP))
+			if err != nil {
+				t.Fatal("we didn't expect getting an error while exporting the bundle, got:", err)
+			}
+			a.Equal(serverHit, false)
+			if _, err := os.Stat(filepath.Join(source, "ubuntu-report", "ubuntu.18.04")); !os.IsNotExist(err) {
+				t.Fatalf("we didn't expect the report to be marked as reported before importing a receipt")
+			}
+			b, err := loadBundle(bundleP)
+			if err != nil {
+				t.Fatal("exported bundle is invalid:", err)
+			}
+			a.Equal(b.Distro, "ubuntu")
+			a.Equal(b.Variant, "desktop")
+			a.Equal(b.Version, "18.04")
+
+			if tc.tamper != nil {
+				tc.tamper(t, bundleP)
+			}
+
+			receipts, err := metricsUploadBundles([]string{bundleP}, ts.URL, connected, WithInsecure())
+
+			a.CheckWantedErr(err, tc.wantUploadErr)
+			if tc.wantUploadErr {
+				a.Equal(len(receipts), 0)
+				return
+			}
+			a.Equal(gotKey, b.IdempotencyKey)
+			a.Equal(gotURL, "/ubuntu/desktop/18.04")
+			a.Equal(receipts, []string{bundleP + ".receipt"})
+
+			err = metricsImportReceipts(receipts, source)
+
+			a.CheckWantedErr(err, false)
+			data, err := ioutil.ReadFile(filepath.Join(source, "ubuntu-report", "ubuntu.18.04"))
+			if err != nil {
+				t.Fatal("we expected the report to be saved once its receipt is imported:", err)
+			}
+			a.Equal(string(data), `{"some-data":true}`)
+			exported, _ := filepath.Glob(filepath.Join(source, "ubuntu-report", "exported.*"))
+			a.Equal(len(exported), 0)
+
+			// the same receipt can't be imported twice
+			err = metricsImportReceipts(receipts, source)
+			a.CheckWantedErr(err, true)
+		})
+	}
+}
+
+func TestImportReceiptFromOtherMachine(t *testing.T) {
+	t.Parallel()
+	a := helper.Asserter{T: t}
+
+	out, tearDown := helper.TempDir(t)
+	defer tearDown()
+	receiptP := filepath.Join(out, "report.bundle.receipt")
+	data, err := json.Marshal(receipt{Format: receiptFormat, Distro: "ubuntu", Version: "18.04", IdempotencyKey: "unknown", Checksum: checksum([]byte("{}"))})
+	if err != nil {
+		t.Fatal("couldn't serialize receipt:", err)
+	}
+	if err := ioutil.WriteFile(receiptP, data, 0600); err != nil {
+		t.Fatal("couldn't write receipt:", err)
+	}
+
+	err = metricsImportReceipts([]string{receiptP}, out)
+
+	a.CheckWantedErr(err, true)
+	if _, err := os.Stat(filepath.Join(out, "ubuntu-report", "ubuntu.18.04")); !os.IsNotExist(err) {
+		t.Errorf("we didn't expect a report to be saved for a receipt of an unknown bundle")
+	}
+}
+
+func corruptBundle(t *testing.T, p string) {
+	t.Helper()
+
+	editBundle(t, p, func(b *bundle) { b.Payload = json.RawMessage(`{ "some-data": false }`) })
+}
+
+func removeBundleVariant(t *testing.T, p string) {
+	t.Helper()
+
+	editBundle(t, p, func(b *bundle) { b.Variant = "" })
+}
+
+func previousBundleFormat(t *testing.T, p string) {
+	t.Helper()
+
+	editBundle(t, p, func(b *bundle) { b.Format, b.Variant = 1, "" })
+}
+
+// editBundle rewrites the bundle at p after applying edit
+func editBundle(t *testing.T, p string, edit func(b *bundle)) {
+	t.Helper()
+
+	var b bundle
+	data, err := ioutil.ReadFile(p)
+	if err != nil {
+		t.Fatal("couldn't read bundle:", err)
+	}
+	if err := json.Unmarshal(data, &b); err != nil {
+		t.Fatal("couldn't parse bundle:", err)
+	}
+	edit(&b)
+	if data, err = json.Marshal(b); err != nil {
+		t.Fatal("couldn't serialize bundle:", err)
+	}
+	if err := ioutil.WriteFile(p, data, 0600); err != nil {
+		t.Fatal("couldn't write bundle:", err)
+	}
+}
@@ -0,0 +1,183 @@
+package sysmetrics
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/ubuntu/ubuntu-report/internal/metrics"
+	"github.com/ubuntu/ubuntu-report/internal/utils"
+)
+
+// ConsentDecision is whether the user agreed to report metrics
+type ConsentDecision string
+
+const (
+	// ConsentUnknown is the decision of users who were never asked
+	ConsentUnknown ConsentDecision = ""
+	// ConsentGranted is the decision of users who agreed to report metrics
+	ConsentGranted ConsentDecision = "granted"
+	// ConsentDenied is the decision of users who only send an opt-out message
+	ConsentDenied ConsentDecision = "denied"
+)
+
+// ConsentSource is what recorded the decision
+type ConsentSource string
+
+const (
+	// ConsentFromCLI is a decision taken with the ubuntu-report command
+	ConsentFromCLI ConsentSource = "cli"
+	// ConsentFromInstaller is a decision taken in the installer or the welcome wizard.
+	// This is the default for library callers.
+	ConsentFromInstaller ConsentSource = "installer"
+	// ConsentFromUpgrade is a previous decision carried over on release upgrade
+	ConsentFromUpgrade ConsentSource = "upgrade"
+	// ConsentFromAdmin is a decision taken by the system administrator
+	ConsentFromAdmin ConsentSource = "admin"
+)
+
+// Consent is the recorded decision of the user about reporting metrics
+type Consent struct {
+	Decision ConsentDecision
+	Time     time.Time
+	// PolicyVersion is the privacy policy version the metrics server announced when the decision was taken, if any
+	PolicyVersion string `json:",omitempty"`
+	Source        ConsentSource
+	// ExcludedSections are the sections of the report the user chose not to send, if any
+	ExcludedSections []string `json:",omitempty"`
+	// Outdated is set when the metrics server announced a new privacy policy since the decision.
+	// Users are then asked again and their decision isn't carried over on upgrade.
+	Outdated bool `json:"-"`
+}
+
+// WithConsentSource records s as what took the reporting decision
+func WithConsentSource(s ConsentSource) Option {
+	return func(o *options) {
+		o.consentSource = s
+	}
+}
+
+// transition returns the consent after a decision d from source, or an error if source can't take it.
+// An upgrade only carries over the current decision and never applies an outdated one.
+func (c Consent) transition(d ConsentDecision, source ConsentSource, policyVersion string) (Consent, error) {
+	if d != ConsentGranted && d != ConsentDenied {
+		return c, errors.Errorf("invalid consent decision %q", d)
+	}
+	if source == ConsentFromUpgrade && c.Decision != ConsentUnknown {
+		tr := errorsCatalog()
+		if c.Outdated {
+			return c, errors.New(tr.Get("privacy policy changed since last decision, it can't be carried over on upgrade"))
+		}
+		if c.Decision != d {
+			return c, errors.Errorf(tr.Get("an upgrade can't change the decision from %s to %s"), c.Decision, d)
+		}
+	}
+	return Consent{Decision: d, Time: time.Now().UTC(), PolicyVersion: policyVersion, Source: source}, nil
+}
+
+// loadConsent returns the recorded consent of the user, flagged as outdated if the privacy policy
+// announced by the main server changed since then, or if one is announced while none was recorded.
+func (o options) loadConsent(baseURL, distro, version, reportBasePath string) (Consent, error) {
+	p, err := utils.ConsentPath(reportBasePath)
+	if err != nil {
+		return Consent{}, errors.Wrapf(err, "couldn't get where consent is stored on disk")
+	}
+
+	var c Consent
+	b, err := utils.ReadFile(p)
+	if os.IsNotExist(err) {
+		return c, nil
+	} else if errors.Cause(err) == utils.ErrCorrupted {
+		log.Warningf("ignoring corrupted consent: "+utils.ErrFormat, err)
+		return c, nil
+	} else if err != nil {
+		return c, errors.Wrapf(err, "couldn't read consent")
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		log.Warningf("ignoring invalid consent: "+utils.ErrFormat, err)
+		return Consent{}, nil
+	}
+
+	// the privacy policy is unknown when no url is valid, like when exporting a bundle
+	if s, err := o.mainServerState(baseURL, reportBasePath); err == nil {
+		c.Outdated = c.Decision != ConsentUnknown && s.PrivacyPolicyVersion != "" && c.PolicyVersion != s.PrivacyPolicyVersion
+	}
+	return c, nil
+}
+
+// recordConsent saves the decision of the user, under the privacy policy currently announced by the main server
+func (o options) recordConsent(granted bool, baseURL, distro, version, reportBasePath string) error {
+	c, err := o.loadConsent(baseURL, distro, version, reportBasePath)
+	if err != nil {
+		return err
+	}
+	s, _ := o.mainServerState(baseURL, reportBasePath)
+
+	d := ConsentDenied
+	if granted {
+		d = ConsentGranted
+	}
+	if c, err = c.transition(d, o.consentSource, s.PrivacyPolicyVersion); err != nil {
+		return err
+	}
+	if granted {
+		c.ExcludedSections = o.excludedSections
+	}
+
+	b, err := json.Marshal(c)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't serialize consent")
+	}
+	p, err := utils.ConsentPath(reportBasePath)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't get where consent is stored on disk")
+	}
+	log.Debugf("record consent %s from %s", c.Decision, c.Source)
+	return utils.WriteFile(p, b)
+}
+
+// metricsSetConsent records the decision of the user and sends the matching report for the current
+// release, unless it was already reported with that decision.
+func metricsSetConsent(m metrics.Metrics, granted bool, baseURL, reportBasePath string, in io.Reader, out io.Writer, opts ...Option) error {
+	o := newOptions(opts)
+
+	if err := migrateState(reportBasePath, o.lockTimeout); err != nil {
+		return err
+	}
+
+	distro, version, err := m.GetIDS()
+	if err != nil {
+		return errors.Wrapf(err, "couldn't get mandatory information")
+	}
+	p, err := utils.ReportPath(distro, version, reportBasePath)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't get where to save reported metrics on disk")
+	}
+
+	if b, err := utils.ReadFile(p); err == nil && isOptOut(b) != granted {
+		log.Infof("%s %s was already reported with this decision", distro, version)
+		unlock, err := lockReports(reportBasePath, o.lockTimeout)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		return o.recordConsent(granted, baseURL, distro, version, reportBasePath)
+	}
+
+	var data []byte
+	if granted {
+		if data, err = metricsCollect(m); err != nil {
+			return errors.Wrapf(err, "couldn't collect system minimal info and format it")
+		}
+	}
+	return metricsSend(m, data, granted, true, baseURL, reportBasePath, in, out, opts...)
+}
+
+// isOptOut returns true if the saved report b is an opt-out message
+func isOptOut(b []byte) bool {
+	return strings.TrimSpace(string(b)) == optOutJSON
+}
@@ -0,0 +1,320 @@
+package sysmetrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ubuntu/ubuntu-report/internal/helper"
+	"github.com/ubuntu/ubuntu-report/internal/metrics"
+	"github.com/ubuntu/ubuntu-report/internal/utils"
+)
+
+func TestConsentTransition(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		current  Consent
+		decision ConsentDecision
+		source   ConsentSource
+
+		wantErr bool
+	}{
+		{"first decision", Consent{}, ConsentGranted, ConsentFromInstaller, false},
+		{"change decision", Consent{Decision: ConsentGranted}, ConsentDenied, ConsentFromCLI, false},
+		{"admin decision", Consent{Decision: ConsentDenied}, ConsentGranted, ConsentFromAdmin, false},
+		{"ask again on outdated decision", Consent{Decision: ConsentDenied, Outdated: true}, ConsentGranted, ConsentFromCLI, false},
+		{"upgrade carries decision over", Consent{Decision: ConsentGranted}, ConsentGranted, ConsentFromUpgrade, false},
+		{"upgrade without previous decision", Consent{}, ConsentDenied, ConsentFromUpgrade, false},
+
+		{"upgrade can't change decision", Consent{Decision: ConsentGranted}, ConsentDenied, ConsentFromUpgrade, true},
+		{"upgrade can't carry outdated decision", Consent{Decision: ConsentGranted, Outdated: true}, ConsentGranted, ConsentFromUpgrade, true},
+		{"invalid decision", Consent{}, ConsentUnknown, ConsentFromCLI, true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			got, err := tc.current.transition(tc.decision, tc.source, "2")
+
+			a.CheckWantedErr(err, tc.wantErr)
+			if err != nil {
+				a.Equal(&got, &tc.current)
+				return
+			}
+			a.Equal(got.Decision, tc.decision)
+			a.Equal(got.Source, tc.source)
+			a.Equal(got.PolicyVersion, "2")
+			a.Equal(got.Outdated, false)
+			if got.Time.IsZero() {
+				t.Error("decision time should be recorded")
+			}
+		})
+	}
+}
+
+func TestMetricsSetConsent(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		previous string
+		grant    bool
+
+		shouldHitServer bool
+		wantOptOut      bool
+	}{
+		{"grant without previous report", "", true, true, false},
+		{"revoke without previous report", "", false, true, true},
+		{"grant after opt out", optOutJSON, true, true, false},
+		{"revoke after report", `{ "some-data": true }`, false, true, true},
+		{"grant after report", `{ "some-data": true }`, true, false, false},
+		{"revoke after opt out", optOutJSON, false, false, true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m, cancelGPU, cancelCPU, cancelScreen, cancelPartition,
+				cancelArchitecture, cancelLibc6, cancelHwCap := newTestMetricsWithCommands(t,
+				"testdata/good", "one gpu", "regular", "one screen",
+				"one partition", "regular", "regular", "regular",
+				map[string]string{"XDG_CURRENT_DESKTOP": "some:thing", "XDG_SESSION_DESKTOP": "ubuntusession",
+					"XDG_SESSION_TYPE": "x12", "LANG": "fr_FR.UTF-8", "LANGUAGE": "fr_FR.UTF-8"})
+			defer cancelGPU()
+			defer cancelCPU()
+			defer cancelScreen()
+			defer cancelPartition()
+			defer cancelArchitecture()
+			defer cancelLibc6()
+			defer cancelHwCap()
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			reportP := filepath.Join(out, "ubuntu-report", "ubuntu.18.04")
+			if tc.previous != "" {
+				if err := utils.WriteFile(reportP, []byte(tc.previous)); err != nil {
+					t.Fatal("couldn't write previous report:", err)
+				}
+			}
+			serverHit := false
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				serverHit = true
+				fmt.Fprint(w, `{"PrivacyPolicyVersion": "1"}`)
+			}))
+			defer ts.Close()
+
+			err := metricsSetConsent(m, tc.grant, ts.URL, out, os.Stdin, os.Stdout, WithInsecure(), WithConsentSource(ConsentFromCLI))
+
+			a.CheckWantedErr(err, false)
+			a.Equal(serverHit, tc.shouldHitServer)
+			got, err := utils.ReadFile(reportP)
+			if err != nil {
+				t.Fatal("couldn't read report:", err)
+			}
+			a.Equal(isOptOut(got), tc.wantOptOut)
+			c, err := newOptions([]Option{WithInsecure()}).loadConsent(ts.URL, "ubuntu", "18.04", out)
+			a.CheckWantedErr(err, false)
+			a.Equal(c.Decision == ConsentGranted, tc.grant)
+			a.Equal(c.Source, ConsentFromCLI)
+			if tc.shouldHitServer {
+				a.Equal(c.PolicyVersion, "1")
+			}
+		})
+	}
+}
+
+func TestMetricsSendRecordsConsent(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name      string
+		status    int
+		minSchema int
+
+		wantConsent bool
+		wantErr     bool
+	}{
+		{"delivered", http.StatusOK, 0, true, false},
+		{"saved as pending", http.StatusServiceUnavailable, 0, true, true},
+		{"refused for its format", http.StatusOK, 999, false, true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.status)
+			}))
+			defer ts.Close()
+			if tc.minSchema != 0 {
+				if err := saveServerStates(filepath.Join(out, "ubuntu-report", "servers"),
+					map[string]serverState{ts.URL: {MinSchemaVersion: tc.minSchema}}); err != nil {
+					t.Fatalf("couldn't save server states: %v", err)
+				}
+			}
+
+			m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+			err := metricsSend(m, []byte(`{ "some-data": true }`), true, false, ts.URL, out, os.Stdin, ioutil.Discard, WithInsecure())
+
+			a.CheckWantedErr(err, tc.wantErr)
+			_, errConsent := os.Stat(filepath.Join(out, "ubuntu-report", "user-consent"))
+			a.Equal(errConsent == nil, tc.wantConsent)
+		})
+	}
+}
+
+func TestMetricsCollectAndSendOnUpgradeConsent(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name          string
+		consent       *Consent
+		currentPolicy string
+
+		shouldHitServer bool
+		wantOptOut      bool
+	}{
+		{"no recorded consent uses previous report", nil, "", true, false},
+		{"recorded consent takes precedence over previous report", &Consent{Decision: ConsentDenied, Source: ConsentFromCLI}, "", true, true},
+		{"granted consent", &Consent{Decision: ConsentGranted, PolicyVersion: "1"}, "1", true, false},
+		{"consent before policy versioning without announced policy", &Consent{Decision: ConsentGranted}, "", true, false},
+		{"consent before policy versioning is outdated once a policy is announced", &Consent{Decision: ConsentGranted}, "1", false, false},
+		{"outdated consent isn't carried over", &Consent{Decision: ConsentGranted, PolicyVersion: "1"}, "2", false, false},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m, cancelGPU, cancelCPU, cancelScreen, cancelPartition,
+				cancelArchitecture, cancelLibc6, cancelHwCap := newTestMetricsWithCommands(t,
+				"testdata/good", "one gpu", "regular", "one screen",
+				"one partition", "regular", "regular", "regular",
+				map[string]string{"XDG_CURRENT_DESKTOP": "some:thing", "XDG_SESSION_DESKTOP": "ubuntusession",
+					"XDG_SESSION_TYPE": "x12", "LANG": "fr_FR.UTF-8", "LANGUAGE": "fr_FR.UTF-8"})
+			defer cancelGPU()
+			defer cancelCPU()
+			defer cancelScreen()
+			defer cancelPartition()
+			defer cancelArchitecture()
+			defer cancelLibc6()
+			defer cancelHwCap()
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			serverHit := false
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				serverHit = true
+			}))
+			defer ts.Close()
+
+			previous, err := ioutil.ReadFile("testdata/previous_reports/previous_release_optin/ubuntu.17.10")
+			if err != nil {
+				t.Fatal("couldn't read previous report:", err)
+			}
+			if err := utils.WriteFile(filepath.Join(out, "ubuntu-report", "ubuntu.17.10"), previous); err != nil {
+				t.Fatal("couldn't write previous report:", err)
+			}
+			if tc.consent != nil {
+				writeJSON(t, filepath.Join(out, "ubuntu-report", "user-consent"), tc.consent)
+			}
+			if tc.currentPolicy != "" {
+				writeJSON(t, filepath.Join(out, "ubuntu-report", "servers"),
+					map[string]serverState{ts.URL: {PrivacyPolicyVersion: tc.currentPolicy}})
+			}
+
+			err = metricsCollectAndSendOnUpgrade(m, false, ts.URL, out, os.Stdin, os.Stdout, WithInsecure())
+
+			a.CheckWantedErr(err, false)
+			a.Equal(serverHit, tc.shouldHitServer)
+			got, err := utils.ReadFile(filepath.Join(out, "ubuntu-report", "ubuntu.18.04"))
+			if !tc.shouldHitServer {
+				if !os.IsNotExist(err) {
+					t.Errorf("we didn't expect a report to be saved, got: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("couldn't read report:", err)
+			}
+			a.Equal(isOptOut(got), tc.wantOptOut)
+			c, err := newOptions([]Option{WithInsecure()}).loadConsent(ts.URL, "ubuntu", "18.04", out)
+			a.CheckWantedErr(err, false)
+			a.Equal(c.Source, ConsentFromUpgrade)
+		})
+	}
+}
+
+func TestInteractiveMetricsCollectAndSendOutdatedConsent(t *testing.T) {
+	t.Parallel()
+	a := helper.Asserter{T: t}
+
+	m, cancelGPU, cancelCPU, cancelScreen, cancelPartition,
+		cancelArchitecture, cancelLibc6, cancelHwCap := newTestMetricsWithCommands(t,
+		"testdata/good", "one gpu", "regular", "one screen",
+		"one partition", "regular", "regular", "regular",
+		map[string]string{"XDG_CURRENT_DESKTOP": "some:thing", "XDG_SESSION_DESKTOP": "ubuntusession",
+			"XDG_SESSION_TYPE": "x12", "LANG": "fr_FR.UTF-8", "LANGUAGE": "fr_FR.UTF-8"})
+	defer cancelGPU()
+	defer cancelCPU()
+	defer cancelScreen()
+	defer cancelPartition()
+	defer cancelArchitecture()
+	defer cancelLibc6()
+	defer cancelHwCap()
+	out, tearDown := helper.TempDir(t)
+	defer tearDown()
+	serverHit := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serverHit = true
+	}))
+	defer ts.Close()
+
+	if err := utils.WriteFile(filepath.Join(out, "ubuntu-report", "ubuntu.18.04"), []byte(optOutJSON)); err != nil {
+		t.Fatal("couldn't write previous report:", err)
+	}
+	writeJSON(t, filepath.Join(out, "ubuntu-report", "user-consent"), Consent{Decision: ConsentDenied, PolicyVersion: "1"})
+	writeJSON(t, filepath.Join(out, "ubuntu-report", "servers"), map[string]serverState{ts.URL: {PrivacyPolicyVersion: "2"}})
+
+	stdin, stdinW := io.Pipe()
+	defer stdin.Close()
+	go func() {
+		fmt.Fprintln(stdinW, "y")
+		stdinW.Close()
+	}()
+	err := metricsCollectAndSend(m, ReportInteractive, false, ts.URL, out, stdin, ioutil.Discard, WithInsecure())
+
+	a.CheckWantedErr(err, false)
+	a.Equal(serverHit, true)
+	c, err := newOptions([]Option{WithInsecure()}).loadConsent(ts.URL, "ubuntu", "18.04", out)
+	a.CheckWantedErr(err, false)
+	a.Equal(c.Decision, ConsentGranted)
+	a.Equal(c.Outdated, false)
+}
+
+// writeJSON saves v to p as a stored file
+func writeJSON(t *testing.T, p string, v interface{}) {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("couldn't serialize %v: %v", v, err)
+	}
+	if err := utils.WriteFile(p, b); err != nil {
+		t.Fatalf("couldn't write %s: %v", p, err)
+	}
+}
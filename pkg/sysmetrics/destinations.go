@@ -0,0 +1,281 @@
+package sysmetrics
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/ubuntu/ubuntu-report/internal/i18n"
+	"github.com/ubuntu/ubuntu-report/internal/sender"
+	"github.com/ubuntu/ubuntu-report/internal/utils"
+)
+
+type options struct {
+	// defaultURL is the server to send reports to when no URL is explicitly requested
+	defaultURL string
+	tls        sender.TLSConfig
+	// additionalDestinations receive a copy of every report sent to the main server
+	additionalDestinations []destination
+	// bundlePath, if set, is where the report is exported instead of being sent
+	bundlePath string
+	// lockTimeout is how long we wait for other instances to release the reports lock
+	lockTimeout time.Duration
+	// machineStateDir, if set, is the base directory of machine-wide reports state.
+	// A report from any user then counts as the report of the machine.
+	machineStateDir string
+	// privilegedHelper lets recording reports machine-wide ask for authentication to call the privileged helper
+	privilegedHelper bool
+	// consentSource is what took the reporting decision
+	consentSource ConsentSource
+	// configSources are the configuration files options were loaded from
+	configSources []string
+	// edit opens the collected report in an editor before sending it
+	edit bool
+	// editFile opens a file in the editor of the user
+	editFile func(p string) error
+	// terminalUI lets users choose which sections of the report to send in a full-screen terminal interface
+	terminalUI bool
+	// makeRaw puts a terminal in raw mode for the full-screen interface, returning how to restore it
+	makeRaw func(s interface{}) (func(), error)
+	// terminalRows returns the number of rows of a terminal, or 0 if unknown
+	terminalRows func(s interface{}) int
+	// isTerminal returns if an interactive input or output is a terminal
+	isTerminal func(s interface{}) bool
+	// answerTimeout is how long to wait for interactive answers, if not zero
+	answerTimeout time.Duration
+	// terminalRequired fails interactive reports when stdin isn't a terminal
+	terminalRequired bool
+	// openTTY opens the controlling terminal to read answers from when stdin is redirected
+	openTTY func() (io.ReadCloser, error)
+	// catalog returns the translations of interactive messages in the language of the user
+	catalog func() *i18n.Catalog
+	// dryRun prints the requests reports would be sent with instead of sending them, leaving local state untouched
+	dryRun bool
+	// variant is the product variant reports are sent for instead of the detected one, if set
+	variant string
+	// derivatives map os-release IDs to the distribution reports are sent for
+	derivatives map[string]string
+	// excludedSections are left out of automated reports and recorded alongside the consent
+	excludedSections []string
+}
+
+func newOptions(opts []Option) options {
+	o := options{lockTimeout: defaultLockTimeout, consentSource: ConsentFromInstaller, editFile: runEditor, isTerminal: isTerminal, makeRaw: makeRaw, terminalRows: terminalRows, openTTY: openTTY, catalog: userCatalog}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// destination is a server reports are delivered to
+type destination struct {
+	// baseURL of the server, before distro, product variant and version are appended
+	baseURL  string
+	tls      sender.TLSConfig
+	required bool
+	// main is the metrics server. Other destinations only receive a copy of the reports.
+	main bool
+}
+
+// name of the destination in logs and errors
+func (d destination) name() string {
+	if d.main {
+		return "metrics server"
+	}
+	return d.baseURL
+}
+
+// pendingPath is where a report which couldn't be delivered to d is saved for a later automated report
+func (d destination) pendingPath(reportBasePath string) (string, error) {
+	p, err := utils.PendingReportPath(reportBasePath)
+	if err != nil {
+		return "", err
+	}
+	if d.main {
+		return p, nil
+	}
+	h := sha256.Sum256([]byte(d.baseURL))
+	return p + "." + hex.EncodeToString(h[:8]), nil
+}
+
+// orphanedPending returns the reports pending for destinations which aren't in dests anymore, like when
+// removed from the configuration. They would never be sent.
+func orphanedPending(dests []destination, reportBasePath string) ([]string, error) {
+	p, err := utils.PendingReportPath(reportBasePath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't get where pending reports are stored on disk")
+	}
+	pendings, err := filepath.Glob(p + "*")
+	if err != nil {
+		return nil, errors.Wrapf(err, "incorrect pattern: %s", p)
+	}
+
+	configured := make(map[string]bool)
+	for _, d := range dests {
+		p, err := d.pendingPath(reportBasePath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "couldn't get where pending reports are stored on disk")
+		}
+		configured[p] = true
+	}
+	var orphans []string
+	for _, pending := range pendings {
+		if utils.IsChecksumFile(pending) || configured[pending] {
+			continue
+		}
+		orphans = append(orphans, pending)
+	}
+	return orphans, nil
+}
+
+// destinations returns the main metrics server followed by the additional destinations,
+// alongside the final url reports for distro, product variant and version are sent to.
+func (o options) destinations(baseURL, distro, variant, version string) ([]destination, []string, error) {
+	baseURL, err := o.mainBaseURL(baseURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	dests := append([]destination{{baseURL: baseURL, tls: o.tls, required: true, main: true}}, o.additionalDestinations...)
+
+	var urls []string
+	for _, d := range dests {
+		u, err := sender.GetURL(d.baseURL, distro, variant, version)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "report destination url is invalid")
+		}
+		if err := sender.CheckURL(u, d.tls.Insecure); err != nil {
+			return nil, nil, err
+		}
+		urls = append(urls, u)
+	}
+	return dests, urls, nil
+}
+
+// mainBaseURL returns the url of the main metrics server: baseURL, or the configured or default one if it's empty
+func (o options) mainBaseURL(baseURL string) (string, error) {
+	if baseURL == "" {
+		baseURL = o.defaultURL
+	}
+	if baseURL == "" {
+		baseURL = sender.BaseURL
+	}
+	return baseURL, sender.CheckURL(baseURL, o.tls.Insecure)
+}
+
+// joinErrors returns nil if errs is empty, or a single error for all of them
+func joinErrors(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	var msgs []string
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	return errors.New(strings.Join(msgs, "; "))
+}
+
+// serverState is what we remember about a given metrics server
+type serverState struct {
+	GzipUnsupported bool `json:",omitempty"`
+	// StoppedReleases are the releases the server asked not to be reported anymore
+	StoppedReleases []string `json:",omitempty"`
+	// MinSchemaVersion is the oldest report format the server accepts
+	MinSchemaVersion int `json:",omitempty"`
+	// PrivacyPolicyVersion is the last privacy policy version the server announced
+	PrivacyPolicyVersion string `json:",omitempty"`
+}
+
+// sendReport POST data for distro and version to u and returns the receipt ID the server answered.
+// The payload is gzip-compressed unless d is known to refuse it. Any refusal, as well as the
+// directives the server answered, are recorded for next runs. Every attempt is recorded in the ledger.
+// idempotencyKey, if not empty, lets the server detect a report it already received.
+func sendReport(u string, data []byte, d destination, distro, version, reportBasePath, idempotencyKey string) (string, error) {
+	p, err := utils.ServerStatePath(reportBasePath)
+	if err != nil {
+		return "", errors.Wrapf(err, "couldn't get where server states are stored on disk")
+	}
+	states := loadServerStates(p)
+	state := states[d.baseURL]
+	if err := state.allows(distro, version); err != nil {
+		return "", err
+	}
+
+	r, err := sender.Send(u, data, state.senderOptions(d, idempotencyKey)...)
+	recordTransmission(u, data, r.StatusCode, err, reportBasePath)
+
+	changed := false
+	if r.GzipRefused {
+		state.GzipUnsupported = true
+		changed = true
+	}
+	if err == nil && state.apply(r.Directive, d.name(), distro, version) {
+		changed = true
+	}
+	if changed {
+		states[d.baseURL] = state
+		if err := saveServerStates(p, states); err != nil {
+			log.Infof("couldn't save server states: "+utils.ErrFormat, err)
+		}
+	}
+	return r.Directive.ReceiptID, err
+}
+
+// dryRunReport returns the request sendReport would POST data for distro and version to u with,
+// without sending it nor recording anything
+func dryRunReport(u string, data []byte, d destination, distro, version, reportBasePath, idempotencyKey string) ([]byte, error) {
+	p, err := utils.ServerStatePath(reportBasePath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't get where server states are stored on disk")
+	}
+	state := loadServerStates(p)[d.baseURL]
+	if err := state.allows(distro, version); err != nil {
+		return nil, err
+	}
+	return sender.DryRun(u, data, state.senderOptions(d, idempotencyKey)...)
+}
+
+// senderOptions returns how reports are sent to d, based on what it answered during previous runs
+func (s serverState) senderOptions(d destination, idempotencyKey string) []sender.Option {
+	opts := []sender.Option{sender.WithTLS(d.tls)}
+	if idempotencyKey != "" {
+		opts = append(opts, sender.WithIdempotencyKey(idempotencyKey))
+	}
+	if !s.GzipUnsupported {
+		opts = append(opts, sender.WithGzip())
+	}
+	return opts
+}
+
+func loadServerStates(p string) map[string]serverState {
+	states := make(map[string]serverState)
+	b, err := utils.ReadFile(p)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Infof("couldn't read server states: "+utils.ErrFormat, err)
+		}
+		return states
+	}
+	if err := json.Unmarshal(b, &states); err != nil {
+		log.Infof("server states file is invalid, ignoring: "+utils.ErrFormat, err)
+		return make(map[string]serverState)
+	}
+	return states
+}
+
+func saveServerStates(p string, states map[string]serverState) error {
+	b, err := json.Marshal(states)
+	if err != nil {
+		return errors.Wrap(err, "couldn't serialize server states")
+	}
+	return saveMetrics(p, b)
+}
@@ -0,0 +1,87 @@
+package sysmetrics
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/ubuntu/ubuntu-report/internal/metrics"
+	"github.com/ubuntu/ubuntu-report/internal/utils"
+)
+
+// Change is a field-level difference between a stored report and the current machine
+type Change = metrics.Change
+
+// Kinds of Change
+const (
+	FieldAdded   = metrics.FieldAdded
+	FieldRemoved = metrics.FieldRemoved
+	FieldChanged = metrics.FieldChanged
+)
+
+// metricsDiff collects metrics and returns how they differ from a stored report.
+// against is the path of a report file or a release of this distro. If it's empty,
+// the latest stored report is used.
+func metricsDiff(m metrics.Metrics, against, reportBasePath string, opts ...Option) ([]Change, error) {
+	o := newOptions(opts)
+
+	distro, _, err := m.GetIDS()
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't get mandatory information")
+	}
+
+	p, err := findStoredReport(distro, against, reportBasePath, o.machineStateDir)
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("compare current metrics with %s", p)
+	previous, err := utils.ReadFile(p)
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't read stored report")
+	}
+	if isOptOut(previous) {
+		tr := errorsCatalog()
+		return nil, errors.Errorf(tr.Get("%s is an opt-out message, there are no metrics to compare with"), p)
+	}
+
+	current, err := m.Collect()
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't collect system minimal info")
+	}
+	return metrics.Diff(previous, current)
+}
+
+// findStoredReport returns the path of the report to compare to, given against as for metricsDiff
+func findStoredReport(distro, against, reportBasePath, machineStateDir string) (string, error) {
+	if against == "" {
+		p, _, err := getLastReport(distro, "", reportBasePath, machineStateDir)
+		if err != nil {
+			return "", err
+		}
+		if p == "" {
+			tr := errorsCatalog()
+			return "", errors.New(tr.Get("no report was sent yet, there is nothing to compare with"))
+		}
+		return p, nil
+	}
+
+	if fi, err := os.Stat(against); err == nil && !fi.IsDir() {
+		return against, nil
+	}
+
+	bases := []string{reportBasePath}
+	if machineStateDir != "" {
+		bases = append(bases, machineStateDir)
+	}
+	for _, base := range bases {
+		p, err := utils.ReportPath(distro, against, base)
+		if err != nil {
+			return "", errors.Wrapf(err, "couldn't get where reported metrics are on disk")
+		}
+		if _, err := os.Stat(p); err == nil {
+			return p, nil
+		}
+	}
+	tr := errorsCatalog()
+	return "", errors.Errorf(tr.Get("%s is neither a report file nor a reported release of %s"), against, distro)
+}
@@ -0,0 +1,111 @@
+package sysmetrics
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/ubuntu/ubuntu-report/internal/helper"
+	"github.com/ubuntu/ubuntu-report/internal/metrics"
+	"github.com/ubuntu/ubuntu-report/internal/utils"
+)
+
+func TestMetricsDiff(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name        string
+		storedP     string
+		optOut      bool
+		against     string
+		againstFile bool
+
+		want    []Change
+		wantErr bool
+	}{
+		{"against last report", "ubuntu.18.04", false, "", false,
+			[]Change{{Field: "RAM", Kind: FieldChanged, Old: 4.0, New: 8.0}, {Field: "Timezone", Kind: FieldAdded, New: "Europe/Paris"}}, false},
+		{"against previous release", "ubuntu.17.10", false, "17.10", false,
+			[]Change{{Field: "RAM", Kind: FieldChanged, Old: 4.0, New: 8.0}, {Field: "Timezone", Kind: FieldAdded, New: "Europe/Paris"}}, false},
+		{"against file", "ubuntu.17.10", false, "", true,
+			[]Change{{Field: "RAM", Kind: FieldChanged, Old: 4.0, New: 8.0}, {Field: "Timezone", Kind: FieldAdded, New: "Europe/Paris"}}, false},
+
+		{"no previous report", "", false, "", false, nil, true},
+		{"unknown release", "ubuntu.17.10", false, "16.04", false, nil, true},
+		{"against opt out", "ubuntu.17.10", true, "", false, nil, true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			if tc.storedP != "" {
+				stored := []byte(optOutJSON)
+				if !tc.optOut {
+					stored = collectedAs(t, func(r map[string]interface{}) {
+						r["RAM"] = 4
+						delete(r, "Timezone")
+					})
+				}
+				if err := utils.WriteFile(filepath.Join(out, "ubuntu-report", tc.storedP), stored); err != nil {
+					t.Fatal("couldn't write stored report:", err)
+				}
+			}
+			against := tc.against
+			if tc.againstFile {
+				against = filepath.Join(out, "ubuntu-report", tc.storedP)
+			}
+
+			m, cancel := newDiffTestMetrics(t)
+			defer cancel()
+			got, err := metricsDiff(m, against, out)
+
+			a.CheckWantedErr(err, tc.wantErr)
+			a.Equal(got, tc.want)
+		})
+	}
+}
+
+// collectedAs returns the report collected on the test machine, modified by change
+func collectedAs(t *testing.T, change func(map[string]interface{})) []byte {
+	t.Helper()
+
+	m, cancel := newDiffTestMetrics(t)
+	defer cancel()
+	data, err := metricsCollect(m)
+	if err != nil {
+		t.Fatal("couldn't collect metrics:", err)
+	}
+	var r map[string]interface{}
+	if err := json.Unmarshal(data, &r); err != nil {
+		t.Fatal("couldn't parse collected metrics:", err)
+	}
+	change(r)
+	if data, err = json.MarshalIndent(r, "", "  "); err != nil {
+		t.Fatal("couldn't serialize metrics:", err)
+	}
+	return data
+}
+
+func newDiffTestMetrics(t *testing.T) (metrics.Metrics, func()) {
+	t.Helper()
+
+	m, cancelGPU, cancelCPU, cancelScreen, cancelPartition,
+		cancelArchitecture, cancelLibc6, cancelHwCap := newTestMetricsWithCommands(t,
+		"testdata/good", "one gpu", "regular", "one screen",
+		"one partition", "regular", "regular", "regular",
+		map[string]string{"XDG_CURRENT_DESKTOP": "some:thing", "XDG_SESSION_DESKTOP": "ubuntusession",
+			"XDG_SESSION_TYPE": "x12", "LANG": "fr_FR.UTF-8", "LANGUAGE": "fr_FR.UTF-8"})
+	return m, func() {
+		cancelGPU()
+		cancelCPU()
+		cancelScreen()
+		cancelPartition()
+		cancelArchitecture()
+		cancelLibc6()
+		cancelHwCap()
+	}
+}
@@ -0,0 +1,172 @@
+package sysmetrics
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/ubuntu/ubuntu-report/internal/metrics"
+	"github.com/ubuntu/ubuntu-report/internal/sender"
+	"github.com/ubuntu/ubuntu-report/internal/utils"
+)
+
+var (
+	// errReportingStopped is returned when a server asked not to receive reports for a release anymore
+	errReportingStopped error = localizedError("server asked to stop reporting for this release")
+	// errSchemaUnsupported is returned when a server doesn't accept our report format anymore
+	errSchemaUnsupported error = localizedError("server doesn't accept this report format anymore")
+)
+
+// release identifies a distro version in server states and receipts
+func release(distro, version string) string {
+	return distro + "." + version
+}
+
+// allows returns an error if the server asked not to send it a report for distro and version
+func (s serverState) allows(distro, version string) error {
+	for _, r := range s.StoppedReleases {
+		if r == release(distro, version) {
+			return errReportingStopped
+		}
+	}
+	if s.MinSchemaVersion > metrics.SchemaVersion {
+		tr := errorsCatalog()
+		return errors.Wrapf(errSchemaUnsupported, tr.Get("reports must be in format %d or later while this version of ubuntu-report sends format %d, please upgrade it"),
+			s.MinSchemaVersion, metrics.SchemaVersion)
+	}
+	return nil
+}
+
+// apply records the directive answered by the server for later runs. It returns true if state changed.
+func (s *serverState) apply(dir sender.Directive, name, distro, version string) bool {
+	changed := false
+	if dir.StopReporting {
+		log.Infof("%s asked to stop reporting for %s %s", name, distro, version)
+		s.StoppedReleases = append(s.StoppedReleases, release(distro, version))
+		changed = true
+	}
+	if dir.MinSchemaVersion != 0 && dir.MinSchemaVersion != s.MinSchemaVersion {
+		log.Infof("%s now requires reports in format %d or later", name, dir.MinSchemaVersion)
+		s.MinSchemaVersion = dir.MinSchemaVersion
+		changed = true
+	}
+	if dir.PrivacyPolicyVersion != "" && dir.PrivacyPolicyVersion != s.PrivacyPolicyVersion {
+		if s.PrivacyPolicyVersion != "" {
+			log.Warningf("%s privacy policy changed from version %s to %s", name, s.PrivacyPolicyVersion, dir.PrivacyPolicyVersion)
+		}
+		s.PrivacyPolicyVersion = dir.PrivacyPolicyVersion
+		changed = true
+	}
+	return changed
+}
+
+// checkMainServer returns an error if the main server won't accept a report for distro and version,
+// based on what it answered during previous runs. This avoids collecting and prompting for nothing.
+func (o options) checkMainServer(baseURL, distro, version, reportBasePath string) error {
+	s, err := o.mainServerState(baseURL, reportBasePath)
+	if err != nil {
+		return err
+	}
+	return s.allows(distro, version)
+}
+
+// mainServerState returns what we learnt about the main server during previous runs
+func (o options) mainServerState(baseURL, reportBasePath string) (serverState, error) {
+	baseURL, err := o.mainBaseURL(baseURL)
+	if err != nil {
+		return serverState{}, err
+	}
+	p, err := utils.ServerStatePath(reportBasePath)
+	if err != nil {
+		return serverState{}, errors.Wrapf(err, "couldn't get where server states are stored on disk")
+	}
+	return loadServerStates(p)[baseURL], nil
+}
+
+// reportIDs identify a report delivered to the main server and its copies, so that their deletion can be requested
+type reportIDs struct {
+	// ReceiptID is what the main server answered, if any
+	ReceiptID string `json:",omitempty"`
+	// IdempotencyKey is the key the report was sent to the main server with
+	IdempotencyKey string `json:",omitempty"`
+	// Copies are the keys copies of the report were sent to additional destinations with, by destination url
+	Copies map[string]string `json:",omitempty"`
+	// Variant is the product variant the report was sent for, part of its url on every destination
+	Variant string `json:",omitempty"`
+}
+
+func (ids reportIDs) empty() bool {
+	return !ids.onMain() && len(ids.Copies) == 0
+}
+
+// variant returns the product variant the report was sent for. Reports sent by previous versions were always
+// sent for desktop.
+func (ids reportIDs) variant() string {
+	if ids.Variant == "" {
+		return metrics.VariantDesktop
+	}
+	return ids.Variant
+}
+
+// onMain returns if the main server can identify the report
+func (ids reportIDs) onMain() bool {
+	return ids.ReceiptID != "" || ids.IdempotencyKey != ""
+}
+
+// addCopy records that a copy of the report was delivered to the destination at u with key
+func (ids *reportIDs) addCopy(u, key string) {
+	if ids.Copies == nil {
+		ids.Copies = make(map[string]string)
+	}
+	ids.Copies[u] = key
+}
+
+// saveReportIDs stores how servers identify the report of distro and version. Copies previously delivered to
+// other destinations are kept, as well as how the main server identifies it if ids doesn't tell.
+func saveReportIDs(ids reportIDs, distro, version, reportBasePath string) error {
+	p, err := utils.ReceiptsPath(reportBasePath)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't get where receipts are stored on disk")
+	}
+	receipts, err := loadReceipts(p)
+	if err != nil {
+		return err
+	}
+
+	r := receipts[release(distro, version)]
+	if ids.onMain() {
+		r.ReceiptID, r.IdempotencyKey = ids.ReceiptID, ids.IdempotencyKey
+	}
+	for u, key := range ids.Copies {
+		r.addCopy(u, key)
+	}
+	if ids.Variant != "" {
+		r.Variant = ids.Variant
+	}
+	receipts[release(distro, version)] = r
+	return saveReceipts(p, receipts)
+}
+
+// loadReceipts returns how servers identify each release report
+func loadReceipts(p string) (map[string]reportIDs, error) {
+	receipts := make(map[string]reportIDs)
+	b, err := utils.ReadFile(p)
+	if err != nil && !os.IsNotExist(err) && errors.Cause(err) != utils.ErrCorrupted {
+		return nil, errors.Wrapf(err, "couldn't read receipts")
+	} else if err == nil {
+		if err := json.Unmarshal(b, &receipts); err != nil {
+			log.Infof("receipts file is invalid, resetting it: "+utils.ErrFormat, err)
+			receipts = make(map[string]reportIDs)
+		}
+	}
+	return receipts, nil
+}
+
+func saveReceipts(p string, receipts map[string]reportIDs) error {
+	b, err := json.Marshal(receipts)
+	if err != nil {
+		return errors.Wrap(err, "couldn't serialize receipts")
+	}
+	return saveMetrics(p, b)
+}
@@ -0,0 +1,175 @@
+package sysmetrics
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/ubuntu/ubuntu-report/internal/metrics"
+	"github.com/ubuntu/ubuntu-report/internal/sender"
+	"github.com/ubuntu/ubuntu-report/internal/utils"
+)
+
+// FindingStatus is the result of a check run by Doctor
+type FindingStatus string
+
+const (
+	// FindingOK is a check which passed
+	FindingOK FindingStatus = "ok"
+	// FindingWarning is a check which failed without preventing reports, which then miss some information
+	FindingWarning FindingStatus = "warning"
+	// FindingError is a check which failed and prevents reporting
+	FindingError FindingStatus = "error"
+)
+
+// Finding is the result of a check run by Doctor
+type Finding struct {
+	Check  string
+	Status FindingStatus
+	Detail string
+	// Advice is what to do to fix a failed check
+	Advice string `json:",omitempty"`
+}
+
+// Diagnostic tells how collecting a section of the report went
+type Diagnostic = metrics.Diagnostic
+
+// commandPackages are the packages shipping the commands metrics are collected from
+var commandPackages = map[string]string{
+	"lspci":  "pciutils",
+	"lscpu":  "util-linux",
+	"xrandr": "x11-xserver-utils",
+	"df":     "coreutils",
+	"dpkg":   "dpkg",
+}
+
+// metricsDoctor checks everything reporting relies on: os-release, the commands metrics are collected from,
+// collecting each section, the state directories and the servers reports are sent to.
+func metricsDoctor(m metrics.Metrics, baseURL, reportBasePath string, opts ...Option) []Finding {
+	o := newOptions(opts)
+	var findings []Finding
+
+	distro, version, err := m.GetIDS()
+	if err != nil {
+		findings = append(findings, Finding{Check: "os-release", Status: FindingError, Detail: err.Error(),
+			Advice: "/etc/os-release, or /usr/lib/os-release, should define ID and VERSION_ID: reinstall the base-files package."})
+	} else {
+		findings = append(findings, Finding{Check: "os-release", Status: FindingOK, Detail: fmt.Sprintf("%s %s", distro, version)})
+	}
+
+	for _, c := range m.CheckCommands() {
+		f := Finding{Check: "command " + c.Name, Status: FindingOK, Detail: c.Path}
+		if c.Err != nil {
+			f.Status = FindingWarning
+			f.Detail = c.Err.Error()
+			f.Advice = fmt.Sprintf("Fields read from %s won't be reported.", c.Name)
+			if pkg, ok := commandPackages[c.Name]; ok {
+				f.Advice = fmt.Sprintf("Install the %s package: %s", pkg, f.Advice)
+			}
+		}
+		findings = append(findings, f)
+	}
+
+	if _, diags, err := m.CollectWithDiagnostics(); err != nil {
+		findings = append(findings, Finding{Check: "collect", Status: FindingError, Detail: err.Error()})
+	} else {
+		for _, d := range diags {
+			// missing sections, like a GPU on servers, are expected
+			if d.Status != metrics.DiagnosticError {
+				continue
+			}
+			f := Finding{Check: "collect " + d.Section, Status: FindingWarning, Detail: d.Reason,
+				Advice: fmt.Sprintf("%s won't be reported. Run with -v for details.", d.Section)}
+			if d.ExitCode != nil {
+				f.Detail = fmt.Sprintf("%s (exit code %d)", d.Reason, *d.ExitCode)
+			}
+			findings = append(findings, f)
+		}
+	}
+
+	dirs := []string{reportBasePath}
+	if o.machineStateDir != "" {
+		dirs = append(dirs, o.machineStateDir)
+	}
+	for _, base := range dirs {
+		findings = append(findings, checkStateDir(base))
+	}
+
+	dests, _, err := o.destinations(baseURL, distro, m.GetVariant(), version)
+	if err != nil {
+		return append(findings, Finding{Check: "server", Status: FindingError, Detail: err.Error(),
+			Advice: "Fix the server url in configuration or on the command line."})
+	}
+	for _, d := range dests {
+		f := Finding{Check: "server " + d.baseURL, Status: FindingOK}
+		status, err := sender.Ping(d.baseURL, sender.WithTLS(d.tls))
+		if err != nil {
+			f.Status = FindingError
+			if !d.required {
+				f.Status = FindingWarning
+			}
+			f.Detail = err.Error()
+			f.Advice = "Check network connectivity and proxy settings. Reports are saved and sent again later."
+		} else {
+			f.Detail = fmt.Sprintf("reachable (HTTP %d)", status)
+		}
+		findings = append(findings, f)
+	}
+
+	if distro != "" {
+		state, err := o.mainServerState(baseURL, reportBasePath)
+		if err == nil {
+			err = state.allows(distro, version)
+		}
+		if err != nil {
+			findings = append(findings, Finding{Check: "server directives", Status: FindingWarning, Detail: err.Error(),
+				Advice: "The server refused previous reports: nothing will be sent for this release."})
+		}
+	}
+
+	return findings
+}
+
+// checkStateDir returns if reports state can be written in the state directory of reportBasePath
+func checkStateDir(reportBasePath string) Finding {
+	p, err := utils.LockPath(reportBasePath)
+	if err != nil {
+		return Finding{Check: "state directory", Status: FindingError, Detail: err.Error(),
+			Advice: "Set HOME or XDG_STATE_HOME."}
+	}
+	d := filepath.Dir(p)
+	f := Finding{Check: "state directory", Status: FindingOK, Detail: d + " is writable"}
+	if err := checkWritable(d); err != nil {
+		f.Status = FindingError
+		f.Detail = err.Error()
+		f.Advice = fmt.Sprintf("Fix the permissions of %s: reports can't be saved.", d)
+	}
+	return f
+}
+
+// checkWritable returns an error if a file can't be created in d, or in its closest existing parent
+// if it doesn't exist yet. Nothing is left behind.
+func checkWritable(d string) error {
+	for {
+		fi, err := os.Stat(d)
+		if err == nil {
+			if !fi.IsDir() {
+				return errors.Errorf("%s isn't a directory", d)
+			}
+			break
+		}
+		if !os.IsNotExist(err) || filepath.Dir(d) == d {
+			return errors.Wrapf(err, "couldn't check %s", d)
+		}
+		d = filepath.Dir(d)
+	}
+
+	f, err := ioutil.TempFile(d, ".ubuntu-report-doctor")
+	if err != nil {
+		return errors.Wrapf(err, "%s isn't writable", d)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
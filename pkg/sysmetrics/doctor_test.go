@@ -0,0 +1,94 @@
+package sysmetrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ubuntu/ubuntu-report/internal/helper"
+	"github.com/ubuntu/ubuntu-report/internal/utils"
+)
+
+func TestMetricsDoctor(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name              string
+		serverDown        bool
+		stateDirIsFile    bool
+		stoppedReleases   bool
+		additionalOffline bool
+
+		want map[string]FindingStatus
+	}{
+		{"everything is fine", false, false, false, false,
+			map[string]FindingStatus{"os-release": FindingOK, "state directory": FindingOK, "server": FindingOK}},
+		{"server unreachable", true, false, false, false,
+			map[string]FindingStatus{"os-release": FindingOK, "state directory": FindingOK, "server": FindingError}},
+		{"state directory not writable", false, true, false, false,
+			map[string]FindingStatus{"os-release": FindingOK, "state directory": FindingError, "server": FindingOK}},
+		{"release not accepted anymore", false, false, true, false,
+			map[string]FindingStatus{"server": FindingOK, "server directives": FindingWarning}},
+		{"additional destination unreachable", false, false, false, true,
+			map[string]FindingStatus{"server": FindingOK, "server http://127.0.0.1:1": FindingWarning}},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			defer ts.Close()
+			if tc.serverDown {
+				ts.Close()
+			}
+			if tc.stateDirIsFile {
+				if err := utils.WriteFile(filepath.Join(out, "ubuntu-report"), []byte("not a directory")); err != nil {
+					t.Fatal("couldn't write state directory as a file:", err)
+				}
+			}
+			if tc.stoppedReleases {
+				p := filepath.Join(out, "ubuntu-report", "servers")
+				if err := saveServerStates(p, map[string]serverState{ts.URL: {StoppedReleases: []string{release("ubuntu", "18.04")}}}); err != nil {
+					t.Fatal("couldn't save server states:", err)
+				}
+			}
+			opts := []Option{WithInsecure()}
+			if tc.additionalOffline {
+				opts = append(opts, WithDestination(Destination{URL: "http://127.0.0.1:1", Insecure: true}))
+			}
+
+			m, cancel := newDiffTestMetrics(t)
+			defer cancel()
+			findings := metricsDoctor(m, ts.URL, out, opts...)
+
+			got := make(map[string]Finding)
+			for _, f := range findings {
+				if f.Check == "server "+ts.URL {
+					f.Check = "server"
+				}
+				got[f.Check] = f
+			}
+			for check, want := range tc.want {
+				f, ok := got[check]
+				if !ok {
+					t.Fatalf("no %s check in %+v", check, findings)
+				}
+				a.Equal(f.Status, want)
+				if want != FindingOK && f.Advice == "" {
+					t.Errorf("we expected an advice for %s, got: %+v", check, f)
+				}
+			}
+			for _, f := range findings {
+				if strings.HasPrefix(f.Check, "command ") {
+					a.Equal(f.Status, FindingOK)
+				}
+			}
+		})
+	}
+}
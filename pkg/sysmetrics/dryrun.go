@@ -0,0 +1,41 @@
+package sysmetrics
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/ubuntu/ubuntu-report/internal/utils"
+)
+
+// printRequests prints to out the request data would be sent with to each of dests, at urls, without sending it
+func printRequests(out io.Writer, dests []destination, urls []string, data []byte, distro, version, reportBasePath, idempotencyKey string) error {
+	for i, d := range dests {
+		req, err := dryRunReport(urls[i], data, d, distro, version, reportBasePath, idempotencyKey)
+		if errors.Cause(err) == errReportingStopped {
+			log.Infof("%s asked to stop reporting for %s %s, it wouldn't be sent", d.name(), distro, version)
+			continue
+		} else if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s\n\n", req)
+	}
+	return nil
+}
+
+// printPending prints to out the request the report pending for d would be sent with to u, without
+// sending nor removing it. It returns if a pending report was found.
+func printPending(out io.Writer, pending, u string, d destination, distro, version, reportBasePath string) (bool, error) {
+	data, key, err := loadPending(pending)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if errors.Cause(err) == utils.ErrCorrupted {
+		log.Warningf("pending report is corrupted, it would be dropped: "+utils.ErrFormat, err)
+		return false, nil
+	} else if err != nil {
+		return true, errors.Wrapf(err, "couldn't read pending report")
+	}
+	return true, printRequests(out, []destination{d}, []string{u}, data, distro, version, reportBasePath, key)
+}
@@ -0,0 +1,190 @@
+package sysmetrics
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ubuntu/ubuntu-report/internal/helper"
+	"github.com/ubuntu/ubuntu-report/internal/metrics"
+	"github.com/ubuntu/ubuntu-report/internal/utils"
+)
+
+func TestMetricsSendDryRun(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name            string
+		acknowledgement bool
+		previousReport  bool
+		stopped         bool
+		destination     bool
+		bundle          bool
+
+		wantRequests int
+		wantOut      []string
+		wantErr      bool
+	}{
+		{"report", true, false, false, false, false, 1, []string{"/ubuntu/desktop/18.04", "Content-Encoding: gzip", "Idempotency-Key: ", `{ "some-data": true }`}, false},
+		{"opt out", false, false, false, false, false, 1, []string{"/ubuntu/desktop/18.04", optOutJSON}, false},
+		{"additional destination", true, false, false, true, false, 2, []string{`{ "some-data": true }`}, false},
+		{"release stopped", true, false, true, false, false, 0, nil, false},
+		{"bundle", true, false, false, false, true, 0, []string{"Report would be exported to", `{ "some-data": true }`}, false},
+
+		{"previous report", true, true, false, false, false, 0, nil, true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			hits := 0
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { hits++ }))
+			defer ts.Close()
+
+			if tc.previousReport {
+				writeReport(t, filepath.Join(out, "ubuntu-report", "ubuntu.18.04"), `{ "some-data": true }`)
+			}
+			if tc.stopped {
+				p := filepath.Join(out, "ubuntu-report", "servers")
+				if err := saveServerStates(p, map[string]serverState{ts.URL: {StoppedReleases: []string{release("ubuntu", "18.04")}}}); err != nil {
+					t.Fatal("couldn't save server states:", err)
+				}
+			}
+			opts := []Option{WithInsecure(), WithDryRun()}
+			if tc.destination {
+				opts = append(opts, WithDestination(Destination{URL: ts.URL + "/copy", Insecure: true}))
+			}
+			if tc.bundle {
+				opts = append(opts, WithBundleFile(filepath.Join(out, "bundle")))
+			}
+			before := dirContent(t, out)
+
+			m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+			stdout := &bytes.Buffer{}
+			err := metricsSend(m, []byte(`{ "some-data": true }`), tc.acknowledgement, false, ts.URL, out, strings.NewReader(""), stdout, opts...)
+
+			a.CheckWantedErr(err, tc.wantErr)
+			a.Equal(hits, 0)
+			a.Equal(strings.Count(stdout.String(), "POST "+ts.URL), tc.wantRequests)
+			for _, s := range tc.wantOut {
+				if !strings.Contains(stdout.String(), s) {
+					t.Errorf("expected %q to be printed, got: %s", s, stdout.String())
+				}
+			}
+			a.Equal(dirContent(t, out), before)
+		})
+	}
+}
+
+func TestMetricsSendPendingReportDryRun(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name    string
+		pending string
+
+		wantRequest bool
+		wantErr     bool
+	}{
+		{"pending report", `{ "some-data": true }`, true, false},
+
+		{"no pending report", "", false, true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			hits := 0
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { hits++ }))
+			defer ts.Close()
+
+			if tc.pending != "" {
+				writeReport(t, filepath.Join(out, "ubuntu-report", "pending"), tc.pending)
+			}
+			before := dirContent(t, out)
+
+			m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+			stdout := &bytes.Buffer{}
+			err := metricsSendPendingReport(m, ts.URL, out, strings.NewReader(""), stdout, WithInsecure(), WithDryRun())
+
+			a.CheckWantedErr(err, tc.wantErr)
+			a.Equal(hits, 0)
+			a.Equal(strings.Contains(stdout.String(), "POST "+ts.URL+"/ubuntu/desktop/18.04"), tc.wantRequest)
+			if tc.wantRequest && !strings.Contains(stdout.String(), tc.pending) {
+				t.Errorf("expected the pending report to be printed, got: %s", stdout.String())
+			}
+			a.Equal(dirContent(t, out), before)
+		})
+	}
+}
+
+func TestMetricsSendDryRunUnmigratedState(t *testing.T) {
+	a := helper.Asserter{T: t}
+
+	d, tearDown := helper.TempDir(t)
+	defer tearDown()
+	cacheD, stateD := filepath.Join(d, "cache"), filepath.Join(d, "state")
+	defer helper.ChangeEnv("XDG_CACHE_HOME", cacheD)()
+	defer helper.ChangeEnv("XDG_STATE_HOME", stateD)()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	writeReport(t, filepath.Join(cacheD, "ubuntu-report", "ubuntu.18.04"), `{ "some-data": true }`)
+	before := dirContent(t, d)
+
+	m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+	err := metricsSend(m, []byte(`{ "some-data": true }`), true, false, ts.URL, "", strings.NewReader(""), ioutil.Discard,
+		WithInsecure(), WithDryRun())
+
+	// the previous report saved by previous versions is found, without migrating it
+	a.CheckWantedErr(err, true)
+	a.Equal(dirContent(t, d), before)
+}
+
+func writeReport(t *testing.T, p, data string) {
+	t.Helper()
+
+	if err := utils.WriteFile(p, []byte(data)); err != nil {
+		t.Fatal("couldn't write report:", err)
+	}
+}
+
+// dirContent returns the path of every directory and the path and content of every file under dir
+func dirContent(t *testing.T, dir string) string {
+	t.Helper()
+
+	var b strings.Builder
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		// created directories are a change too
+		if info.IsDir() {
+			b.WriteString(p + "/\n")
+			return nil
+		}
+		content, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		b.WriteString(p + ":" + string(content) + "\n")
+		return nil
+	})
+	if err != nil {
+		t.Fatal("couldn't read directory content:", err)
+	}
+	return b.String()
+}
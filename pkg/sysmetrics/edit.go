@@ -0,0 +1,70 @@
+package sysmetrics
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/ubuntu/ubuntu-report/internal/metrics"
+)
+
+// WithEdit opens the collected report in the editor of the user before sending it.
+// Fields can only be removed or set to null.
+func WithEdit() Option {
+	return func(o *options) {
+		o.edit = true
+	}
+}
+
+// editReport opens data in the editor of the user and returns the edited report, pretty printed,
+// once checked that fields were only removed or nulled.
+func (o options) editReport(data []byte) ([]byte, error) {
+	f, err := ioutil.TempFile("", "ubuntu-report-*.json")
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't create file to edit the report")
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(append(data, '\n'))
+	if errClose := f.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't write report to edit")
+	}
+
+	if err := o.editFile(f.Name()); err != nil {
+		return nil, errors.Wrapf(err, "couldn't edit the report")
+	}
+	edited, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't read edited report")
+	}
+	if err := metrics.CheckEdited(data, edited); err != nil {
+		return nil, err
+	}
+
+	h := json.RawMessage(edited)
+	return json.MarshalIndent(&h, "", "  ")
+}
+
+// runEditor opens p in $EDITOR, or in the default editor of the system if not set, and waits for it to exit
+func runEditor(p string) error {
+	editor := strings.Fields(os.Getenv("EDITOR"))
+	if len(editor) == 0 {
+		editor = []string{"editor"}
+		if _, err := exec.LookPath("editor"); err != nil {
+			editor = []string{"vi"}
+		}
+	}
+	log.Debugf("editing report with %s", editor)
+
+	cmd := exec.Command(editor[0], append(editor[1:], p)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return errors.Wrapf(cmd.Run(), "%s failed", editor[0])
+}
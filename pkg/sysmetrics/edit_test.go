@@ -0,0 +1,100 @@
+package sysmetrics
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ubuntu/ubuntu-report/internal/helper"
+)
+
+func TestMetricsCollectAndSendEdit(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name    string
+		r       ReportType
+		answers string
+		edit    func(report map[string]interface{})
+
+		wantSent    bool
+		wantMissing []string
+		wantErr     bool
+	}{
+		{"fields removed", ReportAuto, "", removeFields("GPU", "Screens"), true, []string{"GPU", "Screens"}, false},
+		{"field nulled", ReportAuto, "", func(r map[string]interface{}) { r["CPU"] = nil }, true, []string{"CPU"}, false},
+		{"unchanged", ReportAuto, "", func(map[string]interface{}) {}, true, nil, false},
+		{"interactive edit then send", ReportInteractive, "e\ny\n", removeFields("Language"), true, []string{"Language"}, false},
+		{"interactive invalid edit is ignored", ReportInteractive, "e\ny\n", func(r map[string]interface{}) { r["Language"] = "en_US" }, true, nil, false},
+		{"interactive edit then quit", ReportInteractive, "e\nq\n", removeFields("Language"), false, nil, false},
+
+		{"field changed", ReportAuto, "", func(r map[string]interface{}) { r["Version"] = "20.04" }, false, nil, true},
+		{"field added", ReportAuto, "", func(r map[string]interface{}) { r["Serial"] = "1234" }, false, nil, true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			defer ts.Close()
+
+			editFile := func(p string) error {
+				b, err := ioutil.ReadFile(p)
+				if err != nil {
+					return err
+				}
+				var report map[string]interface{}
+				if err := json.Unmarshal(b, &report); err != nil {
+					return err
+				}
+				tc.edit(report)
+				if b, err = json.Marshal(report); err != nil {
+					return err
+				}
+				return ioutil.WriteFile(p, b, 0600)
+			}
+
+			m, cancel := newDiffTestMetrics(t)
+			defer cancel()
+			err := metricsCollectAndSend(m, tc.r, false, ts.URL, out, strings.NewReader(tc.answers), ioutil.Discard,
+				WithInsecure(), WithEdit(), func(o *options) { o.editFile = editFile })
+
+			a.CheckWantedErr(err, tc.wantErr)
+			b, err := ioutil.ReadFile(filepath.Join(out, "ubuntu-report", "ubuntu.18.04"))
+			if !tc.wantSent {
+				if !os.IsNotExist(err) {
+					t.Errorf("we didn't expect any report to be sent, got: %s", b)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("we expected a report to be sent:", err)
+			}
+			var got map[string]interface{}
+			if err := json.Unmarshal(b, &got); err != nil {
+				t.Fatal("sent report isn't valid json:", err)
+			}
+			for _, f := range []string{"Version", "CPU", "GPU", "Screens", "Language"} {
+				v, ok := got[f]
+				a.Equal(ok && v != nil, !stringInSlice(f, tc.wantMissing))
+			}
+		})
+	}
+}
+
+func removeFields(fields ...string) func(map[string]interface{}) {
+	return func(r map[string]interface{}) {
+		for _, f := range fields {
+			delete(r, f)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package sysmetrics
+
+import (
+	"github.com/ubuntu/ubuntu-report/internal/metrics"
+)
+
+// FieldInfo describes where a report field comes from, why it's collected and what it can tell
+type FieldInfo = metrics.FieldInfo
+
+// metricsCollectAnnotated collects metrics and pretty prints them with the description of each field
+func metricsCollectAnnotated(m metrics.Metrics) ([]byte, error) {
+	data, err := metricsCollect(m)
+	if err != nil {
+		return nil, err
+	}
+	return metrics.Annotate(data), nil
+}
+
+// Annotate returns a report, as pretty printed by Collect, with comments describing where each field comes from,
+// why it's collected and what it can tell. It isn't valid json anymore.
+func Annotate(report []byte) []byte {
+	return metrics.Annotate(report)
+}
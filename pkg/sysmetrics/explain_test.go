@@ -0,0 +1,29 @@
+package sysmetrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ubuntu/ubuntu-report/internal/metrics"
+)
+
+func TestMetricsCollectAnnotated(t *testing.T) {
+	t.Parallel()
+
+	m, cancel := newDiffTestMetrics(t)
+	defer cancel()
+	got, err := metricsCollectAnnotated(m)
+	if err != nil {
+		t.Fatal("couldn't collect annotated metrics:", err)
+	}
+
+	for _, f := range []string{"Version", "CPU.Name", "GPU.Vendor", "Screens.Size", "Language"} {
+		infos, err := metrics.Explain(f)
+		if err != nil {
+			t.Fatalf("couldn't get description of %s: %v", f, err)
+		}
+		if !strings.Contains(string(got), "// Source: "+infos[0].Source+"\n") {
+			t.Errorf("we expected %s to be annotated, got:\n%s", f, got)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package sysmetrics
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/ubuntu/ubuntu-report/internal/metrics"
+	"github.com/ubuntu/ubuntu-report/internal/sender"
+	"github.com/ubuntu/ubuntu-report/internal/utils"
+)
+
+// errNotIdentifiable is returned when a report was sent without identifiers: the server can't be asked to delete it
+var errNotIdentifiable error = localizedError("deletion couldn't be requested on the server as the report can't be identified there, it was only forgotten locally")
+
+// metricsForget asks the main server, and the additional destinations which received a copy, to delete the reports
+// they received from this user, then replaces them locally with an opt-out marker, so that they aren't asked for or
+// sent again, and records that the user doesn't agree to report metrics anymore. Reports recorded machine-wide are
+// replaced too.
+// Only the report of version, or of the current release if empty, is forgotten unless all is set.
+// Reports whose deletion couldn't be requested from every destination are kept, so that it can be retried.
+// Reports which can't be identified on the server are only forgotten locally, and errNotIdentifiable is returned.
+func metricsForget(m metrics.Metrics, version string, all bool, baseURL, reportBasePath string, opts ...Option) error {
+	o := newOptions(opts)
+
+	distro, current, err := m.GetIDS()
+	if err != nil {
+		return errors.Wrapf(err, "couldn't get mandatory information")
+	}
+	variant := m.GetVariant()
+	dests, _, err := o.destinations(baseURL, distro, variant, current)
+	if err != nil {
+		return err
+	}
+
+	if err := migrateState(reportBasePath, o.lockTimeout); err != nil {
+		return err
+	}
+	unlock, err := lockReports(reportBasePath, o.lockTimeout)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	receiptsP, err := utils.ReceiptsPath(reportBasePath)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't get where receipts are stored on disk")
+	}
+	receipts, err := loadReceipts(receiptsP)
+	if err != nil {
+		return err
+	}
+
+	versions := []string{version}
+	if all {
+		if versions, err = reportedVersions(distro, reportBasePath, receipts); err != nil {
+			return err
+		}
+	} else if version == "" {
+		versions = []string{current}
+	}
+
+	var errs []error
+	for _, v := range versions {
+		remaining, err := o.forgetReport(dests, distro, v, receipts[release(distro, v)], reportBasePath)
+		if errors.Cause(err) == errNotIdentifiable {
+			// it's still forgotten locally, but users must know the server kept it
+			errs = append(errs, err)
+		} else if err != nil {
+			// only destinations which didn't delete it are asked again on next run
+			if !remaining.empty() {
+				receipts[release(distro, v)] = remaining
+			}
+			errs = append(errs, err)
+			continue
+		}
+		delete(receipts, release(distro, v))
+		if v != current {
+			continue
+		}
+		if err := removePendingReports(reportBasePath); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := saveReceipts(receiptsP, receipts); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := o.recordConsent(false, baseURL, distro, current, reportBasePath); err != nil {
+		log.Warningf("couldn't record consent: "+utils.ErrFormat, err)
+	}
+	return joinErrors(errs)
+}
+
+// forgetReport requests the deletion of the report of distro and version from the main server, dests[0], and from
+// every destination which received a copy, as identified by ids, under the product variant it was sent for. The local report, and the
+// machine-wide one if it's the same, are then replaced with an opt-out marker.
+// On error, it returns the ids of the report on the destinations which didn't delete it.
+func (o options) forgetReport(dests []destination, distro, version string, ids reportIDs, reportBasePath string) (reportIDs, error) {
+	p, err := utils.ReportPath(distro, version, reportBasePath)
+	if err != nil {
+		return ids, errors.Wrapf(err, "couldn't get where reported metrics are on disk")
+	}
+	data, err := utils.ReadFile(p)
+	if os.IsNotExist(err) && ids.empty() {
+		tr := errorsCatalog()
+		return ids, errors.Errorf(tr.Get("no report of %s %s was found"), distro, version)
+	}
+
+	var notIdentifiable error
+	switch {
+	case !ids.empty():
+	case err == nil && isOptOut(data):
+		log.Infof("%s %s was reported as an opt-out message, no metrics to delete", distro, version)
+	default:
+		// reports sent by previous versions or from a damaged state can't be identified by the server
+		notIdentifiable = errors.Wrapf(errNotIdentifiable, "%s %s", distro, version)
+	}
+
+	var errs []error
+	variant, remaining := ids.variant(), reportIDs{Variant: ids.Variant}
+	if ids.onMain() {
+		if err := requestDeletion(dests[0], distro, variant, version, ids.ReceiptID, ids.IdempotencyKey, reportBasePath); err != nil {
+			errs = append(errs, err)
+			remaining.ReceiptID, remaining.IdempotencyKey = ids.ReceiptID, ids.IdempotencyKey
+		}
+	}
+	var copies []string
+	for u := range ids.Copies {
+		copies = append(copies, u)
+	}
+	sort.Strings(copies)
+	for _, u := range copies {
+		if err := requestDeletion(copyDestination(u, dests), distro, variant, version, "", ids.Copies[u], reportBasePath); err != nil {
+			errs = append(errs, err)
+			remaining.addCopy(u, ids.Copies[u])
+		}
+	}
+	if len(errs) > 0 {
+		return remaining, joinErrors(errs)
+	}
+
+	if err := o.forgetLocally(p, data, distro, version); err != nil {
+		return reportIDs{}, err
+	}
+	return reportIDs{}, notIdentifiable
+}
+
+// forgetLocally replaces the report data of distro and version saved at p with an opt-out marker, as well as
+// the machine-wide one if it's the same.
+func (o options) forgetLocally(p string, data []byte, distro, version string) error {
+	log.Debugf("replace %s with an opt-out marker", p)
+	if err := saveMetrics(p, []byte(optOutJSON)); err != nil {
+		return err
+	}
+	if o.machineStateDir == "" || data == nil || isOptOut(data) {
+		return nil
+	}
+	// reports from other users of this machine are theirs to forget
+	machineP, err := utils.ReportPath(distro, version, o.machineStateDir)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't get where machine-wide reports are on disk")
+	}
+	if machineData, err := utils.ReadFile(machineP); err != nil || !bytes.Equal(machineData, data) {
+		return nil
+	}
+	log.Debugf("replace machine-wide %s with an opt-out marker", machineP)
+	if err := recordMachineReport(distro, version, []byte(optOutJSON), o.machineStateDir, o.privilegedHelper); err != nil {
+		return errors.Wrapf(err, "couldn't forget %s %s report recorded for all users of this machine", distro, version)
+	}
+	return nil
+}
+
+// requestDeletion asks d to delete the report of distro, product variant and version it identifies with
+// receiptID or idempotencyKey
+func requestDeletion(d destination, distro, variant, version, receiptID, idempotencyKey, reportBasePath string) error {
+	u, err := sender.GetURL(d.baseURL, distro, variant, version)
+	if err != nil {
+		return errors.Wrapf(err, "%s url is invalid", d.name())
+	}
+	opts := []sender.Option{sender.WithTLS(d.tls), sender.WithIdempotencyKey(idempotencyKey)}
+	if receiptID != "" {
+		opts = append(opts, sender.WithReceiptID(receiptID))
+	}
+	status, err := sender.Delete(u, opts...)
+	recordDeletion(u, status, err, reportBasePath)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't request deletion of %s %s report from %s", distro, version, d.name())
+	}
+	log.Infof("deletion of %s %s report requested from %s", distro, version, d.name())
+	return nil
+}
+
+// copyDestination returns the destination at u among dests, with its TLS settings. Destinations removed from the
+// configuration since they received a copy are contacted with default settings.
+func copyDestination(u string, dests []destination) destination {
+	for _, d := range dests {
+		if !d.main && d.baseURL == u {
+			return d
+		}
+	}
+	return destination{baseURL: u}
+}
+
+// reportedVersions returns the versions of distro which were reported by this user, in order
+func reportedVersions(distro, reportBasePath string, receipts map[string]reportIDs) ([]string, error) {
+	p, err := utils.ReportPath(distro, "*", reportBasePath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't get path where metrics are reported on disk")
+	}
+	files, err := filepath.Glob(p)
+	if err != nil {
+		return nil, errors.Wrapf(err, "incorrect pattern: %s", p)
+	}
+
+	found := make(map[string]bool)
+	for _, f := range files {
+		if utils.IsChecksumFile(f) {
+			continue
+		}
+		found[strings.TrimPrefix(filepath.Base(f), distro+".")] = true
+	}
+	for r := range receipts {
+		if strings.HasPrefix(r, distro+".") {
+			found[strings.TrimPrefix(r, distro+".")] = true
+		}
+	}
+
+	var versions []string
+	for v := range found {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool { return utils.CompareVersions(versions[i], versions[j]) < 0 })
+	return versions, nil
+}
+
+// removePendingReports drops reports of the current release waiting to be sent to any destination
+func removePendingReports(reportBasePath string) error {
+	p, err := utils.PendingReportPath(reportBasePath)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't get where pending reports are stored on disk")
+	}
+	pendings, err := filepath.Glob(p + "*")
+	if err != nil {
+		return errors.Wrapf(err, "incorrect pattern: %s", p)
+	}
+	for _, pending := range pendings {
+		if utils.IsChecksumFile(pending) {
+			continue
+		}
+		log.Debugf("remove pending report %s", pending)
+		if err := utils.RemoveFile(pending); err != nil {
+			return errors.Wrapf(err, "couldn't remove pending report")
+		}
+	}
+	return nil
+}
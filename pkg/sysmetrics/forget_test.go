@@ -0,0 +1,339 @@
+package sysmetrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ubuntu/ubuntu-report/internal/helper"
+	"github.com/ubuntu/ubuntu-report/internal/metrics"
+	"github.com/ubuntu/ubuntu-report/internal/utils"
+)
+
+func TestMetricsForget(t *testing.T) {
+	t.Parallel()
+
+	const report = `{ "some-data": true }`
+
+	testCases := []struct {
+		name     string
+		reports  map[string]string
+		receipts string
+		pending  bool
+		status   int
+		version  string
+		all      bool
+
+		wantDeleted  []string
+		wantForgot   []string
+		wantReceipts []string
+		wantPending  bool
+		wantErr      bool
+	}{
+		{"current release", map[string]string{"18.04": report}, `{"ubuntu.18.04":{"ReceiptID":"abc","IdempotencyKey":"key"}}`, false, http.StatusOK, "", false,
+			[]string{"/ubuntu/desktop/18.04 abc key"}, []string{"18.04"}, nil, false, false},
+		{"given release", map[string]string{"17.10": report, "18.04": report}, `{"ubuntu.17.10":{"IdempotencyKey":"old"},"ubuntu.18.04":{"IdempotencyKey":"new"}}`, false, http.StatusOK, "17.10", false,
+			[]string{"/ubuntu/desktop/17.10  old"}, []string{"17.10"}, []string{"ubuntu.18.04"}, false, false},
+		{"all releases", map[string]string{"17.10": report, "18.04": report}, `{"ubuntu.17.10":{"IdempotencyKey":"old"},"ubuntu.18.04":{"IdempotencyKey":"new"}}`, false, http.StatusOK, "", true,
+			[]string{"/ubuntu/desktop/17.10  old", "/ubuntu/desktop/18.04  new"}, []string{"17.10", "18.04"}, nil, false, false},
+		{"pending reports are dropped", map[string]string{"18.04": report}, `{"ubuntu.18.04":{"IdempotencyKey":"key"}}`, true, http.StatusOK, "", false,
+			[]string{"/ubuntu/desktop/18.04  key"}, []string{"18.04"}, nil, false, false},
+		{"unknown report on server", map[string]string{"18.04": report}, `{"ubuntu.18.04":{"IdempotencyKey":"key"}}`, false, http.StatusNotFound, "", false,
+			[]string{"/ubuntu/desktop/18.04  key"}, []string{"18.04"}, nil, false, false},
+		{"opt-out message has nothing to delete", map[string]string{"18.04": optOutJSON}, "", false, http.StatusOK, "", false,
+			nil, []string{"18.04"}, nil, false, false},
+		{"report without identifiers is only forgotten locally, with an error", map[string]string{"18.04": report}, "", false, http.StatusOK, "", false,
+			nil, []string{"18.04"}, nil, false, true},
+
+		{"no report", nil, "", false, http.StatusOK, "", false, nil, nil, nil, false, true},
+		{"unknown release", map[string]string{"18.04": report}, "", false, http.StatusOK, "16.04", false, nil, nil, nil, false, true},
+		{"deletion refused", map[string]string{"18.04": report}, `{"ubuntu.18.04":{"IdempotencyKey":"key"}}`, true, http.StatusInternalServerError, "", false,
+			[]string{"/ubuntu/desktop/18.04  key"}, nil, []string{"ubuntu.18.04"}, true, true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			reportDir := filepath.Join(out, "ubuntu-report")
+			for v, data := range tc.reports {
+				if err := utils.WriteFile(filepath.Join(reportDir, "ubuntu."+v), []byte(data)); err != nil {
+					t.Fatal("couldn't write report:", err)
+				}
+			}
+			if tc.receipts != "" {
+				if err := utils.WriteFile(filepath.Join(reportDir, "receipts"), []byte(tc.receipts)); err != nil {
+					t.Fatal("couldn't write receipts:", err)
+				}
+			}
+			if tc.pending {
+				if err := utils.WriteFile(filepath.Join(reportDir, "pending"), []byte(report)); err != nil {
+					t.Fatal("couldn't write pending report:", err)
+				}
+			}
+			var deleted []string
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != "DELETE" {
+					t.Errorf("unexpected %s request", r.Method)
+				}
+				deleted = append(deleted, r.URL.Path+" "+r.Header.Get("Receipt-ID")+" "+r.Header.Get("Idempotency-Key"))
+				w.WriteHeader(tc.status)
+			}))
+			defer ts.Close()
+
+			m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+			err := metricsForget(m, tc.version, tc.all, ts.URL, out, WithInsecure())
+
+			a.CheckWantedErr(err, tc.wantErr)
+			a.Equal(deleted, tc.wantDeleted)
+			for _, v := range tc.wantForgot {
+				data, err := utils.ReadFile(filepath.Join(reportDir, "ubuntu."+v))
+				if err != nil {
+					t.Fatalf("we expected an opt-out marker for %s: %v", v, err)
+				}
+				a.Equal(string(data), optOutJSON)
+			}
+			for v, data := range tc.reports {
+				if data == optOutJSON || stringInSlice(v, tc.wantForgot) {
+					continue
+				}
+				got, _ := utils.ReadFile(filepath.Join(reportDir, "ubuntu."+v))
+				a.Equal(string(got), data)
+			}
+			receipts, err := loadReceipts(filepath.Join(reportDir, "receipts"))
+			a.CheckWantedErr(err, false)
+			var gotReceipts []string
+			for r := range receipts {
+				gotReceipts = append(gotReceipts, r)
+			}
+			a.Equal(gotReceipts, tc.wantReceipts)
+			_, err = os.Stat(filepath.Join(reportDir, "pending"))
+			a.Equal(err == nil, tc.wantPending)
+
+			c, err := newOptions(nil).loadConsent(ts.URL, "ubuntu", "18.04", out)
+			a.CheckWantedErr(err, false)
+			a.Equal(c.Decision, ConsentDenied)
+		})
+	}
+}
+
+func TestMetricsForgetRecordsDeletion(t *testing.T) {
+	t.Parallel()
+	a := helper.Asserter{T: t}
+
+	out, tearDown := helper.TempDir(t)
+	defer tearDown()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+	err := metricsSend(m, []byte(`{ "some-data": true }`), true, false, ts.URL, out, os.Stdin, os.Stdout, WithInsecure())
+	a.CheckWantedErr(err, false)
+	m = metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+	err = metricsForget(m, "", false, ts.URL, out, WithInsecure())
+	a.CheckWantedErr(err, false)
+
+	transmissions, err := loadLedger(out)
+	a.CheckWantedErr(err, false)
+	if len(transmissions) != 2 {
+		t.Fatalf("expected 2 transmissions, got %d: %+v", len(transmissions), transmissions)
+	}
+	a.Equal(transmissions[1].Kind, KindDeletion)
+	a.Equal(transmissions[1].Result, TransmissionDelivered)
+	a.Equal(transmissions[1].URL, ts.URL+"/ubuntu/desktop/18.04")
+	a.Equal(transmissions[1].PayloadHash, "")
+}
+
+func TestMetricsForgetCopies(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name       string
+		copyStatus int
+
+		wantCopyKept bool
+		wantForgot   bool
+		wantErr      bool
+	}{
+		{"deleted from every destination", http.StatusOK, false, true, false},
+		{"copy deletion refused", http.StatusInternalServerError, true, false, true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			mainTS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			defer mainTS.Close()
+			deleteStatus := http.StatusOK
+			var copyKey, copyDeletedKey string
+			copyTS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != "DELETE" {
+					copyKey = r.Header.Get("Idempotency-Key")
+					return
+				}
+				copyDeletedKey = r.Header.Get("Idempotency-Key")
+				w.WriteHeader(deleteStatus)
+			}))
+			defer copyTS.Close()
+			opts := []Option{WithInsecure(), WithDestination(Destination{URL: copyTS.URL, Insecure: true})}
+
+			m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+			err := metricsSend(m, []byte(`{ "some-data": true }`), true, false, mainTS.URL, out, os.Stdin, os.Stdout, opts...)
+			a.CheckWantedErr(err, false)
+			if copyKey == "" {
+				t.Fatal("we should have sent a copy of the report with an idempotency key")
+			}
+
+			deleteStatus = tc.copyStatus
+			m = metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+			err = metricsForget(m, "", false, mainTS.URL, out, opts...)
+
+			a.CheckWantedErr(err, tc.wantErr)
+			a.Equal(copyDeletedKey, copyKey)
+			receipts, err := loadReceipts(filepath.Join(out, "ubuntu-report", "receipts"))
+			a.CheckWantedErr(err, false)
+			// only the copy is left to delete, under the key it was sent with
+			got := receipts["ubuntu.18.04"]
+			a.Equal(got.onMain(), false)
+			a.Equal(len(got.Copies) == 1, tc.wantCopyKept)
+			if tc.wantCopyKept {
+				a.Equal(got.Copies[copyTS.URL], copyKey)
+			}
+			data, err := utils.ReadFile(filepath.Join(out, "ubuntu-report", "ubuntu.18.04"))
+			a.CheckWantedErr(err, false)
+			a.Equal(string(data) == optOutJSON, tc.wantForgot)
+		})
+	}
+}
+
+func TestMetricsForgetMachineReport(t *testing.T) {
+	t.Parallel()
+
+	const report = `{ "some-data": true }`
+
+	testCases := []struct {
+		name          string
+		machineReport string
+
+		want string
+	}{
+		{"same report is forgotten machine-wide", report, optOutJSON},
+		{"report of another user is kept", `{ "other-user": true }`, `{ "other-user": true }`},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			machineDir, tearDown := helper.TempDir(t)
+			defer tearDown()
+			if err := utils.WriteFile(filepath.Join(out, "ubuntu-report", "ubuntu.18.04"), []byte(report)); err != nil {
+				t.Fatal("couldn't write report:", err)
+			}
+			if err := utils.WriteFile(filepath.Join(out, "ubuntu-report", "receipts"), []byte(`{"ubuntu.18.04":{"IdempotencyKey":"key"}}`)); err != nil {
+				t.Fatal("couldn't write receipts:", err)
+			}
+			if err := saveMachineReport("ubuntu", "18.04", []byte(tc.machineReport), machineDir); err != nil {
+				t.Fatal("couldn't save machine-wide report:", err)
+			}
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			defer ts.Close()
+
+			m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+			err := metricsForget(m, "", false, ts.URL, out, WithInsecure(), func(o *options) { o.machineStateDir = machineDir })
+
+			a.CheckWantedErr(err, false)
+			data, err := utils.ReadFile(filepath.Join(machineDir, "ubuntu-report", "ubuntu.18.04"))
+			a.CheckWantedErr(err, false)
+			a.Equal(string(data), tc.want)
+		})
+	}
+}
+
+func TestMetricsForgetVariant(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		receipts string
+
+		wantDeleted string
+	}{
+		{"variant the report was sent for", `{"ubuntu.18.04":{"IdempotencyKey":"key","Variant":"cloud"}}`, "/ubuntu/cloud/18.04"},
+		{"reports saved by previous versions were sent for desktop", `{"ubuntu.18.04":{"IdempotencyKey":"key"}}`, "/ubuntu/desktop/18.04"},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			reportDir := filepath.Join(out, "ubuntu-report")
+			if err := utils.WriteFile(filepath.Join(reportDir, "ubuntu.18.04"), []byte(`{ "some-data": true }`)); err != nil {
+				t.Fatal("couldn't write report:", err)
+			}
+			if err := utils.WriteFile(filepath.Join(reportDir, "receipts"), []byte(tc.receipts)); err != nil {
+				t.Fatal("couldn't write receipts:", err)
+			}
+			var deleted []string
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				deleted = append(deleted, r.URL.Path)
+			}))
+			defer ts.Close()
+
+			// the variant is now overridden to another one than the report was sent for
+			m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+			if err := metrics.WithVariant("server")(&m); err != nil {
+				t.Fatal("couldn't override variant:", err)
+			}
+			err := metricsForget(m, "", false, ts.URL, out, WithInsecure())
+
+			a.CheckWantedErr(err, false)
+			a.Equal(deleted, []string{tc.wantDeleted})
+		})
+	}
+}
+
+func TestMetricsSendSavesVariant(t *testing.T) {
+	t.Parallel()
+	a := helper.Asserter{T: t}
+
+	out, tearDown := helper.TempDir(t)
+	defer tearDown()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+	if err := metrics.WithVariant("cloud")(&m); err != nil {
+		t.Fatal("couldn't override variant:", err)
+	}
+	err := metricsSend(m, []byte(`{ "some-data": true }`), true, false, ts.URL, out, os.Stdin, os.Stdout, WithInsecure())
+	a.CheckWantedErr(err, false)
+
+	receipts, err := loadReceipts(filepath.Join(out, "ubuntu-report", "receipts"))
+	a.CheckWantedErr(err, false)
+	a.Equal(receipts["ubuntu.18.04"].Variant, "cloud")
+}
+
+func stringInSlice(a string, list []string) bool {
+	for _, b := range list {
+		if b == a {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,188 @@
+package sysmetrics
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/ubuntu/ubuntu-report/internal/utils"
+)
+
+// Result of a transmission
+const (
+	// TransmissionDelivered is a report accepted by the server
+	TransmissionDelivered = "delivered"
+	// TransmissionFailed is a report which couldn't be delivered
+	TransmissionFailed = "failed"
+)
+
+// Kind of report transmitted
+const (
+	// KindReport is a report with the collected metrics
+	KindReport = "report"
+	// KindOptOut is an opt-out message
+	KindOptOut = "opt-out"
+	// KindDeletion is a request to delete a report the server received
+	KindDeletion = "deletion"
+)
+
+// Transmission is an attempt to send a report, as recorded in the local ledger
+type Transmission struct {
+	// ID is the position of the transmission in the ledger, starting at 1
+	ID   int `json:"-"`
+	Time time.Time
+	URL  string
+	// Kind is KindReport, KindOptOut or KindDeletion
+	Kind string
+	// Result is TransmissionDelivered or TransmissionFailed
+	Result string
+	// HTTPStatus is what the server answered, 0 if it couldn't be reached
+	HTTPStatus int `json:",omitempty"`
+	// Error is why the report couldn't be delivered
+	Error string `json:",omitempty"`
+	// PayloadHash identifies the payload, even when it's not kept. Deletion requests don't have any.
+	PayloadHash string `json:",omitempty"`
+	// Payload is what was sent. It's only kept for the most recent delivered transmissions.
+	Payload string `json:",omitempty"`
+}
+
+// maxLedgerPayloads is how many delivered payloads the ledger keeps, the most recent ones. Older
+// transmissions are kept without their payload, which can still be identified by its hash.
+const maxLedgerPayloads = 20
+
+// recordTransmission appends the attempt to send data to u to the ledger. Failing to do so
+// doesn't prevent reporting and is only logged.
+func recordTransmission(u string, data []byte, status int, sendErr error, reportBasePath string) {
+	h := sha256.Sum256(data)
+	t := Transmission{
+		Time:        time.Now().UTC(),
+		URL:         u,
+		Kind:        KindReport,
+		Result:      TransmissionDelivered,
+		HTTPStatus:  status,
+		PayloadHash: fmt.Sprintf("sha256:%x", h),
+		Payload:     string(data),
+	}
+	if isOptOut(data) {
+		t.Kind = KindOptOut
+	}
+	if sendErr != nil {
+		t.Result = TransmissionFailed
+		t.Error = sendErr.Error()
+		t.Payload = ""
+	}
+	appendTransmission(t, reportBasePath)
+}
+
+// recordDeletion appends the request to delete the report received at u to the ledger.
+// Failing to do so is only logged.
+func recordDeletion(u string, status int, deleteErr error, reportBasePath string) {
+	t := Transmission{
+		Time:       time.Now().UTC(),
+		URL:        u,
+		Kind:       KindDeletion,
+		Result:     TransmissionDelivered,
+		HTTPStatus: status,
+	}
+	if deleteErr != nil {
+		t.Result = TransmissionFailed
+		t.Error = deleteErr.Error()
+	}
+	appendTransmission(t, reportBasePath)
+}
+
+func appendTransmission(t Transmission, reportBasePath string) {
+	b, err := json.Marshal(t)
+	if err != nil {
+		log.Warningf("couldn't serialize transmission: "+utils.ErrFormat, err)
+		return
+	}
+	p, err := utils.LedgerPath(reportBasePath)
+	if err != nil {
+		log.Warningf("couldn't get where transmissions are recorded on disk: "+utils.ErrFormat, err)
+		return
+	}
+	if err := utils.AppendLine(p, b); err != nil {
+		log.Warningf("couldn't record transmission: "+utils.ErrFormat, err)
+		return
+	}
+	if t.Payload == "" {
+		return
+	}
+	if err := pruneLedger(p, maxLedgerPayloads); err != nil {
+		log.Warningf("couldn't prune old payloads from transmissions ledger: "+utils.ErrFormat, err)
+	}
+}
+
+// pruneLedger drops the payloads of the ledger at p, except the max most recent ones.
+// Transmissions are kept in place, so that their ID doesn't change.
+func pruneLedger(p string, max int) error {
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't read transmissions ledger")
+	}
+	lines := bytes.Split(bytes.TrimSuffix(b, []byte("\n")), []byte("\n"))
+
+	kept, changed := 0, false
+	for i := len(lines) - 1; i >= 0; i-- {
+		var t Transmission
+		if err := json.Unmarshal(lines[i], &t); err != nil || t.Payload == "" {
+			continue
+		}
+		if kept < max {
+			kept++
+			continue
+		}
+		t.Payload = ""
+		if lines[i], err = json.Marshal(t); err != nil {
+			return errors.Wrapf(err, "couldn't serialize transmission")
+		}
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	return utils.ReplaceLines(p, lines)
+}
+
+// loadLedger returns every recorded transmission, oldest first.
+// Partially written lines, left by an interrupted write, are skipped but keep their ID.
+func loadLedger(reportBasePath string) ([]Transmission, error) {
+	p, err := utils.LedgerPath(reportBasePath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't get where transmissions are recorded on disk")
+	}
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "couldn't open transmissions ledger")
+	}
+	defer f.Close()
+
+	var ts []Transmission
+	scanner := bufio.NewScanner(f)
+	// payloads are bigger than the default line limit
+	scanner.Buffer(nil, 4<<20)
+	for id := 1; scanner.Scan(); id++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		var t Transmission
+		if err := json.Unmarshal(line, &t); err != nil {
+			log.Infof("skipping invalid transmission %d: "+utils.ErrFormat, id, err)
+			continue
+		}
+		t.ID = id
+		ts = append(ts, t)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "couldn't read transmissions ledger")
+	}
+	return ts, nil
+}
@@ -0,0 +1,148 @@
+package sysmetrics
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ubuntu/ubuntu-report/internal/helper"
+	"github.com/ubuntu/ubuntu-report/internal/metrics"
+	"github.com/ubuntu/ubuntu-report/internal/utils"
+)
+
+func TestMetricsSendLedger(t *testing.T) {
+	t.Parallel()
+	a := helper.Asserter{T: t}
+
+	out, tearDown := helper.TempDir(t)
+	defer tearDown()
+	status := http.StatusInternalServerError
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+	data := []byte(`{ "some-data": true }`)
+
+	// first attempt fails and is kept pending, then delivered by the service
+	m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+	err := metricsSend(m, data, true, false, ts.URL, out, os.Stdin, os.Stdout, WithInsecure())
+	a.CheckWantedErr(err, true)
+	status = http.StatusOK
+	m = metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+	err = metricsSendPendingReport(m, ts.URL, out, os.Stdin, os.Stdout, WithInsecure())
+	a.CheckWantedErr(err, false)
+	// then the user opts out
+	m = metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+	err = metricsSend(m, nil, false, true, ts.URL, out, os.Stdin, os.Stdout, WithInsecure())
+	a.CheckWantedErr(err, false)
+
+	got, err := loadLedger(out)
+	a.CheckWantedErr(err, false)
+	if len(got) != 3 {
+		t.Fatalf("expected 3 transmissions, got %d: %+v", len(got), got)
+	}
+	u := ts.URL + "/ubuntu/desktop/18.04"
+	h := sha256.Sum256(data)
+	for i, want := range []Transmission{
+		{ID: 1, URL: u, Kind: KindReport, Result: TransmissionFailed, HTTPStatus: http.StatusInternalServerError,
+			PayloadHash: fmt.Sprintf("sha256:%x", h)},
+		{ID: 2, URL: u, Kind: KindReport, Result: TransmissionDelivered, HTTPStatus: http.StatusOK,
+			PayloadHash: fmt.Sprintf("sha256:%x", h), Payload: string(data)},
+		{ID: 3, URL: u, Kind: KindOptOut, Result: TransmissionDelivered, HTTPStatus: http.StatusOK,
+			PayloadHash: fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(optOutJSON))), Payload: optOutJSON},
+	} {
+		if got[i].Time.IsZero() {
+			t.Errorf("transmission %d should have a time", i+1)
+		}
+		if (got[i].Error != "") != (want.Result == TransmissionFailed) {
+			t.Errorf("transmission %d should only have an error if it failed, got: %q", i+1, got[i].Error)
+		}
+		got[i].Time, got[i].Error = want.Time, ""
+		a.Equal(got[i], want)
+	}
+}
+
+func TestLoadLedgerSkipsInvalidLines(t *testing.T) {
+	t.Parallel()
+	a := helper.Asserter{T: t}
+
+	out, tearDown := helper.TempDir(t)
+	defer tearDown()
+	p := filepath.Join(out, "ubuntu-report", "uploads")
+	for _, l := range []string{
+		`{"URL": "https://first", "Result": "delivered"}`,
+		`{"URL": "https://interrupted", "Res`,
+		`{"URL": "https://third", "Result": "failed"}`,
+	} {
+		if err := utils.AppendLine(p, []byte(l)); err != nil {
+			t.Fatal("couldn't write ledger:", err)
+		}
+	}
+
+	got, err := loadLedger(out)
+
+	a.CheckWantedErr(err, false)
+	a.Equal(len(got), 2)
+	a.Equal(got[0].ID, 1)
+	a.Equal(got[0].URL, "https://first")
+	a.Equal(got[1].ID, 3)
+	a.Equal(got[1].URL, "https://third")
+}
+
+func TestPruneLedger(t *testing.T) {
+	t.Parallel()
+	a := helper.Asserter{T: t}
+
+	out, tearDown := helper.TempDir(t)
+	defer tearDown()
+	p := filepath.Join(out, "ubuntu-report", "uploads")
+	for _, l := range []string{
+		`{"URL": "https://first", "Result": "delivered", "PayloadHash": "sha256:1", "Payload": "first"}`,
+		`{"URL": "https://interrupted", "Res`,
+		`{"URL": "https://third", "Result": "failed", "PayloadHash": "sha256:3"}`,
+		`{"URL": "https://fourth", "Result": "delivered", "PayloadHash": "sha256:4", "Payload": "fourth"}`,
+		`{"URL": "https://fifth", "Result": "delivered", "PayloadHash": "sha256:5", "Payload": "fifth"}`,
+	} {
+		if err := utils.AppendLine(p, []byte(l)); err != nil {
+			t.Fatal("couldn't write ledger:", err)
+		}
+	}
+
+	err := pruneLedger(p, 2)
+
+	a.CheckWantedErr(err, false)
+	got, err := loadLedger(out)
+	a.CheckWantedErr(err, false)
+	a.Equal(len(got), 4)
+	for i, want := range []struct {
+		id          int
+		payloadHash string
+		payload     string
+	}{
+		{1, "sha256:1", ""},
+		{3, "sha256:3", ""},
+		{4, "sha256:4", "fourth"},
+		{5, "sha256:5", "fifth"},
+	} {
+		a.Equal(got[i].ID, want.id)
+		a.Equal(got[i].PayloadHash, want.payloadHash)
+		a.Equal(got[i].Payload, want.payload)
+	}
+}
+
+func TestLoadLedgerWithoutTransmission(t *testing.T) {
+	t.Parallel()
+	a := helper.Asserter{T: t}
+
+	out, tearDown := helper.TempDir(t)
+	defer tearDown()
+
+	got, err := loadLedger(out)
+
+	a.CheckWantedErr(err, false)
+	a.Equal(len(got), 0)
+}
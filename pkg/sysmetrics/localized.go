@@ -0,0 +1,27 @@
+package sysmetrics
+
+import (
+	"sync"
+
+	"github.com/ubuntu/ubuntu-report/internal/i18n"
+)
+
+var (
+	errorsCatalogOnce sync.Once
+	errorsCatalogC    *i18n.Catalog
+)
+
+// errorsCatalog returns the translations of errors returned to users, in their language.
+// It's only loaded once, when the first error is returned.
+func errorsCatalog() *i18n.Catalog {
+	errorsCatalogOnce.Do(func() { errorsCatalogC = userCatalog() })
+	return errorsCatalogC
+}
+
+// localizedError is an error returned to users, translated in their language when displayed.
+// It's meant for exported and compared errors, created before the language of the user is known.
+type localizedError string
+
+func (e localizedError) Error() string {
+	return errorsCatalog().Get(string(e))
+}
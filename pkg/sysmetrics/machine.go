@@ -0,0 +1,77 @@
+package sysmetrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/ubuntu/ubuntu-report/internal/utils"
+)
+
+// machineRecorderCmd runs the privileged helper recording a report machine-wide.
+// Distro and version are appended to it and the report is written on its stdin.
+var machineRecorderCmd = []string{"pkexec", "/usr/bin/ubuntu-report", "machine-record"}
+
+// WithPrivilegedHelper lets reports recorded machine-wide call the privileged helper when the user can't write
+// machine-wide state, which asks for administrator authentication. It's only meant for interactive front-ends:
+// without it, only root records reports machine-wide.
+func WithPrivilegedHelper() Option {
+	return func(o *options) {
+		o.privilegedHelper = true
+	}
+}
+
+// recordMachineReport saves data as the report of this machine for distro and version, shared by all users.
+// Users can't write machine-wide state themselves: the privileged helper is called in that case, if allowed.
+func recordMachineReport(distro, version string, data []byte, machineStateDir string, privilegedHelper bool) error {
+	err := saveMachineReport(distro, version, data, machineStateDir)
+	if err == nil || !os.IsPermission(errors.Cause(err)) {
+		return err
+	}
+	if !privilegedHelper {
+		return errors.Wrapf(err, "only root or an interactive report can record it machine-wide")
+	}
+
+	log.Debugf("can't write machine-wide state, calling privileged helper: "+utils.ErrFormat, err)
+	cmd := exec.Command(machineRecorderCmd[0], append(machineRecorderCmd[1:], distro, version)...)
+	cmd.Stdin = bytes.NewReader(data)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return errors.Wrapf(err, "privileged helper couldn't record report machine-wide: %s", out)
+	}
+	return nil
+}
+
+// saveMachineReport writes data as the report of this machine, readable by all users
+func saveMachineReport(distro, version string, data []byte, machineStateDir string) error {
+	if err := checkIDs(distro, version); err != nil {
+		return err
+	}
+	if !json.Valid(data) {
+		return errors.New("report isn't valid json")
+	}
+
+	p, err := utils.ReportPath(distro, version, machineStateDir)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't get where to save machine-wide report")
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return errors.Wrapf(err, "couldn't create machine-wide state directory")
+	}
+	log.Debugf("save machine-wide report to %s", p)
+	return utils.WriteFileWithMode(p, data, 0644)
+}
+
+// checkIDs refuses distro and version which can't be used as a report file name
+func checkIDs(distro, version string) error {
+	for _, id := range []string{distro, version} {
+		if id == "" || id == "." || id == ".." || strings.ContainsAny(id, "/\x00") {
+			return errors.Errorf("invalid distribution or version: %q %q", distro, version)
+		}
+	}
+	return nil
+}
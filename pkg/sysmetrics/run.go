@@ -1,11 +1,9 @@
 package sysmetrics
 
 import (
-	"bufio"
 	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
@@ -14,7 +12,6 @@ import (
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"github.com/ubuntu/ubuntu-report/internal/metrics"
-	"github.com/ubuntu/ubuntu-report/internal/sender"
 	"github.com/ubuntu/ubuntu-report/internal/utils"
 )
 
@@ -23,26 +20,59 @@ const optOutJSON = `{"OptOut": true}`
 
 var (
 	initialReportTimeoutDuration = 30 * time.Second
+	defaultLockTimeout           = 30 * time.Second
 )
 
 func metricsCollect(m metrics.Metrics) ([]byte, error) {
-	data, err := m.Collect()
+	data, _, err := metricsCollectWithDiagnostics(m)
+	return data, err
+}
+
+// metricsCollectWithDiagnostics collects metrics and pretty prints them, alongside how each section was collected
+func metricsCollectWithDiagnostics(m metrics.Metrics) ([]byte, []Diagnostic, error) {
+	data, diags, err := m.CollectWithDiagnostics()
 	if err != nil {
-		return nil, errors.Wrapf(err, "couldn't collect system minimal info")
+		return nil, nil, errors.Wrapf(err, "couldn't collect system minimal info")
 	}
 
 	log.Debug("pretty print format the collected data to the user")
 	h := json.RawMessage(data)
-	return json.MarshalIndent(&h, "", "  ")
+	b, err := json.MarshalIndent(&h, "", "  ")
+	return b, diags, err
 }
 
-func metricsSend(m metrics.Metrics, data []byte, acknowledgement, alwaysReport bool, baseURL string, reportBasePath string, in io.Reader, out io.Writer) error {
+func metricsSend(m metrics.Metrics, data []byte, acknowledgement, alwaysReport bool, baseURL string, reportBasePath string, in io.Reader, out io.Writer, opts ...Option) error {
+	o := newOptions(opts)
+
 	distro, version, err := m.GetIDS()
 	if err != nil {
 		return errors.Wrapf(err, "couldn't get mandatory information")
 	}
+	variant := m.GetVariant()
+
+	var dests []destination
+	var urls []string
+	if o.bundlePath == "" {
+		if dests, urls, err = o.destinations(baseURL, distro, variant, version); err != nil {
+			return err
+		}
+	}
+
+	// dry runs only read local state: taking the lock would create it
+	if !o.dryRun {
+		if err := migrateState(reportBasePath, o.lockTimeout); err != nil {
+			return err
+		}
+		unlock, err := lockReports(reportBasePath, o.lockTimeout)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	} else {
+		reportBasePath = unmigratedBasePath(reportBasePath)
+	}
 
-	reportP, err := checkPreviousReport(distro, version, reportBasePath, alwaysReport)
+	reportP, err := checkPreviousReport(distro, version, reportBasePath, o.machineStateDir, alwaysReport)
 	if err != nil {
 		return err
 	}
@@ -52,72 +82,225 @@ func metricsSend(m metrics.Metrics, data []byte, acknowledgement, alwaysReport b
 		data = []byte(optOutJSON)
 	}
 
-	if baseURL == "" {
-		baseURL = sender.BaseURL
+	if o.bundlePath != "" {
+		if o.dryRun {
+			fmt.Fprintf(out, "Report would be exported to %s:\n%s\n", o.bundlePath, data)
+			return nil
+		}
+		log.Debugf("export report to %s", o.bundlePath)
+		if err := exportBundle(o.bundlePath, data, distro, variant, version, reportBasePath); err != nil {
+			return err
+		}
+		if err := o.recordConsent(acknowledgement, baseURL, distro, version, reportBasePath); err != nil {
+			log.Warningf("couldn't record consent: "+utils.ErrFormat, err)
+		}
+		return nil
 	}
-	u, err := sender.GetURL(baseURL, distro, version)
+
+	// lets the server detect retries and identify the report if we ask for its deletion
+	key, err := newIdempotencyKey()
 	if err != nil {
-		return errors.Wrapf(err, "report destination url is invalid")
+		return err
 	}
-	if err := sender.Send(u, data); err != nil {
-		returnErr := errors.Wrapf(err, "data were not delivered successfully to metrics server, saving for a later automated report")
-		p, err := utils.PendingReportPath(reportBasePath)
-		if err != nil {
-			return errors.Wrapf(err, "couldn't get where pending reported metrics should be stored on disk: %v", returnErr)
+	if o.dryRun {
+		return printRequests(out, dests, urls, data, distro, version, reportBasePath, key)
+	}
+	ids := reportIDs{IdempotencyKey: key, Variant: variant}
+
+	var errs []error
+	mainDelivered, mainPending := true, false
+	for i, d := range dests {
+		id, err := sendReport(urls[i], data, d, distro, version, reportBasePath, key)
+		if err == nil {
+			if d.main {
+				ids.ReceiptID = id
+			} else {
+				ids.addCopy(d.baseURL, key)
+			}
+			continue
+		}
+
+		if d.main {
+			mainDelivered = false
+		}
+		if errors.Cause(err) == errReportingStopped {
+			log.Infof("%s asked to stop reporting for %s %s, not sending", d.name(), distro, version)
+			continue
 		}
-		if err := saveMetrics(p, data); err != nil {
-			return errors.Wrapf(err, "couldn't save pending reported are on disk: %v", returnErr)
+
+		returnErr := errors.Wrapf(err, "data were not delivered successfully to %s", d.name())
+		// a server refusing our report format will refuse it again in later automated reports
+		if errors.Cause(err) != errSchemaUnsupported {
+			returnErr = errors.Wrapf(err, "data were not delivered successfully to %s, saving for a later automated report", d.name())
+			p, err := d.pendingPath(reportBasePath)
+			if err != nil {
+				return errors.Wrapf(err, "couldn't get where pending reported metrics should be stored on disk: %v", returnErr)
+			}
+			if err := savePending(p, data, key); err != nil {
+				return errors.Wrapf(err, "couldn't save pending reported are on disk: %v", returnErr)
+			}
+			mainPending = mainPending || d.main
 		}
-		return returnErr
+
+		if !d.required {
+			log.Warningf(utils.ErrFormat, returnErr)
+			continue
+		}
+		errs = append(errs, returnErr)
 	}
 
-	return saveMetrics(reportP, data)
+	// recorded once sent, so that it's under the privacy policy the server just announced, or once
+	// saved for a later automated report. The decision isn't recorded if the report is lost.
+	if mainDelivered || mainPending {
+		if err := o.recordConsent(acknowledgement, baseURL, distro, version, reportBasePath); err != nil {
+			log.Warningf("couldn't record consent: "+utils.ErrFormat, err)
+		}
+	}
+	if mainDelivered {
+		if err := saveReport(reportP, data, distro, version, ids, reportBasePath, o.machineStateDir, o.privilegedHelper); err != nil {
+			return err
+		}
+	} else if len(ids.Copies) > 0 {
+		// copies can be deleted even if the main server didn't get the report
+		if err := saveReportIDs(reportIDs{Copies: ids.Copies, Variant: variant}, distro, version, reportBasePath); err != nil {
+			log.Warningf("couldn't save report receipt: "+utils.ErrFormat, err)
+		}
+	}
+	return joinErrors(errs)
 }
 
-func metricsCollectAndSend(m metrics.Metrics, r ReportType, alwaysReport bool, baseURL string, reportBasePath string, in io.Reader, out io.Writer) error {
+func metricsCollectAndSend(m metrics.Metrics, r ReportType, alwaysReport bool, baseURL string, reportBasePath string, in io.Reader, out io.Writer, opts ...Option) error {
+	o := newOptions(opts)
+
+	if !o.dryRun {
+		if err := migrateState(reportBasePath, o.lockTimeout); err != nil {
+			return err
+		}
+	} else {
+		reportBasePath = unmigratedBasePath(reportBasePath)
+	}
+
 	distro, version, err := m.GetIDS()
 	if err != nil {
 		return errors.Wrapf(err, "couldn't get mandatory information")
 	}
 
-	if _, err := checkPreviousReport(distro, version, reportBasePath, alwaysReport); err != nil {
+	if r == ReportInteractive && !alwaysReport {
+		c, err := o.loadConsent(baseURL, distro, version, reportBasePath)
+		if err != nil {
+			return err
+		}
+		if c.Outdated {
+			log.Info("privacy policy changed since last decision, asking again")
+			alwaysReport = true
+		}
+	}
+
+	if _, err := checkPreviousReport(distro, version, reportBasePath, o.machineStateDir, alwaysReport); err != nil {
 		return err
 	}
 
+	// don't collect and prompt for a report the server won't accept
+	if o.bundlePath == "" {
+		err := o.checkMainServer(baseURL, distro, version, reportBasePath)
+		if errors.Cause(err) == errReportingStopped {
+			log.Infof("metrics server asked to stop reporting for %s %s", distro, version)
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+
+	// checked before collecting, as the report can't be sent if nobody can answer
+	var answers *answers
+	if r == ReportInteractive {
+		if answers, err = o.answers(in, out); err != nil {
+			return err
+		}
+		defer answers.close()
+	}
+
 	var data []byte
 	if r != ReportOptOut {
 		if data, err = metricsCollect(m); err != nil {
 			return errors.Wrapf(err, "couldn't collect system minimal info and format it")
 		}
 	}
+	if r == ReportAuto && len(o.excludedSections) > 0 {
+		if data, err = metrics.RemoveSections(data, o.excludedSections); err != nil {
+			return err
+		}
+	}
+	if r == ReportAuto && o.edit {
+		if data, err = o.editReport(data); err != nil {
+			return err
+		}
+	}
+
+	tui := r == ReportInteractive && o.terminalUI
+	if tui && !(o.isTerminal(answers.in) && o.isTerminal(out)) {
+		log.Info("not running in a terminal, asking with line prompts")
+		tui = false
+	}
+	restoreTerminal := func() {}
+	if tui {
+		if restoreTerminal, err = o.makeRaw(answers.in); err != nil {
+			log.Infof("couldn't read keys from the terminal, asking with line prompts: "+utils.ErrFormat, err)
+			tui = false
+		}
+	}
 
 	sendMetrics := true
-	if r == ReportInteractive {
-		fmt.Fprintln(out, "This is the result of hardware and optional installer/upgrader that we collected:")
+	if tui {
+		var excluded []string
+		var answered bool
+		data, sendMetrics, excluded, answered, err = chooseSections(data, answers, out, o.terminalRows(out))
+		restoreTerminal()
+		if err != nil {
+			return err
+		}
+		if !answered {
+			return nil
+		}
+		opts = append(opts, withExcludedSections(excluded))
+	} else if r == ReportInteractive {
+		tr := answers.catalog
+		fmt.Fprintln(out, tr.Get("This is the result of hardware and optional installer/upgrader that we collected:"))
 		fmt.Fprintln(out, string(data))
 
 		validAnswer := false
-		scanner := bufio.NewScanner(in)
 		for validAnswer != true {
-			fmt.Fprintf(out, "Do you agree to report this? [y (send metrics)/n (send opt out message)/Q (quit)] ")
-			if !scanner.Scan() {
+			fmt.Fprint(out, tr.Get("Do you agree to report this? [y (send metrics)/n (send opt out message)/e (edit report)/Q (quit)]")+" ")
+			text, ok := answers.next()
+			if !ok {
 				log.Info("programm interrupted")
 				return nil
 			}
-			text := strings.ToLower(strings.TrimSpace(scanner.Text()))
-			if text == "n" || text == "no" {
+			text = strings.TrimSpace(text)
+			// commands first, as their letters can answer yes or no in some languages, like e in Turkish
+			if t := strings.ToLower(text); t == "e" || t == "edit" {
+				edited, err := o.editReport(data)
+				if err != nil {
+					log.Errorf(tr.Get("report unchanged:")+" "+utils.ErrFormat, err)
+					continue
+				}
+				data = edited
+				fmt.Fprintln(out, tr.Get("This is the report that will be sent:"))
+				fmt.Fprintln(out, string(data))
+				continue
+			} else if t == "q" || t == "quit" || t == "" {
+				return nil
+			} else if tr.IsNo(text) {
 				log.Debug("sending report was denied")
 				sendMetrics = false
 				validAnswer = true
-			} else if text == "y" || text == "yes" {
+			} else if tr.IsYes(text) {
 				log.Debug("sending report was accepted")
 				sendMetrics = true
 				validAnswer = true
-			} else if text == "q" || text == "quit" || text == "" {
-				return nil
 			}
 			if validAnswer != true {
-				log.Error("we didn't understand your answer")
+				log.Error(tr.Get("we didn't understand your answer"))
 			}
 		}
 	} else if r == ReportAuto {
@@ -128,20 +311,30 @@ func metricsCollectAndSend(m metrics.Metrics, r ReportType, alwaysReport bool, b
 		sendMetrics = false
 	}
 
-	return metricsSend(m, data, sendMetrics, alwaysReport, baseURL, reportBasePath, in, out)
+	return metricsSend(m, data, sendMetrics, alwaysReport, baseURL, reportBasePath, in, out, opts...)
 }
 
-func metricsCollectAndSendOnUpgrade(m metrics.Metrics, alwaysReport bool, baseURL string, reportBasePath string, in io.Reader, out io.Writer) error {
+func metricsCollectAndSendOnUpgrade(m metrics.Metrics, alwaysReport bool, baseURL string, reportBasePath string, in io.Reader, out io.Writer, opts ...Option) error {
+	o := newOptions(opts)
+
+	if !o.dryRun {
+		if err := migrateState(reportBasePath, o.lockTimeout); err != nil {
+			return err
+		}
+	} else {
+		reportBasePath = unmigratedBasePath(reportBasePath)
+	}
+
 	distro, version, err := m.GetIDS()
 	if err != nil {
 		return errors.Wrapf(err, "couldn't get mandatory information")
 	}
 
-	if _, err := checkPreviousReport(distro, version, reportBasePath, alwaysReport); err != nil {
+	if _, err := checkPreviousReport(distro, version, reportBasePath, o.machineStateDir, alwaysReport); err != nil {
 		return err
 	}
 
-	latestReportFile, err := getLastReport(distro, reportBasePath, alwaysReport)
+	latestReportFile, previousVersion, err := getLastReport(distro, version, reportBasePath, o.machineStateDir)
 	if err != nil {
 		return err
 	}
@@ -149,69 +342,228 @@ func metricsCollectAndSendOnUpgrade(m metrics.Metrics, alwaysReport bool, baseUR
 		log.Debug("no previous report found, no upgrade report to generate then")
 		return nil
 	}
+	skipped := skippedReleases(distro, previousVersion, version)
+	if skipped > 0 {
+		log.Infof("upgrade from %s %s skipped %d releases, carrying its decision over", distro, previousVersion, skipped)
+	}
 
-	r := ReportOptOut
-	b, err := ioutil.ReadFile(latestReportFile)
+	c, err := o.loadConsent(baseURL, distro, version, reportBasePath)
 	if err != nil {
-		return errors.Wrapf(err, "not able to read latest report content")
+		return err
 	}
-	if strings.TrimSpace(string(b)) != optOutJSON {
+	r := ReportOptOut
+	switch {
+	case c.Outdated:
+		log.Info("privacy policy changed since last decision, not carrying it over")
+		return nil
+	case c.Decision == ConsentGranted:
 		r = ReportAuto
+		opts = append(opts, withExcludedSections(c.ExcludedSections))
+	case c.Decision == ConsentUnknown:
+		// decisions before consent was recorded are only known from the latest report
+		b, err := utils.ReadFile(latestReportFile)
+		if err != nil {
+			return errors.Wrapf(err, "not able to read latest report content")
+		}
+		if !isOptOut(b) {
+			r = ReportAuto
+		}
 	}
 
-	return metricsCollectAndSend(m, r, alwaysReport, baseURL, reportBasePath, in, out)
+	// opt-out messages are sent as is, without anything about the previous release
+	if r == ReportAuto {
+		err := metrics.WithPreviousRelease(metrics.PreviousRelease{
+			Version:         previousVersion,
+			Decision:        string(ConsentGranted),
+			SkippedReleases: skipped,
+		})(&m)
+		if err != nil {
+			return err
+		}
+	}
+
+	return metricsCollectAndSend(m, r, alwaysReport, baseURL, reportBasePath, in, out, append(opts, WithConsentSource(ConsentFromUpgrade))...)
+}
+
+// saveReport records data as delivered to the main server for distro and version, with how the
+// server identifies it. If machineStateDir isn't empty, it's recorded machine-wide too, calling the
+// privileged helper if needed and privilegedHelper is set.
+func saveReport(p string, data []byte, distro, version string, ids reportIDs, reportBasePath, machineStateDir string, privilegedHelper bool) error {
+	if err := saveMetrics(p, data); err != nil {
+		return err
+	}
+	if !ids.empty() {
+		if err := saveReportIDs(ids, distro, version, reportBasePath); err != nil {
+			log.Warningf("couldn't save report receipt: "+utils.ErrFormat, err)
+		}
+	}
+	if machineStateDir != "" {
+		if err := recordMachineReport(distro, version, data, machineStateDir, privilegedHelper); err != nil {
+			log.Warningf("couldn't record report for all users of this machine: "+utils.ErrFormat, err)
+		}
+	}
+	return nil
 }
 
 func saveMetrics(p string, data []byte) error {
 	log.Debugf("save sent metrics to %s", p)
 
-	d := filepath.Dir(p)
-	if err := os.MkdirAll(d, 0700); err != nil {
-		return errors.Wrap(err, "couldn't create parent directory to save reported metrics")
-	}
-
-	if err := ioutil.WriteFile(p, data, 0666); err != nil {
+	if err := utils.WriteFile(p, data); err != nil {
 		return errors.Wrap(err, "couldn't save reported or pending metrics on disk")
 	}
 
 	return nil
 }
 
-func checkPreviousReport(distro, version, reportBasePath string, alwaysReport bool) (string, error) {
+// pendingEnvelope is a report saved for a later automated report, with the idempotency key it was first sent with,
+// so that a server which received it, but whose answer was lost, detects it's the same report
+type pendingEnvelope struct {
+	IdempotencyKey string
+	Payload        string
+}
+
+// savePending saves data, first sent with idempotencyKey, to p for a later automated report
+func savePending(p string, data []byte, idempotencyKey string) error {
+	b, err := json.Marshal(pendingEnvelope{IdempotencyKey: idempotencyKey, Payload: string(data)})
+	if err != nil {
+		return errors.Wrap(err, "couldn't serialize pending report")
+	}
+	return saveMetrics(p, b)
+}
+
+// loadPending returns the report pending at p and the idempotency key to send it with.
+// Pending reports saved by previous versions are the report alone: they get a new key.
+func loadPending(p string) ([]byte, string, error) {
+	b, err := utils.ReadFile(p)
+	if err != nil {
+		return nil, "", err
+	}
+	var e pendingEnvelope
+	if err := json.Unmarshal(b, &e); err == nil && e.IdempotencyKey != "" {
+		return []byte(e.Payload), e.IdempotencyKey, nil
+	}
+
+	key, err := newIdempotencyKey()
+	if err != nil {
+		return nil, "", err
+	}
+	return b, key, nil
+}
+
+// checkPreviousReport returns where to save the report for distro and version, or an error if it
+// was already reported, unless alwaysReport is set.
+// If machineStateDir isn't empty, a report from any user of this machine counts.
+func checkPreviousReport(distro, version, reportBasePath, machineStateDir string, alwaysReport bool) (string, error) {
 	p, err := utils.ReportPath(distro, version, reportBasePath)
 	if err != nil {
 		return "", errors.Wrapf(err, "couldn't get where to save reported metrics on disk")
 	}
-	if _, err := os.Stat(p); !os.IsNotExist(err) {
-		log.Infof("previous report found in %s", p)
+	previous := []string{p}
+	if machineStateDir != "" {
+		machineP, err := utils.ReportPath(distro, version, machineStateDir)
+		if err != nil {
+			return "", errors.Wrapf(err, "couldn't get where machine-wide reports are on disk")
+		}
+		previous = append(previous, machineP)
+	}
+
+	for _, previousP := range previous {
+		if _, err := os.Stat(previousP); os.IsNotExist(err) {
+			continue
+		}
+		// an interrupted or damaged report doesn't count as reported
+		if _, err := utils.ReadFile(previousP); errors.Cause(err) == utils.ErrCorrupted {
+			log.Warningf("ignoring corrupted previous report: "+utils.ErrFormat, err)
+			continue
+		}
+		log.Infof("previous report found in %s", previousP)
 		if !alwaysReport {
-			return "", errors.Errorf("metrics from this machine have already been reported and can be found in: %s", p)
+			tr := errorsCatalog()
+			return "", errors.Errorf(tr.Get("metrics from this machine have already been reported and can be found in: %s"), previousP)
 		}
 		log.Debug("ignore previous report requested")
 	}
 	return p, nil
 }
 
-func getLastReport(distro, reportBasePath string, alwaysReport bool) (string, error) {
-	p, err := utils.ReportPath(distro, "*", reportBasePath)
-	if err != nil {
-		return "", errors.Wrapf(err, "couldn't get path where metrics are reported on disk")
+// getLastReport returns the path and release of the latest report for distro, from this user or,
+// if machineStateDir isn't empty, from any user of this machine. Releases are ordered by version and
+// only those older than before are considered, unless it's empty.
+func getLastReport(distro, before, reportBasePath, machineStateDir string) (string, string, error) {
+	bases := []string{reportBasePath}
+	if machineStateDir != "" {
+		bases = append(bases, machineStateDir)
+	}
+	var files []string
+	for _, base := range bases {
+		p, err := utils.ReportPath(distro, "*", base)
+		if err != nil {
+			return "", "", errors.Wrapf(err, "couldn't get path where metrics are reported on disk")
+		}
+		matches, err := filepath.Glob(p)
+		if err != nil {
+			return "", "", errors.Wrapf(err, "incorrect pattern: %s", p)
+		}
+		files = append(files, matches...)
 	}
 
-	files, err := filepath.Glob(p)
-	if err != nil {
-		return "", errors.Wrapf(err, "incorrect pattern: %s", p)
-	}
-	newestReport := ""
+	newestReport, newestVersion := "", ""
 	for _, f := range files {
-		if f > newestReport {
-			newestReport = f
+		if utils.IsChecksumFile(f) {
+			continue
+		}
+		v := strings.TrimPrefix(filepath.Base(f), distro+".")
+		if before != "" && utils.CompareVersions(v, before) >= 0 {
+			log.Debugf("ignoring report of %s %s, which isn't older than %s", distro, v, before)
+			continue
+		}
+		if newestReport == "" || utils.CompareVersions(v, newestVersion) > 0 {
+			newestReport, newestVersion = f, v
 		}
 	}
-	return newestReport, nil
+	return newestReport, newestVersion, nil
 }
 
-func metricsSendPendingReport(m metrics.Metrics, baseURL, reportBasePath string, in io.Reader, out io.Writer) error {
+// ubuntuReleaseCadence is how many months there are between two Ubuntu releases, published in April and October
+const ubuntuReleaseCadence = 6
+
+// skippedReleases returns how many releases of distro were published between from and to, like when upgrading
+// from an LTS to the next one. It's only known for distributions with a regular release cadence.
+func skippedReleases(distro, from, to string) int {
+	if distro != "ubuntu" {
+		return 0
+	}
+	f, ok := ubuntuReleaseMonth(from)
+	if !ok {
+		return 0
+	}
+	t, ok := ubuntuReleaseMonth(to)
+	if !ok || t <= f {
+		return 0
+	}
+	return (t-f)/ubuntuReleaseCadence - 1
+}
+
+// ubuntuReleaseMonth returns the number of months since year 0 of an Ubuntu release version, like 18.04
+func ubuntuReleaseMonth(version string) (int, bool) {
+	var year, month int
+	if _, err := fmt.Sscanf(version, "%d.%d", &year, &month); err != nil || (month != 4 && month != 10) {
+		return 0, false
+	}
+	return year*12 + month, true
+}
+
+func metricsSendPendingReport(m metrics.Metrics, baseURL, reportBasePath string, in io.Reader, out io.Writer, opts ...Option) error {
+	o := newOptions(opts)
+
+	if !o.dryRun {
+		if err := migrateState(reportBasePath, o.lockTimeout); err != nil {
+			return err
+		}
+	} else {
+		reportBasePath = unmigratedBasePath(reportBasePath)
+	}
+
 	distro, version, err := m.GetIDS()
 	if err != nil {
 		return errors.Wrapf(err, "couldn't get mandatory information")
@@ -222,39 +574,212 @@ func metricsSendPendingReport(m metrics.Metrics, baseURL, reportBasePath string,
 		return errors.Wrapf(err, "couldn't get where to save reported metrics on disk")
 	}
 
-	pending, err := utils.PendingReportPath(reportBasePath)
+	variant := m.GetVariant()
+	dests, urls, err := o.destinations(baseURL, distro, variant, version)
 	if err != nil {
-		return errors.Wrapf(err, "couldn't get where to previous reported metrics are on disk")
-	}
-	data, err := ioutil.ReadFile(pending)
-	if err != nil {
-		return errors.Wrapf(err, "no pending report found")
+		return err
 	}
 
-	if baseURL == "" {
-		baseURL = sender.BaseURL
-	}
-	u, err := sender.GetURL(baseURL, distro, version)
-	if err != nil {
-		return errors.Wrapf(err, "report destination url is invalid")
-	}
+	found := false
+	for i, d := range dests {
+		pending, err := d.pendingPath(reportBasePath)
+		if err != nil {
+			return errors.Wrapf(err, "couldn't get where to previous reported metrics are on disk")
+		}
 
-	wait := time.Duration(initialReportTimeoutDuration)
-	for {
-		if err := sender.Send(u, data); err != nil {
-			log.Errorf("data were not delivered successfully to metrics server, retrying in %ds", wait/(1000*1000*1000))
+		if o.dryRun {
+			hasPending, err := printPending(out, pending, urls[i], d, distro, version, reportBasePath)
+			if err != nil {
+				return err
+			}
+			found = found || hasPending
+			continue
+		}
+
+		wait := time.Duration(initialReportTimeoutDuration)
+		for {
+			hasPending, sendErr, err := sendPending(pending, urls[i], d, distro, variant, version, reportP, reportBasePath, o.machineStateDir, o.lockTimeout)
+			if err != nil {
+				return err
+			}
+			found = found || hasPending
+			if sendErr == nil {
+				break
+			}
+			// optional destinations must not hold up the report: their copy is only attempted once more
+			if !d.required {
+				log.Warningf("%s is still unreachable, dropping its copy of the report: "+utils.ErrFormat, d.name(), sendErr)
+				if err := dropPending(pending, reportBasePath, o.lockTimeout); err != nil {
+					return err
+				}
+				break
+			}
+			log.Errorf("data were not delivered successfully to %s, retrying in %ds: "+utils.ErrFormat, d.name(), wait/(1000*1000*1000), sendErr)
 			time.Sleep(wait)
 			wait = wait * 2
 			if wait > time.Duration(30*time.Minute) {
 				wait = time.Duration(30 * time.Minute)
 			}
-			continue
 		}
-		break
 	}
 
-	if err := os.Remove(pending); err != nil {
-		return errors.Wrapf(err, "couldn't remove pending report after a successful report")
+	dropped, err := dropOrphanedPending(dests, reportBasePath, o.lockTimeout, o.dryRun)
+	if err != nil {
+		return err
+	}
+	if !found && !dropped {
+		tr := errorsCatalog()
+		return errors.New(tr.Get("no pending report found"))
+	}
+	return nil
+}
+
+// dropOrphanedPending removes reports pending for destinations which aren't configured anymore, so that they
+// don't trigger the pending report service forever. Nothing is removed on dry runs.
+// It returns if any was found.
+func dropOrphanedPending(dests []destination, reportBasePath string, lockTimeout time.Duration, dryRun bool) (bool, error) {
+	orphans, err := orphanedPending(dests, reportBasePath)
+	if err != nil || len(orphans) == 0 {
+		return false, err
+	}
+	if dryRun {
+		for _, p := range orphans {
+			log.Warningf("%s is pending for a destination which isn't configured anymore, it would be dropped", p)
+		}
+		return true, nil
+	}
+
+	unlock, err := lockReports(reportBasePath, lockTimeout)
+	if err != nil {
+		return true, err
+	}
+	defer unlock()
+	for _, p := range orphans {
+		log.Warningf("dropping %s, pending for a destination which isn't configured anymore", p)
+		if err := utils.RemoveFile(p); err != nil && !os.IsNotExist(err) {
+			return true, errors.Wrapf(err, "couldn't remove orphaned pending report")
+		}
+	}
+	return true, nil
+}
+
+// dropPending removes the report pending at p while holding the reports lock.
+func dropPending(p, reportBasePath string, lockTimeout time.Duration) error {
+	unlock, err := lockReports(reportBasePath, lockTimeout)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := utils.RemoveFile(p); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "couldn't remove pending report")
+	}
+	return nil
+}
+
+// sendPending sends the report pending for d, if any, while holding the reports lock.
+// It returns if a pending report was found, and sendErr if sending should be retried later.
+func sendPending(pending, u string, d destination, distro, variant, version, reportP, reportBasePath, machineStateDir string, lockTimeout time.Duration) (found bool, sendErr error, err error) {
+	unlock, err := lockReports(reportBasePath, lockTimeout)
+	if err != nil {
+		return false, err, nil
+	}
+	defer unlock()
+
+	// another instance may have sent or rewritten it while we were waiting
+	data, key, err := loadPending(pending)
+	if os.IsNotExist(err) {
+		return false, nil, nil
+	} else if errors.Cause(err) == utils.ErrCorrupted {
+		log.Warningf("dropping corrupted pending report: "+utils.ErrFormat, err)
+		if err := utils.RemoveFile(pending); err != nil {
+			return true, nil, errors.Wrapf(err, "couldn't remove corrupted pending report")
+		}
+		return false, nil, nil
+	} else if err != nil {
+		return true, nil, errors.Wrapf(err, "couldn't read pending report")
+	}
+
+	receiptID, err := sendReport(u, data, d, distro, version, reportBasePath, key)
+	// a server refusing our report format will refuse it again on every retry
+	stopped := errors.Cause(err) == errReportingStopped
+	refused := errors.Cause(err) == errSchemaUnsupported
+	if err != nil && !stopped && !refused {
+		return true, err, nil
+	}
+
+	if err := utils.RemoveFile(pending); err != nil {
+		return true, nil, errors.Wrapf(err, "couldn't remove pending report after a successful report")
+	}
+	if stopped {
+		log.Infof("%s asked to stop reporting for %s %s, dropping pending report", d.name(), distro, version)
+		return true, nil, nil
+	}
+	if refused {
+		log.Warningf("%s refused the pending report, dropping it: "+utils.ErrFormat, d.name(), err)
+		return true, nil, nil
+	}
+	if !d.main {
+		ids := reportIDs{Variant: variant}
+		ids.addCopy(d.baseURL, key)
+		if err := saveReportIDs(ids, distro, version, reportBasePath); err != nil {
+			log.Warningf("couldn't save report receipt: "+utils.ErrFormat, err)
+		}
+		return true, nil, nil
+	}
+	// the pending report service runs unattended: it can't answer an authentication request
+	return true, nil, saveReport(reportP, data, distro, version, reportIDs{ReceiptID: receiptID, IdempotencyKey: key, Variant: variant}, reportBasePath, machineStateDir, false)
+}
+
+// lockReports prevents other instances from acting on reports until the returned function is called.
+// It only fails if another instance still holds the lock after timeout: if the lock can't be taken
+// at all, like on a read-only cache directory, we proceed without it.
+func lockReports(reportBasePath string, timeout time.Duration) (func(), error) {
+	p, err := utils.LockPath(reportBasePath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't get where the lock file is stored on disk")
+	}
+	unlock, err := utils.Lock(p, timeout)
+	if errors.Cause(err) == utils.ErrLocked {
+		return nil, err
+	} else if err != nil {
+		log.Warningf("couldn't lock reports, proceeding without: "+utils.ErrFormat, err)
+		unlock = func() {}
+	}
+	return unlock, nil
+}
+
+// migrateState migrates reports state saved by previous versions, under the reports lock.
+// It's called before actions changing reports state read it, unless on dry runs.
+func migrateState(reportBasePath string, timeout time.Duration) error {
+	// only the default state directory has a previous location
+	if reportBasePath != "" {
+		return nil
+	}
+	unlock, err := lockReports(reportBasePath, timeout)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := utils.MigrateStateDir(); err != nil {
+		log.Warningf("couldn't migrate reports state from the cache directory: "+utils.ErrFormat, err)
+	}
+	return nil
+}
+
+// unmigratedBasePath returns the base path reports state is read from by dry runs, which can't migrate it:
+// where previous versions saved it, as long as it wasn't migrated.
+func unmigratedBasePath(reportBasePath string) string {
+	if reportBasePath != "" {
+		return reportBasePath
+	}
+	d, ok, err := utils.UnmigratedStateDir()
+	if err != nil {
+		log.Debugf("couldn't check if reports state was migrated: "+utils.ErrFormat, err)
+		return reportBasePath
+	}
+	if !ok {
+		return reportBasePath
 	}
-	return saveMetrics(reportP, data)
+	log.Debugf("reports state wasn't migrated yet, reading it from %s", d)
+	return d
 }
@@ -16,9 +16,11 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ubuntu/ubuntu-report/internal/helper"
 	"github.com/ubuntu/ubuntu-report/internal/metrics"
+	"github.com/ubuntu/ubuntu-report/internal/utils"
 )
 
 var Update = flag.Bool("update", false, "update golden files")
@@ -160,7 +162,7 @@ func TestMetricsSend(t *testing.T) {
 				url = ts.URL
 			}
 
-			err := metricsSend(m, tc.data, tc.ack, false, url, out, os.Stdout, os.Stdin)
+			err := metricsSend(m, tc.data, tc.ack, false, url, out, os.Stdout, os.Stdin, WithInsecure())
 
 			a.CheckWantedErr(err, tc.wantErr)
 			// check we didn't do too much work on error
@@ -176,13 +178,12 @@ func TestMetricsSend(t *testing.T) {
 						t.Errorf("we didn't expect finding a cache report path as we erroring out")
 					}
 				} else {
-					gotF, err := os.Open(filepath.Join(out, tc.pendingReportP))
+					got, key, err := loadPending(filepath.Join(out, tc.pendingReportP))
 					if err != nil {
 						t.Fatal("didn't generate a pending report file on disk", err)
 					}
-					got, err := ioutil.ReadAll(gotF)
-					if err != nil {
-						t.Fatal("couldn't read generated pending report file", err)
+					if key == "" {
+						t.Error("we expected the pending report to be saved with its idempotency key")
 					}
 					want := helper.LoadOrUpdateGolden(t, filepath.Join(tc.root, "gold", fmt.Sprintf("metricssendpending.%s.%t", strings.Replace(tc.name, " ", "_", -1), tc.ack)), got, *Update)
 					a.Equal(got, want)
@@ -235,7 +236,7 @@ func TestMultipleMetricsSend(t *testing.T) {
 			}))
 			defer ts.Close()
 
-			err := metricsSend(m, []byte(`{ "some-data": true }`), true, tc.alwaysReport, ts.URL, out, os.Stdout, os.Stdin)
+			err := metricsSend(m, []byte(`{ "some-data": true }`), true, tc.alwaysReport, ts.URL, out, os.Stdout, os.Stdin, WithInsecure())
 			if err != nil {
 				t.Fatal("Didn't expect first call to fail")
 			}
@@ -243,7 +244,7 @@ func TestMultipleMetricsSend(t *testing.T) {
 			// second call, reset server
 			serverHitAt = ""
 			m = metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
-			err = metricsSend(m, []byte(`{ "some-data": true }`), true, tc.alwaysReport, ts.URL, out, os.Stdout, os.Stdin)
+			err = metricsSend(m, []byte(`{ "some-data": true }`), true, tc.alwaysReport, ts.URL, out, os.Stdout, os.Stdin, WithInsecure())
 
 			a.CheckWantedErr(err, tc.wantErr)
 			// check we didn't do too much work on error
@@ -271,6 +272,551 @@ func TestMultipleMetricsSend(t *testing.T) {
 	}
 }
 
+func TestMetricsSendPreviousReportIntegrity(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name    string
+		corrupt bool
+
+		wantHit bool
+		wantErr bool
+	}{
+		{"valid previous report", false, false, true},
+		{"corrupted previous report is ignored", true, true, false},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			reportP := filepath.Join(out, "ubuntu-report", "ubuntu.18.04")
+			if err := utils.WriteFile(reportP, []byte(`{ "some-data": true }`)); err != nil {
+				t.Fatal("couldn't save previous report:", err)
+			}
+			if tc.corrupt {
+				// simulate a report truncated by a crash
+				if err := ioutil.WriteFile(reportP, []byte(`{ "some-da`), 0600); err != nil {
+					t.Fatal("couldn't corrupt previous report:", err)
+				}
+			}
+			serverHit := false
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				serverHit = true
+			}))
+			defer ts.Close()
+
+			err := metricsSend(m, []byte(`{ "some-data": true }`), true, false, ts.URL, out, os.Stdout, os.Stdin, WithInsecure())
+
+			a.CheckWantedErr(err, tc.wantErr)
+			a.Equal(serverHit, tc.wantHit)
+			data, err := utils.ReadFile(reportP)
+			if err != nil {
+				t.Fatal("we expected a valid report to be saved, got:", err)
+			}
+			a.Equal(string(data), `{ "some-data": true }`)
+		})
+	}
+}
+
+func TestMetricsSendMachineScope(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name                string
+		machineScope        bool
+		reportedByOtherUser bool
+
+		wantHit bool
+		wantErr bool
+	}{
+		{"first report of the machine", true, false, true, false},
+		{"already reported by another user", true, true, false, true},
+		{"per-user scope ignores other users", false, true, true, false},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			machineDir, tearDown := helper.TempDir(t)
+			defer tearDown()
+			machineReportP := filepath.Join(machineDir, "ubuntu-report", "ubuntu.18.04")
+			if tc.reportedByOtherUser {
+				if err := saveMachineReport("ubuntu", "18.04", []byte(optOutJSON), machineDir); err != nil {
+					t.Fatal("couldn't save machine-wide report:", err)
+				}
+			}
+			opts := []Option{WithInsecure()}
+			if tc.machineScope {
+				opts = append(opts, func(o *options) { o.machineStateDir = machineDir })
+			}
+			serverHit := false
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				serverHit = true
+			}))
+			defer ts.Close()
+
+			err := metricsSend(m, []byte(`{ "some-data": true }`), true, false, ts.URL, out, os.Stdout, os.Stdin, opts...)
+
+			a.CheckWantedErr(err, tc.wantErr)
+			a.Equal(serverHit, tc.wantHit)
+			if !tc.machineScope || tc.wantErr {
+				return
+			}
+			data, err := utils.ReadFile(machineReportP)
+			if err != nil {
+				t.Fatal("we expected the report to be recorded for the machine:", err)
+			}
+			a.Equal(string(data), `{ "some-data": true }`)
+			fi, err := os.Stat(machineReportP)
+			if err != nil {
+				t.Fatal("couldn't stat machine-wide report:", err)
+			}
+			a.Equal(fi.Mode().Perm(), os.FileMode(0644))
+		})
+	}
+}
+
+func TestGetLastReportMachineScope(t *testing.T) {
+	t.Parallel()
+	a := helper.Asserter{T: t}
+
+	out, tearDown := helper.TempDir(t)
+	defer tearDown()
+	machineDir, tearDown := helper.TempDir(t)
+	defer tearDown()
+	if err := utils.WriteFile(filepath.Join(out, "ubuntu-report", "ubuntu.17.04"), []byte(optOutJSON)); err != nil {
+		t.Fatal("couldn't save user report:", err)
+	}
+	if err := saveMachineReport("ubuntu", "17.10", []byte(`{ "some-data": true }`), machineDir); err != nil {
+		t.Fatal("couldn't save machine-wide report:", err)
+	}
+
+	got, _, err := getLastReport("ubuntu", "", out, "")
+	a.CheckWantedErr(err, false)
+	a.Equal(got, filepath.Join(out, "ubuntu-report", "ubuntu.17.04"))
+
+	got, _, err = getLastReport("ubuntu", "", out, machineDir)
+	a.CheckWantedErr(err, false)
+	a.Equal(got, filepath.Join(machineDir, "ubuntu-report", "ubuntu.17.10"))
+}
+
+func TestGetLastReport(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		versions []string
+		before   string
+
+		want string
+	}{
+		{"no report", nil, "", ""},
+		{"one report", []string{"17.10"}, "", "17.10"},
+		{"ordered by version", []string{"9.10", "17.10", "17.04"}, "", "17.10"},
+		{"point releases", []string{"18.04.10", "18.04.2"}, "", "18.04.10"},
+		{"only older releases", []string{"17.10", "18.04", "18.10"}, "18.04", "17.10"},
+		{"no older release", []string{"18.04", "18.10"}, "18.04", ""},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			for _, v := range tc.versions {
+				if err := utils.WriteFile(filepath.Join(out, "ubuntu-report", "ubuntu."+v), []byte(optOutJSON)); err != nil {
+					t.Fatal("couldn't save report:", err)
+				}
+			}
+
+			got, version, err := getLastReport("ubuntu", tc.before, out, "")
+
+			a.CheckWantedErr(err, false)
+			a.Equal(version, tc.want)
+			if tc.want == "" {
+				a.Equal(got, "")
+				return
+			}
+			a.Equal(got, filepath.Join(out, "ubuntu-report", "ubuntu."+tc.want))
+		})
+	}
+}
+
+func TestSkippedReleases(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		distro string
+		from   string
+		to     string
+
+		want int
+	}{
+		{"ubuntu", "17.10", "18.04", 0},
+		{"ubuntu", "18.04", "18.10", 0},
+		{"ubuntu", "16.04", "18.04", 3},
+		{"ubuntu", "16.10", "18.04", 2},
+		{"ubuntu", "18.04", "17.10", 0},
+		{"ubuntu", "18.06", "18.10", 0},
+		{"ubuntu", "devel", "18.04", 0},
+		{"debian", "9", "11", 0},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.distro+" "+tc.from+" "+tc.to, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			a.Equal(skippedReleases(tc.distro, tc.from, tc.to), tc.want)
+		})
+	}
+}
+
+func TestMetricsSendLocked(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name    string
+		heldFor time.Duration
+
+		wantHit bool
+		wantErr bool
+	}{
+		{"released while waiting", 100 * time.Millisecond, true, false},
+		{"another instance still running", time.Second, false, true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			unlock, err := utils.Lock(filepath.Join(out, "ubuntu-report", "lock"), 0)
+			if err != nil {
+				t.Fatal("couldn't take the lock:", err)
+			}
+			released := make(chan struct{})
+			defer func() { <-released }()
+			go func() {
+				time.Sleep(tc.heldFor)
+				unlock()
+				close(released)
+			}()
+			serverHit := false
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				serverHit = true
+			}))
+			defer ts.Close()
+
+			err = metricsSend(m, []byte(`{ "some-data": true }`), true, false, ts.URL, out, os.Stdout, os.Stdin,
+				WithInsecure(), WithLockTimeout(500*time.Millisecond))
+
+			a.CheckWantedErr(err, tc.wantErr)
+			a.Equal(serverHit, tc.wantHit)
+			_, err = os.Stat(filepath.Join(out, "ubuntu-report", "ubuntu.18.04"))
+			a.Equal(err == nil, tc.wantHit)
+		})
+	}
+}
+
+func TestMetricsSendRefusesHTTP(t *testing.T) {
+	t.Parallel()
+	a := helper.Asserter{T: t}
+
+	m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+	out, tearDown := helper.TempDir(t)
+	defer tearDown()
+	serverHit := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serverHit = true
+	}))
+	defer ts.Close()
+
+	err := metricsSend(m, []byte(`{ "some-data": true }`), true, false, ts.URL, out, os.Stdout, os.Stdin)
+
+	a.CheckWantedErr(err, true)
+	a.Equal(serverHit, false)
+	if _, err := os.Stat(filepath.Join(out, "ubuntu-report")); !os.IsNotExist(err) {
+		t.Errorf("we didn't expect any report or pending report to be saved")
+	}
+}
+
+func TestMetricsSendGzip(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name         string
+		supportsGzip bool
+
+		wantHits       []int
+		wantGzipBodies int
+	}{
+		{"server supports gzip", true, []int{1, 1}, 2},
+		{"server refuses gzip, remembered on next send", false, []int{2, 1}, 0},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			hits, gzipBodies := 0, 0
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				hits++
+				if r.Header.Get("Content-Encoding") == "gzip" {
+					if !tc.supportsGzip {
+						w.WriteHeader(http.StatusUnsupportedMediaType)
+						return
+					}
+					gzipBodies++
+				}
+			}))
+			defer ts.Close()
+
+			for i, want := range tc.wantHits {
+				hits = 0
+				m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+				if err := metricsSend(m, []byte(`{ "some-data": true }`), true, true, ts.URL, out, os.Stdout, os.Stdin, WithInsecure()); err != nil {
+					t.Fatalf("send %d failed: %v", i, err)
+				}
+				a.Equal(hits, want)
+			}
+			a.Equal(gzipBodies, tc.wantGzipBodies)
+		})
+	}
+}
+
+func TestMetricsSendVariant(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name      string
+		variantID string
+
+		wantURL string
+	}{
+		{"desktop by default", "", "/ubuntu/desktop/18.04"},
+		{"variant in os-release", "server", "/ubuntu/server/18.04"},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			osRelease, err := ioutil.ReadFile("testdata/good/etc/os-release")
+			if err != nil {
+				t.Fatal("couldn't read os-release:", err)
+			}
+			if tc.variantID != "" {
+				osRelease = append(osRelease, []byte("VARIANT_ID="+tc.variantID+"\n")...)
+			}
+			root := filepath.Join(out, "root")
+			if err := utils.WriteFile(filepath.Join(root, "etc", "os-release"), osRelease); err != nil {
+				t.Fatal("couldn't write os-release:", err)
+			}
+			serverHitAt := ""
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				serverHitAt = r.URL.String()
+			}))
+			defer ts.Close()
+
+			m := metrics.NewTestMetrics(root, nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+			err = metricsSend(m, []byte(`{ "some-data": true }`), true, false, ts.URL, out, os.Stdout, os.Stdin, WithInsecure())
+
+			a.CheckWantedErr(err, false)
+			a.Equal(serverHitAt, tc.wantURL)
+		})
+	}
+}
+
+func TestNewMetricsVariant(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name    string
+		variant string
+
+		wantErr bool
+	}{
+		{"requested variant", "core", false},
+
+		{"unknown variant", "workstation", true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m, err := newMetrics([]Option{WithVariant(tc.variant)})
+
+			a.CheckWantedErr(err, tc.wantErr)
+			if tc.wantErr {
+				return
+			}
+			a.Equal(m.GetVariant(), tc.variant)
+		})
+	}
+}
+
+func TestMetricsSendDestinations(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name         string
+		mainUp       bool
+		additionalUp bool
+		required     bool
+
+		wantReport            bool
+		wantMainPending       bool
+		wantAdditionalPending bool
+		wantErr               bool
+	}{
+		{"all destinations delivered", true, true, false, true, false, false, false},
+		{"optional destination unreachable", true, false, false, true, false, true, false},
+		{"required destination unreachable", true, false, true, true, false, true, true},
+		{"main server unreachable", false, true, false, false, true, false, true},
+		{"all destinations unreachable", false, false, false, false, true, true, true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			mainHits, additionalHits := 0, 0
+			mainTS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mainHits++
+				if !tc.mainUp {
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}
+			}))
+			defer mainTS.Close()
+			additionalTS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				additionalHits++
+				if !tc.additionalUp {
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}
+			}))
+			defer additionalTS.Close()
+			dest := WithDestination(Destination{URL: additionalTS.URL, Insecure: true, Required: tc.required})
+
+			err := metricsSend(m, []byte(`{ "some-data": true }`), true, false, mainTS.URL, out, os.Stdout, os.Stdin, WithInsecure(), dest)
+
+			a.CheckWantedErr(err, tc.wantErr)
+			a.Equal(mainHits, 1)
+			a.Equal(additionalHits, 1)
+			_, errReport := os.Stat(filepath.Join(out, "ubuntu-report", "ubuntu.18.04"))
+			a.Equal(errReport == nil, tc.wantReport)
+			_, errPending := os.Stat(filepath.Join(out, "ubuntu-report", "pending"))
+			a.Equal(errPending == nil, tc.wantMainPending)
+			additionalPending, _ := filepath.Glob(filepath.Join(out, "ubuntu-report", "pending.*"))
+			a.Equal(countReports(additionalPending) == 1, tc.wantAdditionalPending)
+
+			// the pending service only resends to destinations which didn't get the report
+			if !tc.wantMainPending && !tc.wantAdditionalPending {
+				return
+			}
+			tc.mainUp, tc.additionalUp = true, true
+			mainHits, additionalHits = 0, 0
+			m = metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+
+			err = metricsSendPendingReport(m, mainTS.URL, out, os.Stdout, os.Stdin, WithInsecure(), dest)
+
+			a.CheckWantedErr(err, false)
+			a.Equal(mainHits == 1, tc.wantMainPending)
+			a.Equal(additionalHits == 1, tc.wantAdditionalPending)
+			if _, err := os.Stat(filepath.Join(out, "ubuntu-report", "ubuntu.18.04")); err != nil {
+				t.Errorf("we expected a report to be saved once the main server got it: %v", err)
+			}
+			pendings, _ := filepath.Glob(filepath.Join(out, "ubuntu-report", "pending*"))
+			a.Equal(len(pendings), 0)
+		})
+	}
+}
+
+func TestMetricsSendDirectives(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name   string
+		answer string
+
+		wantReceiptID string
+		wantSecondHit bool
+		wantSecondErr bool
+	}{
+		{"no directive", "", "", true, false},
+		{"receipt is saved", `{"ReceiptID": "abc"}`, "abc", true, false},
+		{"unknown fields are ignored", `{"ReceiptID": "abc", "SomethingNew": true}`, "abc", true, false},
+		{"stop reporting this release", `{"StopReporting": true}`, "", false, false},
+		{"newer schema required", `{"MinSchemaVersion": 999}`, "", false, true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			hits := 0
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				hits++
+				fmt.Fprint(w, tc.answer)
+			}))
+			defer ts.Close()
+
+			m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+			err := metricsSend(m, []byte(`{ "some-data": true }`), true, false, ts.URL, out, os.Stdout, os.Stdin, WithInsecure())
+
+			a.CheckWantedErr(err, false)
+			a.Equal(hits, 1)
+			receipts, err := loadReceipts(filepath.Join(out, "ubuntu-report", "receipts"))
+			a.CheckWantedErr(err, false)
+			a.Equal(receipts["ubuntu.18.04"].ReceiptID, tc.wantReceiptID)
+			if receipts["ubuntu.18.04"].IdempotencyKey == "" {
+				t.Error("we expected the idempotency key of the report to be saved")
+			}
+
+			// directives are honoured on next runs
+			hits = 0
+			m = metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+			err = metricsSend(m, []byte(`{ "some-data": true }`), true, true, ts.URL, out, os.Stdout, os.Stdin, WithInsecure())
+
+			a.CheckWantedErr(err, tc.wantSecondErr)
+			a.Equal(hits == 1, tc.wantSecondHit)
+			if _, err := os.Stat(filepath.Join(out, "ubuntu-report", "pending")); !os.IsNotExist(err) {
+				t.Errorf("we didn't expect a pending report to be saved")
+			}
+		})
+	}
+}
+
 func TestMetricsCollectAndSend(t *testing.T) {
 	t.Parallel()
 
@@ -352,7 +898,7 @@ func TestMetricsCollectAndSend(t *testing.T) {
 				url = ts.URL
 			}
 
-			err := metricsCollectAndSend(m, tc.r, false, url, out, os.Stdout, os.Stdin)
+			err := metricsCollectAndSend(m, tc.r, false, url, out, os.Stdout, os.Stdin, WithInsecure())
 
 			a.CheckWantedErr(err, tc.wantErr)
 			// check we didn't do too much work on error
@@ -368,13 +914,12 @@ func TestMetricsCollectAndSend(t *testing.T) {
 						t.Errorf("we didn't expect finding a cache report path as we erroring out")
 					}
 				} else {
-					gotF, err := os.Open(filepath.Join(out, tc.pendingReportP))
+					got, key, err := loadPending(filepath.Join(out, tc.pendingReportP))
 					if err != nil {
 						t.Fatal("didn't generate a pending report file on disk", err)
 					}
-					got, err := ioutil.ReadAll(gotF)
-					if err != nil {
-						t.Fatal("couldn't read generated pending report file", err)
+					if key == "" {
+						t.Error("we expected the pending report to be saved with its idempotency key")
 					}
 					want := helper.LoadOrUpdateGolden(t, filepath.Join(tc.root, "gold", fmt.Sprintf("pendingreport.ReportType%d", int(tc.r))), got, *Update)
 					a.Equal(got, want)
@@ -437,7 +982,7 @@ func TestMultipleMetricsCollectAndSend(t *testing.T) {
 			}))
 			defer ts.Close()
 
-			err := metricsCollectAndSend(m, ReportAuto, tc.alwaysReport, ts.URL, out, os.Stdout, os.Stdin)
+			err := metricsCollectAndSend(m, ReportAuto, tc.alwaysReport, ts.URL, out, os.Stdout, os.Stdin, WithInsecure())
 			if err != nil {
 				t.Fatal("Didn't expect first call to fail")
 			}
@@ -456,7 +1001,7 @@ func TestMultipleMetricsCollectAndSend(t *testing.T) {
 			defer cancelArchitecture()
 			defer cancelLibc6()
 			defer cancelHwCap()
-			err = metricsCollectAndSend(m, ReportAuto, tc.alwaysReport, ts.URL, out, os.Stdout, os.Stdin)
+			err = metricsCollectAndSend(m, ReportAuto, tc.alwaysReport, ts.URL, out, os.Stdout, os.Stdin, WithInsecure())
 
 			a.CheckWantedErr(err, tc.wantErr)
 			// check we didn't do too much work on error
@@ -491,32 +1036,39 @@ func TestMetricsCollectAndSendOnUpgrade(t *testing.T) {
 		name            string
 		previousReportP string
 
-		cacheReportP    string
-		shouldHitServer bool
-		wantOptOut      bool
-		wantErr         bool
+		cacheReportP        string
+		shouldHitServer     bool
+		wantOptOut          bool
+		wantPreviousRelease *metrics.PreviousRelease
+		wantErr             bool
 	}{
 		{"without previous report",
 			"",
-			"", false, false, false},
+			"", false, false, nil, false},
 		{"with previous report, current release",
 			"testdata/previous_reports/current_release",
-			"", false, false, true},
+			"", false, false, nil, true},
 		{"with previous report, previous release opt in",
 			"testdata/previous_reports/previous_release_optin",
-			"ubuntu-report/ubuntu.18.04", true, false, false},
+			"ubuntu-report/ubuntu.18.04", true, false, &metrics.PreviousRelease{Version: "17.10", Decision: "granted"}, false},
 		{"with previous report, previous release opt out",
 			"testdata/previous_reports/previous_release_optout",
-			"ubuntu-report/ubuntu.18.04", true, true, false},
+			"ubuntu-report/ubuntu.18.04", true, true, nil, false},
 		{"with two previous reports, latest previous release opt in",
 			"testdata/previous_reports/latest_previous_release_optin",
-			"ubuntu-report/ubuntu.18.04", true, false, false},
+			"ubuntu-report/ubuntu.18.04", true, false, &metrics.PreviousRelease{Version: "16.10", Decision: "granted", SkippedReleases: 2}, false},
 		{"with two previous reports, latest previous release opt out",
 			"testdata/previous_reports/latest_previous_release_optout",
-			"ubuntu-report/ubuntu.18.04", true, true, false},
+			"ubuntu-report/ubuntu.18.04", true, true, nil, false},
 		{"with different distro reports, current optin, other distro more recent opt out",
 			"testdata/previous_reports/previous_with_different_distros",
-			"ubuntu-report/ubuntu.18.04", true, false, false},
+			"ubuntu-report/ubuntu.18.04", true, false, &metrics.PreviousRelease{Version: "16.10", Decision: "granted", SkippedReleases: 2}, false},
+		{"with previous reports, latest previous release by version opt in",
+			"testdata/previous_reports/release_versions_ordering",
+			"ubuntu-report/ubuntu.18.04", true, false, &metrics.PreviousRelease{Version: "17.10", Decision: "granted"}, false},
+		{"with a newer release report, previous release opt in",
+			"testdata/previous_reports/newer_release",
+			"ubuntu-report/ubuntu.18.04", true, false, &metrics.PreviousRelease{Version: "17.10", Decision: "granted"}, false},
 	}
 	for _, tc := range testCases {
 		tc := tc // capture range variable for parallel execution
@@ -567,7 +1119,7 @@ func TestMetricsCollectAndSendOnUpgrade(t *testing.T) {
 			defer ts.Close()
 			url := ts.URL
 
-			err := metricsCollectAndSendOnUpgrade(m, false, url, out, os.Stdout, os.Stdin)
+			err := metricsCollectAndSendOnUpgrade(m, false, url, out, os.Stdout, os.Stdin, WithInsecure())
 
 			a.CheckWantedErr(err, tc.wantErr)
 			// check we didn't do too much work on error
@@ -608,6 +1160,16 @@ func TestMetricsCollectAndSendOnUpgrade(t *testing.T) {
 			} else if !tc.wantOptOut && isOptOut {
 				t.Errorf("we wanted some data which are not opt out information, but got opt out content instead")
 			}
+			if isOptOut {
+				return
+			}
+			var report struct {
+				PreviousRelease *metrics.PreviousRelease
+			}
+			if err := json.Unmarshal(got, &report); err != nil {
+				t.Fatal("generated report isn't valid json:", err)
+			}
+			a.Equal(report.PreviousRelease, tc.wantPreviousRelease)
 		})
 	}
 }
@@ -667,7 +1229,9 @@ func TestInteractiveMetricsCollectAndSend(t *testing.T) {
 			stdin, stdinW := io.Pipe()
 			stdout, stdoutW := io.Pipe()
 
-			cmdErrs := helper.RunFunctionWithTimeout(t, func() error { return metricsCollectAndSend(m, ReportInteractive, false, ts.URL, out, stdin, stdoutW) })
+			cmdErrs := helper.RunFunctionWithTimeout(t, func() error {
+				return metricsCollectAndSend(m, ReportInteractive, false, ts.URL, out, stdin, stdoutW, WithInsecure())
+			})
 
 			gotJSONReport := false
 			answerIndex := 0
@@ -721,12 +1285,12 @@ func TestInteractiveMetricsCollectAndSend(t *testing.T) {
 			if err != nil {
 				t.Fatal("couldn't read generated report file", err)
 			}
-            
-            // To avoid case-insensitive file name collisions, append command case to golden file name.
-            cmdCase := "lc"
-            if 'A' <= tc.name[0] && tc.name[0] <= 'Z' {
-                cmdCase = "uc"
-            }
+
+			// To avoid case-insensitive file name collisions, append command case to golden file name.
+			cmdCase := "lc"
+			if 'A' <= tc.name[0] && tc.name[0] <= 'Z' {
+				cmdCase = "uc"
+			}
 
 			want := helper.LoadOrUpdateGolden(t, filepath.Join("testdata/good", "gold", fmt.Sprintf("cachereport-twice.ReportType%d-%s-%s", int(ReportInteractive), strings.Replace(tc.name, " ", "-", -1), cmdCase)), got, *Update)
 			a.Equal(got, want)
@@ -827,7 +1391,7 @@ func TestMetricsSendPendingReport(t *testing.T) {
 				url = ts.URL
 			}
 
-			err = metricsSendPendingReport(m, url, out, os.Stdout, os.Stdin)
+			err = metricsSendPendingReport(m, url, out, os.Stdout, os.Stdin, WithInsecure())
 
 			// restore directory state for checking
 			resetwritable()
@@ -864,6 +1428,180 @@ func TestMetricsSendPendingReport(t *testing.T) {
 	}
 }
 
+func TestMetricsSendPendingReportIdempotencyKey(t *testing.T) {
+	t.Parallel()
+	a := helper.Asserter{T: t}
+
+	out, tearDown := helper.TempDir(t)
+	defer tearDown()
+	var keys []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		// the first answer is lost
+		if len(keys) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+
+	m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+	err := metricsSend(m, []byte(`{ "some-data": true }`), true, false, ts.URL, out, os.Stdin, ioutil.Discard, WithInsecure())
+	a.CheckWantedErr(err, true)
+	m = metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+	err = metricsSendPendingReport(m, ts.URL, out, os.Stdin, ioutil.Discard, WithInsecure())
+	a.CheckWantedErr(err, false)
+
+	if len(keys) != 2 {
+		t.Fatalf("expected the report to be sent twice, got: %v", keys)
+	}
+	if keys[0] == "" {
+		t.Error("expected the report to be sent with an idempotency key")
+	}
+	a.Equal(keys[1], keys[0])
+	receipts, err := loadReceipts(filepath.Join(out, "ubuntu-report", "receipts"))
+	a.CheckWantedErr(err, false)
+	a.Equal(receipts["ubuntu.18.04"].IdempotencyKey, keys[0])
+}
+
+func TestMetricsSendPendingReportSchemaUnsupported(t *testing.T) {
+	t.Parallel()
+	a := helper.Asserter{T: t}
+
+	out, tearDown := helper.TempDir(t)
+	defer tearDown()
+	mainHits, additionalHits := 0, 0
+	mainTS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mainHits++
+	}))
+	defer mainTS.Close()
+	additionalTS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		additionalHits++
+	}))
+	defer additionalTS.Close()
+	dest := WithDestination(Destination{URL: additionalTS.URL, Insecure: true})
+	pendings := []string{filepath.Join(out, "ubuntu-report", "pending")}
+	dests, _, err := newOptions([]Option{WithInsecure(), dest}).destinations(mainTS.URL, "ubuntu", "desktop", "18.04")
+	if err != nil {
+		t.Fatalf("couldn't get destinations: %v", err)
+	}
+	p, err := dests[1].pendingPath(out)
+	if err != nil {
+		t.Fatalf("couldn't get pending report path: %v", err)
+	}
+	pendings = append(pendings, p)
+	for _, p := range pendings {
+		if err := utils.WriteFile(p, []byte(`{ "some-data": true }`)); err != nil {
+			t.Fatalf("couldn't write pending report: %v", err)
+		}
+	}
+	// the main server already answered it doesn't accept our report format anymore
+	if err := saveServerStates(filepath.Join(out, "ubuntu-report", "servers"),
+		map[string]serverState{mainTS.URL: {MinSchemaVersion: 999}}); err != nil {
+		t.Fatalf("couldn't save server states: %v", err)
+	}
+
+	m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+	err = metricsSendPendingReport(m, mainTS.URL, out, os.Stdin, ioutil.Discard, WithInsecure(), dest)
+
+	a.CheckWantedErr(err, false)
+	a.Equal(mainHits, 0)
+	a.Equal(additionalHits, 1)
+	for _, p := range pendings {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("we expected %s to be dropped", p)
+		}
+	}
+}
+
+func TestMetricsSendPendingReportOrphaned(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name        string
+		mainPending bool
+		dryRun      bool
+
+		wantHits int
+		wantKept bool
+	}{
+		{"orphaned pending report is dropped", false, false, 0, false},
+		{"orphaned pending report is dropped alongside sending the main one", true, false, 1, false},
+		{"orphaned pending report is kept on dry run", false, true, 0, true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			orphan := filepath.Join(out, "ubuntu-report", "pending.0123456789abcdef")
+			if err := utils.WriteFile(orphan, []byte(`{ "some-data": true }`)); err != nil {
+				t.Fatalf("couldn't write orphaned pending report: %v", err)
+			}
+			if tc.mainPending {
+				if err := utils.WriteFile(filepath.Join(out, "ubuntu-report", "pending"), []byte(`{ "some-data": true }`)); err != nil {
+					t.Fatalf("couldn't write pending report: %v", err)
+				}
+			}
+			hits := 0
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				hits++
+			}))
+			defer ts.Close()
+			opts := []Option{WithInsecure()}
+			if tc.dryRun {
+				opts = append(opts, WithDryRun())
+			}
+
+			m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+			err := metricsSendPendingReport(m, ts.URL, out, os.Stdin, ioutil.Discard, opts...)
+
+			a.CheckWantedErr(err, false)
+			a.Equal(hits, tc.wantHits)
+			_, errOrphan := os.Stat(orphan)
+			a.Equal(errOrphan == nil, tc.wantKept)
+		})
+	}
+}
+
+func TestMetricsSendPendingReportUnreachableOptionalDestination(t *testing.T) {
+	t.Parallel()
+	a := helper.Asserter{T: t}
+
+	out, tearDown := helper.TempDir(t)
+	defer tearDown()
+	mainTS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer mainTS.Close()
+	// nothing listens there anymore
+	unreachable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	unreachable.Close()
+	pending, err := destination{baseURL: unreachable.URL}.pendingPath(out)
+	if err != nil {
+		t.Fatalf("couldn't get pending report path: %v", err)
+	}
+	if err := savePending(pending, []byte(`{ "some-data": true }`), "key"); err != nil {
+		t.Fatalf("couldn't write pending report: %v", err)
+	}
+
+	m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+	done := make(chan error)
+	go func() {
+		done <- metricsSendPendingReport(m, mainTS.URL, out, os.Stdin, ioutil.Discard,
+			WithInsecure(), WithDestination(Destination{URL: unreachable.URL, Insecure: true}))
+	}()
+
+	select {
+	case err := <-done:
+		a.CheckWantedErr(err, false)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the pending report service kept retrying an optional destination")
+	}
+	_, errPending := os.Stat(pending)
+	a.Equal(os.IsNotExist(errPending), true)
+}
+
 func newMockShortCmd(t *testing.T, s ...string) (*exec.Cmd, context.CancelFunc) {
 	t.Helper()
 	return helper.ShortProcess(t, "TestMetricsHelperProcess", s...)
@@ -913,3 +1651,14 @@ func dropCR(data []byte) []byte {
 	}
 	return data
 }
+
+// countReports ignores checksums of stored files in paths
+func countReports(paths []string) int {
+	n := 0
+	for _, p := range paths {
+		if !utils.IsChecksumFile(p) {
+			n++
+		}
+	}
+	return n
+}
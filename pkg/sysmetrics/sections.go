@@ -0,0 +1,181 @@
+package sysmetrics
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/ubuntu/ubuntu-report/internal/i18n"
+	"github.com/ubuntu/ubuntu-report/internal/metrics"
+	"github.com/ubuntu/ubuntu-report/internal/utils"
+)
+
+// Sections are the parts of the report users can choose not to send in the terminal interface
+var Sections = metrics.Sections
+
+// terminal control sequences of the full-screen interface
+const (
+	// enterScreen switches to the alternate screen and hides the cursor, leaveScreen restores both
+	enterScreen = "\x1b[?1049h\x1b[?25l"
+	leaveScreen = "\x1b[?25h\x1b[?1049l"
+	// cursorHome moves the cursor to the top left corner, to redraw the screen in place
+	cursorHome = "\x1b[H"
+	// clearLine clears the rest of the line and clearBelow the rest of the screen
+	clearLine  = "\x1b[K"
+	clearBelow = "\x1b[J"
+)
+
+// keys of the full-screen interface, as read by answers.nextKey
+const (
+	keyUp         = "\x1b[A"
+	keyUpApp      = "\x1bOA"
+	keyDown       = "\x1b[B"
+	keyDownApp    = "\x1bOB"
+	keyToggle     = " "
+	keyEscape     = "\x1b"
+	keyInterrupt  = "\x03"
+	keyEndOfInput = "\x04"
+)
+
+// WithTerminalUI lets users choose which sections of the report to send in a full-screen terminal interface,
+// previewing the report as they toggle them, when reporting interactively.
+// Line prompts are used when input or output isn't a terminal.
+func WithTerminalUI() Option {
+	return func(o *options) {
+		o.terminalUI = true
+	}
+}
+
+// withExcludedSections removes sections from automated reports and records them alongside the consent
+func withExcludedSections(sections []string) Option {
+	return func(o *options) {
+		o.excludedSections = sections
+	}
+}
+
+// makeRaw puts the terminal s in raw mode, so that keys are read as soon as typed.
+// It returns a function restoring its previous mode.
+func makeRaw(s interface{}) (func(), error) {
+	f, ok := s.(*os.File)
+	if !ok {
+		return nil, errors.New("not a terminal")
+	}
+	restore, err := utils.MakeRaw(f)
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		if err := restore(); err != nil {
+			log.Warningf("couldn't restore terminal mode: "+utils.ErrFormat, err)
+		}
+	}, nil
+}
+
+// terminalRows returns the number of rows of the terminal s, or 0 if unknown
+func terminalRows(s interface{}) int {
+	f, ok := s.(*os.File)
+	if !ok {
+		return 0
+	}
+	return utils.TerminalRows(f)
+}
+
+// chooseSections shows the sections of report data full screen, with toggles, and a preview of the report to send.
+// Keys are read from answers, in a raw terminal: the screen is redrawn in place after each of them, until the
+// user sends, opts out or quits. The report preview is cut to fit the rows of the terminal, if known.
+// It returns the report to send, whether metrics are sent, the sections left out and false if the user quit.
+func chooseSections(data []byte, answers *answers, out io.Writer, rows int) ([]byte, bool, []string, bool, error) {
+	tr := answers.catalog
+	excluded := make(map[string]bool)
+	current := 0
+
+	fmt.Fprint(out, enterScreen)
+	defer fmt.Fprint(out, leaveScreen)
+	for {
+		var sections []string
+		for _, s := range Sections {
+			if excluded[s] {
+				sections = append(sections, s)
+			}
+		}
+		report, err := metrics.RemoveSections(data, sections)
+		if err != nil {
+			return nil, false, nil, false, err
+		}
+		drawSections(out, tr, excluded, current, report, rows)
+
+		key, ok := answers.nextKey()
+		if !ok {
+			log.Info("programm interrupted")
+			return nil, false, nil, false, nil
+		}
+		// section numbers and commands first, as digits and letters can answer yes or no in some languages
+		if i, err := strconv.Atoi(key); err == nil && i >= 1 && i <= len(Sections) {
+			current = i - 1
+			excluded[Sections[current]] = !excluded[Sections[current]]
+			continue
+		}
+		switch {
+		case key == keyUp || key == keyUpApp:
+			if current > 0 {
+				current--
+			}
+		case key == keyDown || key == keyDownApp:
+			if current < len(Sections)-1 {
+				current++
+			}
+		case key == keyToggle:
+			excluded[Sections[current]] = !excluded[Sections[current]]
+		case key == keyEscape || key == keyInterrupt || key == keyEndOfInput || strings.ToLower(key) == "q":
+			return nil, false, nil, false, nil
+		case tr.IsYes(key):
+			log.Debugf("sending report was accepted, without sections %v", sections)
+			return report, true, sections, true, nil
+		case tr.IsNo(key):
+			log.Debug("sending report was denied")
+			return data, false, nil, true, nil
+		}
+	}
+}
+
+// drawSections redraws the screen with the sections, the current one being highlighted, and the report preview
+func drawSections(out io.Writer, tr *i18n.Catalog, excluded map[string]bool, current int, report []byte, rows int) {
+	lines := []string{tr.Get("Choose which sections of the report to send:")}
+	for i, s := range Sections {
+		cursor := " "
+		if i == current {
+			cursor = ">"
+		}
+		mark := "x"
+		if excluded[s] {
+			mark = " "
+		}
+		fields, _ := metrics.SectionFields(s)
+		lines = append(lines, fmt.Sprintf("%s %d [%s] %-9s  %s", cursor, i+1, mark, s, strings.Join(fields, ", ")))
+	}
+	lines = append(lines, "",
+		tr.Get("up/down: select a section, space: toggle it, y: send metrics, n: send opt out message, q: quit"), "",
+		tr.Get("This is the report that will be sent:"))
+
+	// the last row is kept empty, so that the screen doesn't scroll
+	preview := strings.Split(strings.TrimRight(string(report), "\n"), "\n")
+	if rows > 0 && len(lines)+len(preview) > rows-1 {
+		n := rows - 2 - len(lines)
+		if n < 0 {
+			n = 0
+		}
+		preview = append(preview[:n], "...")
+	}
+
+	var b strings.Builder
+	b.WriteString(cursorHome)
+	for _, l := range append(lines, preview...) {
+		b.WriteString(l + clearLine + "\n")
+	}
+	b.WriteString(clearBelow)
+	fmt.Fprint(out, b.String())
+}
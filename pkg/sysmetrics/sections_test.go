@@ -0,0 +1,188 @@
+package sysmetrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ubuntu/ubuntu-report/internal/helper"
+	"github.com/ubuntu/ubuntu-report/internal/i18n"
+	"github.com/ubuntu/ubuntu-report/internal/utils"
+)
+
+func TestInteractiveMetricsCollectAndSendTerminalUI(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		terminal bool
+		noRaw    bool
+		keys     string
+
+		wantSent     bool
+		wantOptOut   bool
+		wantMissing  []string
+		wantExcluded []string
+		wantScreen   bool
+	}{
+		{"send whole report", true, false, "y", true, false, nil, nil, true},
+		{"send without sections", true, false, " " + keyDown + keyDown + " " + keyDown + keyDown + " y", true, false,
+			[]string{"CPU", "GPU", "Screens", "Language"}, []string{"hardware", "display", "locale"}, true},
+		{"toggle sections with their number", true, false, "35y", true, false, []string{"Screens", "Language"},
+			[]string{"display", "locale"}, true},
+		{"application mode arrows", true, false, keyDownApp + keyDownApp + keyUpApp + " y", true, false, []string{"Disks"},
+			[]string{"storage"}, true},
+		{"selection stays within sections", true, false, keyUp + " " + strings.Repeat(keyDown, 10) + " y", true, false,
+			[]string{"CPU", "GPU"}, []string{"hardware", "upgrade"}, true},
+		{"toggle section back", true, false, "  y", true, false, nil, nil, true},
+		{"unknown keys are ignored", true, false, "08x\x1b[Dy", true, false, nil, nil, true},
+		{"opt out", true, false, " n", true, true, nil, nil, true},
+		{"quit", true, false, " q", false, false, nil, nil, true},
+		{"escape quits", true, false, " " + keyEscape, false, false, nil, nil, true},
+		{"ctrl-c quits", true, false, " " + keyInterrupt, false, false, nil, nil, true},
+		{"interrupted", true, false, " ", false, false, nil, nil, true},
+
+		{"not a terminal uses line prompt", false, false, "1\ny\n", true, false, nil, nil, false},
+		{"terminal without raw mode uses line prompt", true, true, "1\ny\n", true, false, nil, nil, false},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			defer ts.Close()
+
+			m, cancel := newDiffTestMetrics(t)
+			defer cancel()
+			stdout := &bytes.Buffer{}
+			restored := false
+			err := metricsCollectAndSend(m, ReportInteractive, false, ts.URL, out, strings.NewReader(tc.keys), stdout,
+				WithInsecure(), WithTerminalUI(), func(o *options) {
+					o.isTerminal = func(interface{}) bool { return tc.terminal }
+					o.makeRaw = func(interface{}) (func(), error) {
+						if tc.noRaw {
+							return nil, errors.New("no raw mode")
+						}
+						return func() { restored = true }, nil
+					}
+				})
+
+			a.CheckWantedErr(err, false)
+			a.Equal(strings.Contains(stdout.String(), enterScreen), tc.wantScreen)
+			a.Equal(restored, tc.wantScreen)
+			if tc.wantScreen && !strings.HasSuffix(stdout.String(), leaveScreen) {
+				t.Errorf("expected to leave the full-screen interface, got: %q", stdout.String())
+			}
+			b, err := ioutil.ReadFile(filepath.Join(out, "ubuntu-report", "ubuntu.18.04"))
+			if !tc.wantSent {
+				if !os.IsNotExist(err) {
+					t.Errorf("we didn't expect any report to be sent, got: %s", b)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("we expected a report to be sent:", err)
+			}
+			a.Equal(isOptOut(b), tc.wantOptOut)
+			if !tc.wantOptOut {
+				var got map[string]interface{}
+				if err := json.Unmarshal(b, &got); err != nil {
+					t.Fatal("sent report isn't valid json:", err)
+				}
+				for _, f := range []string{"Version", "CPU", "GPU", "Disks", "Screens", "Session", "Language"} {
+					_, ok := got[f]
+					a.Equal(ok, !stringInSlice(f, tc.wantMissing))
+				}
+			}
+
+			c, err := newOptions([]Option{WithInsecure()}).loadConsent(ts.URL, "ubuntu", "18.04", out)
+			a.CheckWantedErr(err, false)
+			a.Equal(c.ExcludedSections, tc.wantExcluded)
+		})
+	}
+}
+
+func TestDrawSectionsFitsTerminal(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		rows int
+
+		wantLines int
+		wantCut   bool
+	}{
+		{"unknown size shows the whole report", 0, 12 + 30, false},
+		{"large terminal shows the whole report", 100, 12 + 30, false},
+		{"small terminal cuts the report", 20, 19, true},
+		{"tiny terminal only shows the sections", 5, 12 + 1, true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			report := strings.Repeat("line\n", 30)
+			out := &bytes.Buffer{}
+			drawSections(out, i18n.Load("", "C"), map[string]bool{}, 0, []byte(report), tc.rows)
+
+			a.Equal(strings.HasPrefix(out.String(), cursorHome), true)
+			a.Equal(strings.HasSuffix(out.String(), clearBelow), true)
+			a.Equal(strings.Count(out.String(), "\n"), tc.wantLines)
+			a.Equal(strings.Contains(out.String(), "..."), tc.wantCut)
+		})
+	}
+}
+
+func TestMetricsCollectAndSendOnUpgradeExcludedSections(t *testing.T) {
+	t.Parallel()
+	a := helper.Asserter{T: t}
+
+	out, tearDown := helper.TempDir(t)
+	defer tearDown()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	previous, err := ioutil.ReadFile("testdata/previous_reports/previous_release_optin/ubuntu.17.10")
+	if err != nil {
+		t.Fatal("couldn't read previous report:", err)
+	}
+	if err := utils.WriteFile(filepath.Join(out, "ubuntu-report", "ubuntu.17.10"), previous); err != nil {
+		t.Fatal("couldn't write previous report:", err)
+	}
+	writeJSON(t, filepath.Join(out, "ubuntu-report", "user-consent"),
+		Consent{Decision: ConsentGranted, Source: ConsentFromCLI, ExcludedSections: []string{"display", "locale"}})
+
+	m, cancel := newDiffTestMetrics(t)
+	defer cancel()
+	err = metricsCollectAndSendOnUpgrade(m, false, ts.URL, out, os.Stdin, ioutil.Discard, WithInsecure())
+
+	a.CheckWantedErr(err, false)
+	b, err := ioutil.ReadFile(filepath.Join(out, "ubuntu-report", "ubuntu.18.04"))
+	if err != nil {
+		t.Fatal("we expected a report to be sent:", err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal("sent report isn't valid json:", err)
+	}
+	for _, f := range []string{"CPU", "Screens", "Language", "Timezone"} {
+		_, ok := got[f]
+		a.Equal(ok, !stringInSlice(f, []string{"Screens", "Language", "Timezone"}))
+	}
+	c, err := newOptions([]Option{WithInsecure()}).loadConsent(ts.URL, "ubuntu", "18.04", out)
+	a.CheckWantedErr(err, false)
+	a.Equal(c.ExcludedSections, []string{"display", "locale"})
+}
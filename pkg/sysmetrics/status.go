@@ -0,0 +1,178 @@
+package sysmetrics
+
+import (
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/ubuntu/ubuntu-report/internal/config"
+	"github.com/ubuntu/ubuntu-report/internal/metrics"
+	"github.com/ubuntu/ubuntu-report/internal/sender"
+	"github.com/ubuntu/ubuntu-report/internal/utils"
+)
+
+// ReportingStatus summarizes what was reported from this machine for the current release and what is
+// waiting to be, as returned by Status
+type ReportingStatus struct {
+	Distro string
+	// Variant is the product variant reports are sent for
+	Variant string
+	Version string
+	// Reported is ConsentGranted if metrics were delivered for this release, ConsentDenied if it was an
+	// opt-out message and ConsentUnknown if nothing was delivered yet
+	Reported ConsentDecision
+	// ReportPath is where the delivered report is saved
+	ReportPath string `json:",omitempty"`
+	// Consent is the recorded decision of the user and ConsentOutdated is true if the privacy policy
+	// changed since then
+	Consent         Consent
+	ConsentOutdated bool `json:",omitempty"`
+	// Pending are the reports which couldn't be delivered yet
+	Pending []PendingReport `json:",omitempty"`
+	// ServerURL is the main metrics server
+	ServerURL string
+	// Scope is "user" when every user of the machine reports, "machine" when reporting once per machine
+	Scope string
+	// ConfigSources are the configuration files in use
+	ConfigSources []string `json:",omitempty"`
+	// Blocked is why the main server won't accept a report for this release, if any
+	Blocked string `json:",omitempty"`
+	// DestinationError is why reports can't be sent to the configured destinations, like an insecure url, if any
+	DestinationError string `json:",omitempty"`
+}
+
+// PendingReport is a report waiting to be delivered to a server
+type PendingReport struct {
+	// URL the report is sent to
+	URL  string
+	Path string
+	// SavedAt is when it was last saved as pending
+	SavedAt time.Time
+	// FailedAttempts is how many times it couldn't be delivered
+	FailedAttempts int
+	// LastAttempt is when it was last sent and LastError why it failed
+	LastAttempt time.Time
+	LastError   string `json:",omitempty"`
+}
+
+// metricsStatus returns what was reported for the current release, what is pending and what
+// prevents reporting, without changing anything. Misconfigured destinations are part of the status.
+func metricsStatus(m metrics.Metrics, baseURL, reportBasePath string, opts ...Option) (ReportingStatus, error) {
+	o := newOptions(opts)
+
+	distro, version, err := m.GetIDS()
+	if err != nil {
+		return ReportingStatus{}, errors.Wrapf(err, "couldn't get mandatory information")
+	}
+	variant := m.GetVariant()
+
+	s := ReportingStatus{
+		Distro:        distro,
+		Variant:       variant,
+		Version:       version,
+		Scope:         config.ScopeUser,
+		ConfigSources: o.configSources,
+	}
+	dests, urls, err := o.destinations(baseURL, distro, variant, version)
+	if err != nil {
+		s.DestinationError = err.Error()
+		dests, urls = o.uncheckedDestinations(baseURL, distro, variant, version)
+	}
+	s.ServerURL = dests[0].baseURL
+	if o.machineStateDir != "" {
+		s.Scope = config.ScopeMachine
+	}
+
+	if s.ReportPath, s.Reported, err = reportedDecision(distro, version, reportBasePath, o.machineStateDir); err != nil {
+		return ReportingStatus{}, err
+	}
+	if s.Consent, err = o.loadConsent(baseURL, distro, version, reportBasePath); err != nil {
+		return ReportingStatus{}, err
+	}
+	s.ConsentOutdated = s.Consent.Outdated
+	statesP, err := utils.ServerStatePath(reportBasePath)
+	if err != nil {
+		return ReportingStatus{}, errors.Wrapf(err, "couldn't get where server states are stored on disk")
+	}
+	if err := loadServerStates(statesP)[s.ServerURL].allows(distro, version); err != nil {
+		s.Blocked = err.Error()
+	}
+
+	ledger, err := loadLedger(reportBasePath)
+	if err != nil {
+		return ReportingStatus{}, err
+	}
+	for i, d := range dests {
+		p, err := d.pendingPath(reportBasePath)
+		if err != nil {
+			return ReportingStatus{}, errors.Wrapf(err, "couldn't get where pending reports are stored on disk")
+		}
+		fi, err := os.Stat(p)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return ReportingStatus{}, errors.Wrapf(err, "couldn't read pending report")
+		}
+		s.Pending = append(s.Pending, pendingReport(urls[i], p, fi.ModTime(), ledger))
+	}
+	return s, nil
+}
+
+// uncheckedDestinations returns the destinations reports are sent to and their urls, like destinations, but
+// without refusing invalid or insecure urls. Urls which can't be built are empty.
+func (o options) uncheckedDestinations(baseURL, distro, variant, version string) ([]destination, []string) {
+	// the url is returned even if it's refused
+	baseURL, _ = o.mainBaseURL(baseURL)
+	dests := append([]destination{{baseURL: baseURL, tls: o.tls, required: true, main: true}}, o.additionalDestinations...)
+
+	var urls []string
+	for _, d := range dests {
+		u, _ := sender.GetURL(d.baseURL, distro, variant, version)
+		urls = append(urls, u)
+	}
+	return dests, urls
+}
+
+// reportedDecision returns where the report of distro and version delivered by this user, or machine-wide
+// if machineStateDir isn't empty, is saved and if it was an opt-out message.
+func reportedDecision(distro, version, reportBasePath, machineStateDir string) (string, ConsentDecision, error) {
+	bases := []string{reportBasePath}
+	if machineStateDir != "" {
+		bases = append(bases, machineStateDir)
+	}
+	for _, base := range bases {
+		p, err := utils.ReportPath(distro, version, base)
+		if err != nil {
+			return "", ConsentUnknown, errors.Wrapf(err, "couldn't get where reported metrics are on disk")
+		}
+		// like when reporting, an interrupted or damaged report doesn't count as reported
+		b, err := utils.ReadFile(p)
+		if err != nil {
+			continue
+		}
+		if isOptOut(b) {
+			return p, ConsentDenied, nil
+		}
+		return p, ConsentGranted, nil
+	}
+	return "", ConsentUnknown, nil
+}
+
+// pendingReport returns the retry state of the report saved at p on savedAt for u, from the ledger.
+// Every attempt which failed since the last delivery to u was one for this report.
+func pendingReport(u, p string, savedAt time.Time, ledger []Transmission) PendingReport {
+	r := PendingReport{URL: u, Path: p, SavedAt: savedAt}
+	for _, t := range ledger {
+		if t.URL != u || t.Kind == KindDeletion {
+			continue
+		}
+		if t.Result == TransmissionDelivered {
+			r.FailedAttempts, r.LastAttempt, r.LastError = 0, time.Time{}, ""
+			continue
+		}
+		r.FailedAttempts++
+		r.LastAttempt = t.Time
+		r.LastError = t.Error
+	}
+	return r
+}
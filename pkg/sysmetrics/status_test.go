@@ -0,0 +1,115 @@
+package sysmetrics
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ubuntu/ubuntu-report/internal/helper"
+	"github.com/ubuntu/ubuntu-report/internal/metrics"
+	"github.com/ubuntu/ubuntu-report/internal/utils"
+)
+
+func TestMetricsStatus(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name        string
+		sends       []bool
+		answer      string
+		status      int
+		machineWide string
+		secureOnly  bool
+
+		wantReported       ConsentDecision
+		wantMachineReport  bool
+		wantFailedAttempts int
+		wantPending        bool
+		wantBlocked        bool
+		wantDestinationErr bool
+	}{
+		{"nothing reported", nil, "", http.StatusOK, "", false, ConsentUnknown, false, 0, false, false, false},
+		{"metrics reported", []bool{true}, "", http.StatusOK, "", false, ConsentGranted, false, 0, false, false, false},
+		{"opt-out reported", []bool{false}, "", http.StatusOK, "", false, ConsentDenied, false, 0, false, false, false},
+		{"reported machine-wide", nil, "", http.StatusOK, `{ "some-data": true }`, false, ConsentGranted, true, 0, false, false, false},
+		{"opted out machine-wide", nil, "", http.StatusOK, optOutJSON, false, ConsentDenied, true, 0, false, false, false},
+		{"pending report", []bool{true}, "", http.StatusInternalServerError, "", false, ConsentUnknown, false, 1, true, false, false},
+		{"pending report retried", []bool{true, true}, "", http.StatusInternalServerError, "", false, ConsentUnknown, false, 2, true, false, false},
+		{"insecure server url", []bool{true}, "", http.StatusInternalServerError, "", true, ConsentUnknown, false, 1, true, false, true},
+		{"server stopped reporting", []bool{true}, `{"StopReporting": true}`, http.StatusOK, "", false, ConsentGranted, false, 0, false, true, false},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			machineDir := filepath.Join(out, "machine")
+			opts := []Option{WithInsecure(), func(o *options) {
+				o.machineStateDir = machineDir
+				o.configSources = []string{"/etc/ubuntu-report/config.yaml"}
+			}}
+			if tc.machineWide != "" {
+				if err := utils.WriteFile(filepath.Join(machineDir, "ubuntu-report", "ubuntu.18.04"), []byte(tc.machineWide)); err != nil {
+					t.Fatal("couldn't write machine-wide report:", err)
+				}
+			}
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.status)
+				fmt.Fprint(w, tc.answer)
+			}))
+			defer ts.Close()
+			for _, granted := range tc.sends {
+				m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+				metricsSend(m, []byte(`{ "some-data": true }`), granted, false, ts.URL, out, os.Stdin, os.Stdout, opts...)
+			}
+
+			m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+			if tc.secureOnly {
+				opts = opts[1:]
+			}
+			got, err := metricsStatus(m, ts.URL, out, opts...)
+
+			a.CheckWantedErr(err, false)
+			a.Equal(got.Distro, "ubuntu")
+			a.Equal(got.Version, "18.04")
+			a.Equal(got.ServerURL, ts.URL)
+			a.Equal(got.Scope, "machine")
+			a.Equal(got.ConfigSources, []string{"/etc/ubuntu-report/config.yaml"})
+			a.Equal(got.Reported, tc.wantReported)
+			switch {
+			case tc.wantReported == ConsentUnknown:
+				a.Equal(got.ReportPath, "")
+			case tc.wantMachineReport:
+				a.Equal(got.ReportPath, filepath.Join(machineDir, "ubuntu-report", "ubuntu.18.04"))
+			default:
+				a.Equal(got.ReportPath, filepath.Join(out, "ubuntu-report", "ubuntu.18.04"))
+			}
+			if len(tc.sends) > 0 && got.Consent.Decision == ConsentUnknown {
+				t.Error("we expected the consent to be recorded")
+			}
+			a.Equal(got.Blocked != "", tc.wantBlocked)
+			a.Equal(got.DestinationError != "", tc.wantDestinationErr)
+
+			if !tc.wantPending {
+				a.Equal(len(got.Pending), 0)
+				return
+			}
+			if len(got.Pending) != 1 {
+				t.Fatalf("expected one pending report, got: %+v", got.Pending)
+			}
+			p := got.Pending[0]
+			a.Equal(p.URL, ts.URL+"/ubuntu/desktop/18.04")
+			a.Equal(p.Path, filepath.Join(out, "ubuntu-report", "pending"))
+			a.Equal(p.FailedAttempts, tc.wantFailedAttempts)
+			if p.SavedAt.IsZero() || p.LastAttempt.IsZero() || p.LastError == "" {
+				t.Errorf("we expected when the report was saved and last attempted, and why it failed, got: %+v", p)
+			}
+		})
+	}
+}